@@ -0,0 +1,12 @@
+package check
+
+import "github.com/concourse/pool-resource/out"
+
+type CheckRequest struct {
+	Source  out.Source   `json:"source"`
+	Version *out.Version `json:"version"`
+}
+
+func (request CheckRequest) Validate() []string {
+	return request.Source.Validate()
+}
@@ -0,0 +1,72 @@
+package check
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+type Checker struct {
+	Source out.Source
+	Output io.Writer
+
+	Repository Repository
+}
+
+func NewChecker(source out.Source, output io.Writer) Checker {
+	checker := Checker{
+		Source: source,
+		Output: output,
+	}
+
+	if store := out.NewPoolStore(source); store != nil {
+		checker.Repository = NewStoreRepository(store, output)
+	} else {
+		checker.Repository = NewGitRepository(source, output)
+	}
+
+	return checker
+}
+
+//go:generate go tool counterfeiter -generate
+
+//counterfeiter:generate -o ./fakes . Repository
+type Repository interface {
+	Setup() error
+	RefExists(ref string) bool
+	LatestRef(path string) (ref string, err error)
+	RefsSince(ref string, path string) (refs []string, err error)
+}
+
+func (c *Checker) Check(version *out.Version) ([]out.Version, error) {
+	err := c.Repository.Setup()
+	if err != nil {
+		return nil, fmt.Errorf("setup: %w", err)
+	}
+
+	var refs []string
+
+	if version != nil && version.Ref != "" && c.Repository.RefExists(version.Ref) {
+		refs, err = c.Repository.RefsSince(version.Ref, c.Source.Pool)
+		if err != nil {
+			return nil, fmt.Errorf("listing refs since %s: %w", version.Ref, err)
+		}
+	} else {
+		ref, err := c.Repository.LatestRef(c.Source.Pool)
+		if err != nil {
+			return nil, fmt.Errorf("finding latest ref: %w", err)
+		}
+
+		if ref != "" {
+			refs = []string{ref}
+		}
+	}
+
+	versions := []out.Version{}
+	for _, ref := range refs {
+		versions = append(versions, out.Version{Ref: ref})
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,159 @@
+package check_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/concourse/pool-resource/check"
+	fakes "github.com/concourse/pool-resource/check/fakes"
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Checker", func() {
+	var checker check.Checker
+	var fakeRepository *fakes.FakeRepository
+	var output *gbytes.Buffer
+
+	BeforeEach(func() {
+		fakeRepository = new(fakes.FakeRepository)
+
+		output = gbytes.NewBuffer()
+
+		checker = check.Checker{
+			Source: out.Source{
+				URI:    "some-uri",
+				Pool:   "my-pool",
+				Branch: "some-branch",
+			},
+			Output:     output,
+			Repository: fakeRepository,
+		}
+	})
+
+	Context("when setup fails", func() {
+		BeforeEach(func() {
+			fakeRepository.SetupReturns(errors.New("some-error"))
+		})
+
+		It("returns an error", func() {
+			_, err := checker.Check(nil)
+			Ω(err).Should(HaveOccurred())
+
+			Ω(fakeRepository.LatestRefCallCount()).Should(Equal(0))
+			Ω(fakeRepository.RefsSinceCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when no version is given", func() {
+		It("looks up the latest ref of the pool", func() {
+			_, err := checker.Check(nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.LatestRefCallCount()).Should(Equal(1))
+			Ω(fakeRepository.LatestRefArgsForCall(0)).Should(Equal("my-pool"))
+			Ω(fakeRepository.RefsSinceCallCount()).Should(Equal(0))
+		})
+
+		Context("when the pool has a commit", func() {
+			BeforeEach(func() {
+				fakeRepository.LatestRefReturns("some-ref", nil)
+			})
+
+			It("returns only that version", func() {
+				versions, err := checker.Check(nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(versions).Should(Equal([]out.Version{
+					{Ref: "some-ref"},
+				}))
+			})
+		})
+
+		Context("when the pool has no commits", func() {
+			BeforeEach(func() {
+				fakeRepository.LatestRefReturns("", nil)
+			})
+
+			It("returns an empty list of versions", func() {
+				versions, err := checker.Check(nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(versions).ShouldNot(BeNil())
+				Ω(versions).Should(BeEmpty())
+			})
+		})
+
+		Context("when looking up the latest ref fails", func() {
+			BeforeEach(func() {
+				fakeRepository.LatestRefReturns("", errors.New("disaster"))
+			})
+
+			It("returns an error", func() {
+				_, err := checker.Check(nil)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when a version is given", func() {
+		var version *out.Version
+
+		BeforeEach(func() {
+			version = &out.Version{Ref: "some-ref"}
+		})
+
+		Context("when the ref exists", func() {
+			BeforeEach(func() {
+				fakeRepository.RefExistsReturns(true)
+				fakeRepository.RefsSinceReturns([]string{"some-ref", "some-other-ref"}, nil)
+			})
+
+			It("returns every version of the pool from the given ref on", func() {
+				versions, err := checker.Check(version)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRepository.RefExistsArgsForCall(0)).Should(Equal("some-ref"))
+
+				ref, path := fakeRepository.RefsSinceArgsForCall(0)
+				Ω(ref).Should(Equal("some-ref"))
+				Ω(path).Should(Equal("my-pool"))
+
+				Ω(versions).Should(Equal([]out.Version{
+					{Ref: "some-ref"},
+					{Ref: "some-other-ref"},
+				}))
+			})
+
+			Context("when listing the refs fails", func() {
+				BeforeEach(func() {
+					fakeRepository.RefsSinceReturns(nil, errors.New("disaster"))
+				})
+
+				It("returns an error", func() {
+					_, err := checker.Check(version)
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when the ref does not exist", func() {
+			BeforeEach(func() {
+				fakeRepository.RefExistsReturns(false)
+				fakeRepository.LatestRefReturns("latest-ref", nil)
+			})
+
+			It("falls back to the latest ref of the pool", func() {
+				versions, err := checker.Check(version)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRepository.RefsSinceCallCount()).Should(Equal(0))
+				Ω(versions).Should(Equal([]out.Version{
+					{Ref: "latest-ref"},
+				}))
+			})
+		})
+	})
+})
@@ -0,0 +1,336 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"github.com/concourse/pool-resource/check"
+)
+
+type FakeRepository struct {
+	LatestRefStub        func(string) (string, error)
+	latestRefMutex       sync.RWMutex
+	latestRefArgsForCall []struct {
+		arg1 string
+	}
+	latestRefReturns struct {
+		result1 string
+		result2 error
+	}
+	latestRefReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	RefExistsStub        func(string) bool
+	refExistsMutex       sync.RWMutex
+	refExistsArgsForCall []struct {
+		arg1 string
+	}
+	refExistsReturns struct {
+		result1 bool
+	}
+	refExistsReturnsOnCall map[int]struct {
+		result1 bool
+	}
+	RefsSinceStub        func(string, string) ([]string, error)
+	refsSinceMutex       sync.RWMutex
+	refsSinceArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	refsSinceReturns struct {
+		result1 []string
+		result2 error
+	}
+	refsSinceReturnsOnCall map[int]struct {
+		result1 []string
+		result2 error
+	}
+	SetupStub        func() error
+	setupMutex       sync.RWMutex
+	setupArgsForCall []struct {
+	}
+	setupReturns struct {
+		result1 error
+	}
+	setupReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeRepository) LatestRef(arg1 string) (string, error) {
+	fake.latestRefMutex.Lock()
+	ret, specificReturn := fake.latestRefReturnsOnCall[len(fake.latestRefArgsForCall)]
+	fake.latestRefArgsForCall = append(fake.latestRefArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.LatestRefStub
+	fakeReturns := fake.latestRefReturns
+	fake.recordInvocation("LatestRef", []interface{}{arg1})
+	fake.latestRefMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) LatestRefCallCount() int {
+	fake.latestRefMutex.RLock()
+	defer fake.latestRefMutex.RUnlock()
+	return len(fake.latestRefArgsForCall)
+}
+
+func (fake *FakeRepository) LatestRefCalls(stub func(string) (string, error)) {
+	fake.latestRefMutex.Lock()
+	defer fake.latestRefMutex.Unlock()
+	fake.LatestRefStub = stub
+}
+
+func (fake *FakeRepository) LatestRefArgsForCall(i int) string {
+	fake.latestRefMutex.RLock()
+	defer fake.latestRefMutex.RUnlock()
+	argsForCall := fake.latestRefArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) LatestRefReturns(result1 string, result2 error) {
+	fake.latestRefMutex.Lock()
+	defer fake.latestRefMutex.Unlock()
+	fake.LatestRefStub = nil
+	fake.latestRefReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) LatestRefReturnsOnCall(i int, result1 string, result2 error) {
+	fake.latestRefMutex.Lock()
+	defer fake.latestRefMutex.Unlock()
+	fake.LatestRefStub = nil
+	if fake.latestRefReturnsOnCall == nil {
+		fake.latestRefReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.latestRefReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) RefExists(arg1 string) bool {
+	fake.refExistsMutex.Lock()
+	ret, specificReturn := fake.refExistsReturnsOnCall[len(fake.refExistsArgsForCall)]
+	fake.refExistsArgsForCall = append(fake.refExistsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.RefExistsStub
+	fakeReturns := fake.refExistsReturns
+	fake.recordInvocation("RefExists", []interface{}{arg1})
+	fake.refExistsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) RefExistsCallCount() int {
+	fake.refExistsMutex.RLock()
+	defer fake.refExistsMutex.RUnlock()
+	return len(fake.refExistsArgsForCall)
+}
+
+func (fake *FakeRepository) RefExistsCalls(stub func(string) bool) {
+	fake.refExistsMutex.Lock()
+	defer fake.refExistsMutex.Unlock()
+	fake.RefExistsStub = stub
+}
+
+func (fake *FakeRepository) RefExistsArgsForCall(i int) string {
+	fake.refExistsMutex.RLock()
+	defer fake.refExistsMutex.RUnlock()
+	argsForCall := fake.refExistsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) RefExistsReturns(result1 bool) {
+	fake.refExistsMutex.Lock()
+	defer fake.refExistsMutex.Unlock()
+	fake.RefExistsStub = nil
+	fake.refExistsReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeRepository) RefExistsReturnsOnCall(i int, result1 bool) {
+	fake.refExistsMutex.Lock()
+	defer fake.refExistsMutex.Unlock()
+	fake.RefExistsStub = nil
+	if fake.refExistsReturnsOnCall == nil {
+		fake.refExistsReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.refExistsReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeRepository) RefsSince(arg1 string, arg2 string) ([]string, error) {
+	fake.refsSinceMutex.Lock()
+	ret, specificReturn := fake.refsSinceReturnsOnCall[len(fake.refsSinceArgsForCall)]
+	fake.refsSinceArgsForCall = append(fake.refsSinceArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.RefsSinceStub
+	fakeReturns := fake.refsSinceReturns
+	fake.recordInvocation("RefsSince", []interface{}{arg1, arg2})
+	fake.refsSinceMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) RefsSinceCallCount() int {
+	fake.refsSinceMutex.RLock()
+	defer fake.refsSinceMutex.RUnlock()
+	return len(fake.refsSinceArgsForCall)
+}
+
+func (fake *FakeRepository) RefsSinceCalls(stub func(string, string) ([]string, error)) {
+	fake.refsSinceMutex.Lock()
+	defer fake.refsSinceMutex.Unlock()
+	fake.RefsSinceStub = stub
+}
+
+func (fake *FakeRepository) RefsSinceArgsForCall(i int) (string, string) {
+	fake.refsSinceMutex.RLock()
+	defer fake.refsSinceMutex.RUnlock()
+	argsForCall := fake.refsSinceArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRepository) RefsSinceReturns(result1 []string, result2 error) {
+	fake.refsSinceMutex.Lock()
+	defer fake.refsSinceMutex.Unlock()
+	fake.RefsSinceStub = nil
+	fake.refsSinceReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) RefsSinceReturnsOnCall(i int, result1 []string, result2 error) {
+	fake.refsSinceMutex.Lock()
+	defer fake.refsSinceMutex.Unlock()
+	fake.RefsSinceStub = nil
+	if fake.refsSinceReturnsOnCall == nil {
+		fake.refsSinceReturnsOnCall = make(map[int]struct {
+			result1 []string
+			result2 error
+		})
+	}
+	fake.refsSinceReturnsOnCall[i] = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) Setup() error {
+	fake.setupMutex.Lock()
+	ret, specificReturn := fake.setupReturnsOnCall[len(fake.setupArgsForCall)]
+	fake.setupArgsForCall = append(fake.setupArgsForCall, struct {
+	}{})
+	stub := fake.SetupStub
+	fakeReturns := fake.setupReturns
+	fake.recordInvocation("Setup", []interface{}{})
+	fake.setupMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) SetupCallCount() int {
+	fake.setupMutex.RLock()
+	defer fake.setupMutex.RUnlock()
+	return len(fake.setupArgsForCall)
+}
+
+func (fake *FakeRepository) SetupCalls(stub func() error) {
+	fake.setupMutex.Lock()
+	defer fake.setupMutex.Unlock()
+	fake.SetupStub = stub
+}
+
+func (fake *FakeRepository) SetupReturns(result1 error) {
+	fake.setupMutex.Lock()
+	defer fake.setupMutex.Unlock()
+	fake.SetupStub = nil
+	fake.setupReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) SetupReturnsOnCall(i int, result1 error) {
+	fake.setupMutex.Lock()
+	defer fake.setupMutex.Unlock()
+	fake.SetupStub = nil
+	if fake.setupReturnsOnCall == nil {
+		fake.setupReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setupReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.latestRefMutex.RLock()
+	defer fake.latestRefMutex.RUnlock()
+	fake.refExistsMutex.RLock()
+	defer fake.refExistsMutex.RUnlock()
+	fake.refsSinceMutex.RLock()
+	defer fake.refsSinceMutex.RUnlock()
+	fake.setupMutex.RLock()
+	defer fake.setupMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeRepository) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ check.Repository = new(FakeRepository)
@@ -0,0 +1,108 @@
+package check
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ Repository = (*GitRepository)(nil)
+
+type GitRepository struct {
+	Source out.Source
+	Output io.Writer
+
+	dir string
+}
+
+func NewGitRepository(source out.Source, output io.Writer) *GitRepository {
+	return &GitRepository{
+		Source: source,
+		Output: output,
+		dir:    filepath.Join(os.TempDir(), "git-resource-repo-cache"),
+	}
+}
+
+func (gr *GitRepository) Setup() error {
+	_, err := os.Stat(gr.dir)
+	if err == nil {
+		_, err = gr.git("fetch")
+		if err != nil {
+			return err
+		}
+
+		_, err = gr.git("reset", "--hard", "FETCH_HEAD")
+		return err
+	}
+
+	args := []string{"clone", "--single-branch", "--branch", gr.Source.Branch}
+
+	// only the history is looked at, so a sparse clone needs nothing checked
+	// out beyond the files at the root of the repository
+	args = append(args, out.SparseCloneArgs(gr.Source)...)
+	args = append(args, gr.Source.URI, gr.dir)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = gr.Output
+	cmd.Stderr = gr.Output
+	return cmd.Run()
+}
+
+func (gr *GitRepository) RefExists(ref string) bool {
+	_, err := gr.git("cat-file", "-e", ref)
+	return err == nil
+}
+
+func (gr *GitRepository) LatestRef(path string) (string, error) {
+	refs, err := gr.log("-1", "--pretty=format:%H", "--", path, excludeQueue(path))
+	if err != nil {
+		return "", err
+	}
+
+	if len(refs) == 0 {
+		return "", nil
+	}
+
+	return refs[0], nil
+}
+
+func (gr *GitRepository) RefsSince(ref string, path string) ([]string, error) {
+	initCommit, err := gr.git("rev-list", "--max-parents=0", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	logRange := ref + "~1..HEAD"
+	if ref == strings.TrimSpace(initCommit) {
+		logRange = "HEAD"
+	}
+
+	return gr.log("--reverse", logRange, "--pretty=format:%H", "--", path, excludeQueue(path))
+}
+
+// excludeQueue leaves out the tickets of builds waiting in the fair queue of
+// a pool, which change while they wait without changing any lock.
+func excludeQueue(path string) string {
+	return ":(exclude)" + path + "/waiting"
+}
+
+func (gr *GitRepository) log(args ...string) ([]string, error) {
+	output, err := gr.git(append([]string{"log"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(output), nil
+}
+
+func (gr *GitRepository) git(args ...string) (string, error) {
+	arguments := append([]string{"-C", gr.dir}, args...)
+	cmd := exec.Command("git", arguments...)
+	cmd.Stderr = gr.Output
+	s, err := cmd.Output()
+	return string(s), err
+}
@@ -0,0 +1,78 @@
+package check
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ Repository = (*StoreRepository)(nil)
+
+// StoreRepository checks a pool kept outside of git, going by the log of
+// its latest changes.
+type StoreRepository struct {
+	Store  out.PoolStore
+	Output io.Writer
+
+	state out.PoolState
+}
+
+func NewStoreRepository(store out.PoolStore, output io.Writer) *StoreRepository {
+	return &StoreRepository{
+		Store:  store,
+		Output: output,
+	}
+}
+
+func (sr *StoreRepository) Setup() error {
+	state, err := sr.Store.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	sr.state = state
+	return nil
+}
+
+// RefExists is true for the revisions the log still goes back to.
+func (sr *StoreRepository) RefExists(ref string) bool {
+	revision, err := out.ParseRevision(ref)
+	if err != nil {
+		return false
+	}
+
+	return revision >= sr.state.FirstRevision() && revision <= sr.state.Revision
+}
+
+// LatestRef returns the revision that last changed the pool, or the oldest
+// revision the log goes back to if the change has since been forgotten. Like
+// a repository without a commit to the pool, a pool that was never changed
+// has no latest ref.
+func (sr *StoreRepository) LatestRef(path string) (string, error) {
+	change, found := sr.state.LastChange(sr.state.Revision, path, path+"/waiting")
+	if !found {
+		if !sr.state.ChangedSince(0, path) {
+			return "", nil
+		}
+
+		return strconv.FormatInt(sr.state.FirstRevision(), 10), nil
+	}
+
+	return strconv.FormatInt(change.Revision, 10), nil
+}
+
+func (sr *StoreRepository) RefsSince(ref string, path string) ([]string, error) {
+	revision, err := out.ParseRevision(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, change := range sr.state.ChangesSince(revision, path, path+"/waiting") {
+		refs = append(refs, strconv.FormatInt(change.Revision, 10))
+	}
+
+	return refs, nil
+}
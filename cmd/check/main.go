@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/concourse/pool-resource/check"
+)
+
+func main() {
+	var request check.CheckRequest
+	err := json.NewDecoder(os.Stdin).Decode(&request)
+	if err != nil {
+		fatal("reading request", err)
+	}
+	defer os.Stdin.Close()
+
+	errorMessages := request.Validate()
+	if len(errorMessages) > 0 {
+		for _, errorMessage := range errorMessages {
+			println(errorMessage)
+		}
+		os.Exit(1)
+	}
+
+	checker := check.NewChecker(request.Source, os.Stderr)
+
+	versions, err := checker.Check(request.Version)
+	if err != nil {
+		fatal("checking for new versions", err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(versions)
+	if err != nil {
+		fatal("encoding output", err)
+	}
+}
+
+func fatal(doing string, err error) {
+	println("error " + doing + ": " + err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/concourse/pool-resource/in"
+	"github.com/concourse/pool-resource/out"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		println("usage: " + os.Args[0] + " <path/to/destination>")
+		os.Exit(1)
+	}
+
+	destination := os.Args[1]
+
+	var request in.InRequest
+	err := json.NewDecoder(os.Stdin).Decode(&request)
+	if err != nil {
+		fatal("reading request", err)
+	}
+	defer os.Stdin.Close()
+
+	errorMessages := request.Validate()
+	if len(errorMessages) > 0 {
+		for _, errorMessage := range errorMessages {
+			println(errorMessage)
+		}
+		os.Exit(1)
+	}
+
+	lockFetcher := in.NewLockFetcher(request.Source, os.Stderr)
+
+	locks, version, err := lockFetcher.FetchLock(request.Version, request.Params, destination)
+	if err == in.ErrLockNoLongerAcquired {
+		println("error: " + err.Error())
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal("fetching lock", err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(in.InResponse{
+		Version: version,
+		Metadata: []out.MetadataPair{
+			{Name: "lock_name", Value: strings.Join(locks, ",")},
+			{Name: "pool_name", Value: request.Source.Pool},
+		},
+	})
+
+	if err != nil {
+		fatal("encoding output", err)
+	}
+}
+
+func fatal(doing string, err error) {
+	println("error " + doing + ": " + err.Error())
+	os.Exit(1)
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/concourse/pool-resource/out"
@@ -36,23 +43,58 @@ func main() {
 		request.Source.RetryDelay = 10 * time.Second
 	}
 
+	if request.Source.FairQueueTimeout == 0 {
+		request.Source.FairQueueTimeout = 5 * time.Minute
+	}
+
+	if request.Params.LeaseDuration != 0 {
+		request.Source.LeaseDuration = request.Params.LeaseDuration
+	}
+
 	lockPool := out.NewLockPool(request.Source, os.Stderr)
+	lockPool.Timeout = request.Params.Timeout
+
+	closePool = lockPool.Close
+	defer closePool()
+
+	ctx := abortOnSignal()
 
 	var (
-		lock    string
-		version out.Version
+		lock             string
+		version          out.Version
+		acquiredMetadata string
 	)
 
-	if request.Params.Acquire {
-		lock, version, err = lockPool.AcquireLock()
+	poolMetadata := request.Source.Pool
+
+	if request.Params.Acquire.Enabled {
+		var locks map[string][]string
+		locks, version, err = lockPool.AcquireLocks(ctx, request.Params.Acquire)
 		if err != nil {
 			fatal("acquiring lock", err)
 		}
+
+		lock, poolMetadata = lockMetadata(request.Source.Pool, request.Params.Acquire.Pools, locks)
+	}
+
+	if request.Params.TryAcquire.Enabled {
+		var (
+			locks    map[string][]string
+			acquired bool
+		)
+
+		locks, version, acquired, err = lockPool.TryAcquireLocks(ctx, request.Params.TryAcquire)
+		if err != nil {
+			fatal("trying to acquire lock", err)
+		}
+
+		lock, poolMetadata = lockMetadata(request.Source.Pool, request.Params.TryAcquire.Pools, locks)
+		acquiredMetadata = strconv.FormatBool(acquired)
 	}
 
 	if request.Params.Release != "" {
 		poolName := filepath.Join(sourceDir, request.Params.Release)
-		lock, version, err = lockPool.ReleaseLock(poolName)
+		lock, version, err = lockPool.ReleaseLock(ctx, poolName, request.Params.ForceRelease)
 		if err != nil {
 			fatal("releasing lock", err)
 		}
@@ -60,7 +102,7 @@ func main() {
 
 	if request.Params.Add != "" {
 		lockPath := filepath.Join(sourceDir, request.Params.Add)
-		lock, version, err = lockPool.AddUnclaimedLock(lockPath)
+		lock, version, err = lockPool.AddUnclaimedLock(ctx, lockPath)
 		if err != nil {
 			fatal("adding lock", err)
 		}
@@ -68,7 +110,7 @@ func main() {
 
 	if request.Params.AddClaimed != "" {
 		lockPath := filepath.Join(sourceDir, request.Params.AddClaimed)
-		lock, version, err = lockPool.AddClaimedLock(lockPath)
+		lock, version, err = lockPool.AddClaimedLock(ctx, lockPath)
 		if err != nil {
 			fatal("adding pre-claimed lock", err)
 		}
@@ -76,7 +118,7 @@ func main() {
 
 	if request.Params.Remove != "" {
 		removePath := filepath.Join(sourceDir, request.Params.Remove)
-		lock, version, err = lockPool.RemoveLock(removePath)
+		lock, version, err = lockPool.RemoveLock(ctx, removePath)
 		if err != nil {
 			fatal("removing lock", err)
 		}
@@ -84,7 +126,7 @@ func main() {
 
 	if request.Params.Claim != "" {
 		lock = request.Params.Claim
-		version, err = lockPool.ClaimLock(lock)
+		version, err = lockPool.ClaimLock(ctx, lock, request.Params.Mode)
 		if err != nil {
 			fatal("claiming lock", err)
 		}
@@ -92,7 +134,7 @@ func main() {
 
 	if request.Params.Update != "" {
 		lockPath := filepath.Join(sourceDir, request.Params.Update)
-		lock, version, err = lockPool.UpdateLock(lockPath)
+		lock, version, err = lockPool.UpdateLock(ctx, lockPath)
 		if err != nil {
 			fatal("updating lock", err)
 		}
@@ -100,7 +142,7 @@ func main() {
 
 	if request.Params.Check != "" {
 		lockPath := filepath.Join(sourceDir, request.Params.Check)
-		lock, version, err = lockPool.CheckLock(lockPath)
+		lock, version, err = lockPool.CheckLock(ctx, lockPath, request.Params.Mode)
 		if err != nil {
 			fatal("checking lock", err)
 		}
@@ -109,18 +151,36 @@ func main() {
 	if request.Params.CheckUnclaimed != "" {
 		lock = request.Params.CheckUnclaimed
 		lockPath := filepath.Join(sourceDir, request.Params.CheckUnclaimed)
-		lock, version, err = lockPool.CheckUnclaimedLock(lockPath)
+		lock, version, err = lockPool.CheckUnclaimedLock(ctx, lockPath)
 		if err != nil {
 			fatal("checking unclaimed lock", err)
 		}
 	}
 
+	if request.Params.Renew != "" {
+		lockPath := filepath.Join(sourceDir, request.Params.Renew)
+		lock, version, err = lockPool.RenewLock(ctx, lockPath)
+		if err != nil {
+			fatal("renewing lock", err)
+		}
+	}
+
+	metadata := []out.MetadataPair{
+		{Name: "lock_name", Value: lock},
+		{Name: "pool_name", Value: poolMetadata},
+	}
+
+	if acquiredMetadata != "" {
+		metadata = append(metadata, out.MetadataPair{Name: "acquired", Value: acquiredMetadata})
+	}
+
+	if request.Params.Acquire.Enabled || acquiredMetadata == "true" || request.Params.Claim != "" || request.Params.AddClaimed != "" {
+		metadata = append(metadata, out.OwnerFromEnv().MetadataPairs()...)
+	}
+
 	err = json.NewEncoder(os.Stdout).Encode(out.OutResponse{
-		Version: version,
-		Metadata: []out.MetadataPair{
-			{Name: "lock_name", Value: lock},
-			{Name: "pool_name", Value: request.Source.Pool},
-		},
+		Version:  version,
+		Metadata: metadata,
 	})
 
 	if err != nil {
@@ -128,7 +188,55 @@ func main() {
 	}
 }
 
+// lockMetadata lists the locks acquired from the pool of the source, or from
+// each of the given pools as <pool>/<lock>.
+func lockMetadata(sourcePool string, pools []string, locks map[string][]string) (string, string) {
+	if len(pools) == 0 {
+		return strings.Join(locks[sourcePool], ","), sourcePool
+	}
+
+	var names []string
+	for _, pool := range pools {
+		for _, name := range locks[pool] {
+			names = append(names, pool+"/"+name)
+		}
+	}
+
+	return strings.Join(names, ","), strings.Join(pools, ",")
+}
+
+// errAborted is the cause of the context once the build has been aborted.
+var errAborted = errors.New("aborted")
+
+// abortOnSignal returns a context that is canceled once Concourse aborts the
+// build, which it does by sending SIGTERM, or once interrupted.
+func abortOnSignal() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	go func() {
+		sig := <-signals
+		cancel(fmt.Errorf("%w by %s", errAborted, sig))
+	}()
+
+	return ctx
+}
+
+// closePool cleans up after the lock pool, once there is one, as exiting
+// skips deferred calls.
+var closePool = func() error { return nil }
+
 func fatal(doing string, err error) {
-	println("error " + doing + ": " + err.Error())
+	closePool()
+
+	// being aborted is not an error of the resource
+	if errors.Is(err, errAborted) {
+		println("stopped " + doing + ": " + err.Error())
+	} else {
+		println("error " + doing + ": " + err.Error())
+	}
+
 	os.Exit(1)
 }
@@ -0,0 +1,574 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"github.com/concourse/pool-resource/in"
+)
+
+type FakeRepository struct {
+	ChangedInRangeStub        func(string, string, string) (bool, error)
+	changedInRangeMutex       sync.RWMutex
+	changedInRangeArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	changedInRangeReturns struct {
+		result1 bool
+		result2 error
+	}
+	changedInRangeReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	CheckoutStub        func(string) error
+	checkoutMutex       sync.RWMutex
+	checkoutArgsForCall []struct {
+		arg1 string
+	}
+	checkoutReturns struct {
+		result1 error
+	}
+	checkoutReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CloneStub        func(string, int) error
+	cloneMutex       sync.RWMutex
+	cloneArgsForCall []struct {
+		arg1 string
+		arg2 int
+	}
+	cloneReturns struct {
+		result1 error
+	}
+	cloneReturnsOnCall map[int]struct {
+		result1 error
+	}
+	FileExistsStub        func(string, string) (bool, error)
+	fileExistsMutex       sync.RWMutex
+	fileExistsArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	fileExistsReturns struct {
+		result1 bool
+		result2 error
+	}
+	fileExistsReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	HeadRefStub        func() (string, error)
+	headRefMutex       sync.RWMutex
+	headRefArgsForCall []struct {
+	}
+	headRefReturns struct {
+		result1 string
+		result2 error
+	}
+	headRefReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	IncludeStub        func(...string) error
+	includeMutex       sync.RWMutex
+	includeArgsForCall []struct {
+		arg1 []string
+	}
+	includeReturns struct {
+		result1 error
+	}
+	includeReturnsOnCall map[int]struct {
+		result1 error
+	}
+	LastChangedFilesStub        func(string) ([]string, error)
+	lastChangedFilesMutex       sync.RWMutex
+	lastChangedFilesArgsForCall []struct {
+		arg1 string
+	}
+	lastChangedFilesReturns struct {
+		result1 []string
+		result2 error
+	}
+	lastChangedFilesReturnsOnCall map[int]struct {
+		result1 []string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeRepository) ChangedInRange(arg1 string, arg2 string, arg3 string) (bool, error) {
+	fake.changedInRangeMutex.Lock()
+	ret, specificReturn := fake.changedInRangeReturnsOnCall[len(fake.changedInRangeArgsForCall)]
+	fake.changedInRangeArgsForCall = append(fake.changedInRangeArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.ChangedInRangeStub
+	fakeReturns := fake.changedInRangeReturns
+	fake.recordInvocation("ChangedInRange", []interface{}{arg1, arg2, arg3})
+	fake.changedInRangeMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) ChangedInRangeCallCount() int {
+	fake.changedInRangeMutex.RLock()
+	defer fake.changedInRangeMutex.RUnlock()
+	return len(fake.changedInRangeArgsForCall)
+}
+
+func (fake *FakeRepository) ChangedInRangeCalls(stub func(string, string, string) (bool, error)) {
+	fake.changedInRangeMutex.Lock()
+	defer fake.changedInRangeMutex.Unlock()
+	fake.ChangedInRangeStub = stub
+}
+
+func (fake *FakeRepository) ChangedInRangeArgsForCall(i int) (string, string, string) {
+	fake.changedInRangeMutex.RLock()
+	defer fake.changedInRangeMutex.RUnlock()
+	argsForCall := fake.changedInRangeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeRepository) ChangedInRangeReturns(result1 bool, result2 error) {
+	fake.changedInRangeMutex.Lock()
+	defer fake.changedInRangeMutex.Unlock()
+	fake.ChangedInRangeStub = nil
+	fake.changedInRangeReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) ChangedInRangeReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.changedInRangeMutex.Lock()
+	defer fake.changedInRangeMutex.Unlock()
+	fake.ChangedInRangeStub = nil
+	if fake.changedInRangeReturnsOnCall == nil {
+		fake.changedInRangeReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.changedInRangeReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) Checkout(arg1 string) error {
+	fake.checkoutMutex.Lock()
+	ret, specificReturn := fake.checkoutReturnsOnCall[len(fake.checkoutArgsForCall)]
+	fake.checkoutArgsForCall = append(fake.checkoutArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.CheckoutStub
+	fakeReturns := fake.checkoutReturns
+	fake.recordInvocation("Checkout", []interface{}{arg1})
+	fake.checkoutMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) CheckoutCallCount() int {
+	fake.checkoutMutex.RLock()
+	defer fake.checkoutMutex.RUnlock()
+	return len(fake.checkoutArgsForCall)
+}
+
+func (fake *FakeRepository) CheckoutCalls(stub func(string) error) {
+	fake.checkoutMutex.Lock()
+	defer fake.checkoutMutex.Unlock()
+	fake.CheckoutStub = stub
+}
+
+func (fake *FakeRepository) CheckoutArgsForCall(i int) string {
+	fake.checkoutMutex.RLock()
+	defer fake.checkoutMutex.RUnlock()
+	argsForCall := fake.checkoutArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) CheckoutReturns(result1 error) {
+	fake.checkoutMutex.Lock()
+	defer fake.checkoutMutex.Unlock()
+	fake.CheckoutStub = nil
+	fake.checkoutReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) CheckoutReturnsOnCall(i int, result1 error) {
+	fake.checkoutMutex.Lock()
+	defer fake.checkoutMutex.Unlock()
+	fake.CheckoutStub = nil
+	if fake.checkoutReturnsOnCall == nil {
+		fake.checkoutReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.checkoutReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) Clone(arg1 string, arg2 int) error {
+	fake.cloneMutex.Lock()
+	ret, specificReturn := fake.cloneReturnsOnCall[len(fake.cloneArgsForCall)]
+	fake.cloneArgsForCall = append(fake.cloneArgsForCall, struct {
+		arg1 string
+		arg2 int
+	}{arg1, arg2})
+	stub := fake.CloneStub
+	fakeReturns := fake.cloneReturns
+	fake.recordInvocation("Clone", []interface{}{arg1, arg2})
+	fake.cloneMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) CloneCallCount() int {
+	fake.cloneMutex.RLock()
+	defer fake.cloneMutex.RUnlock()
+	return len(fake.cloneArgsForCall)
+}
+
+func (fake *FakeRepository) CloneCalls(stub func(string, int) error) {
+	fake.cloneMutex.Lock()
+	defer fake.cloneMutex.Unlock()
+	fake.CloneStub = stub
+}
+
+func (fake *FakeRepository) CloneArgsForCall(i int) (string, int) {
+	fake.cloneMutex.RLock()
+	defer fake.cloneMutex.RUnlock()
+	argsForCall := fake.cloneArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRepository) CloneReturns(result1 error) {
+	fake.cloneMutex.Lock()
+	defer fake.cloneMutex.Unlock()
+	fake.CloneStub = nil
+	fake.cloneReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) CloneReturnsOnCall(i int, result1 error) {
+	fake.cloneMutex.Lock()
+	defer fake.cloneMutex.Unlock()
+	fake.CloneStub = nil
+	if fake.cloneReturnsOnCall == nil {
+		fake.cloneReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.cloneReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) FileExists(arg1 string, arg2 string) (bool, error) {
+	fake.fileExistsMutex.Lock()
+	ret, specificReturn := fake.fileExistsReturnsOnCall[len(fake.fileExistsArgsForCall)]
+	fake.fileExistsArgsForCall = append(fake.fileExistsArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.FileExistsStub
+	fakeReturns := fake.fileExistsReturns
+	fake.recordInvocation("FileExists", []interface{}{arg1, arg2})
+	fake.fileExistsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) FileExistsCallCount() int {
+	fake.fileExistsMutex.RLock()
+	defer fake.fileExistsMutex.RUnlock()
+	return len(fake.fileExistsArgsForCall)
+}
+
+func (fake *FakeRepository) FileExistsCalls(stub func(string, string) (bool, error)) {
+	fake.fileExistsMutex.Lock()
+	defer fake.fileExistsMutex.Unlock()
+	fake.FileExistsStub = stub
+}
+
+func (fake *FakeRepository) FileExistsArgsForCall(i int) (string, string) {
+	fake.fileExistsMutex.RLock()
+	defer fake.fileExistsMutex.RUnlock()
+	argsForCall := fake.fileExistsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRepository) FileExistsReturns(result1 bool, result2 error) {
+	fake.fileExistsMutex.Lock()
+	defer fake.fileExistsMutex.Unlock()
+	fake.FileExistsStub = nil
+	fake.fileExistsReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) FileExistsReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.fileExistsMutex.Lock()
+	defer fake.fileExistsMutex.Unlock()
+	fake.FileExistsStub = nil
+	if fake.fileExistsReturnsOnCall == nil {
+		fake.fileExistsReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.fileExistsReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) HeadRef() (string, error) {
+	fake.headRefMutex.Lock()
+	ret, specificReturn := fake.headRefReturnsOnCall[len(fake.headRefArgsForCall)]
+	fake.headRefArgsForCall = append(fake.headRefArgsForCall, struct {
+	}{})
+	stub := fake.HeadRefStub
+	fakeReturns := fake.headRefReturns
+	fake.recordInvocation("HeadRef", []interface{}{})
+	fake.headRefMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) HeadRefCallCount() int {
+	fake.headRefMutex.RLock()
+	defer fake.headRefMutex.RUnlock()
+	return len(fake.headRefArgsForCall)
+}
+
+func (fake *FakeRepository) HeadRefCalls(stub func() (string, error)) {
+	fake.headRefMutex.Lock()
+	defer fake.headRefMutex.Unlock()
+	fake.HeadRefStub = stub
+}
+
+func (fake *FakeRepository) HeadRefReturns(result1 string, result2 error) {
+	fake.headRefMutex.Lock()
+	defer fake.headRefMutex.Unlock()
+	fake.HeadRefStub = nil
+	fake.headRefReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) HeadRefReturnsOnCall(i int, result1 string, result2 error) {
+	fake.headRefMutex.Lock()
+	defer fake.headRefMutex.Unlock()
+	fake.HeadRefStub = nil
+	if fake.headRefReturnsOnCall == nil {
+		fake.headRefReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.headRefReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) Include(arg1 ...string) error {
+	fake.includeMutex.Lock()
+	ret, specificReturn := fake.includeReturnsOnCall[len(fake.includeArgsForCall)]
+	fake.includeArgsForCall = append(fake.includeArgsForCall, struct {
+		arg1 []string
+	}{arg1})
+	stub := fake.IncludeStub
+	fakeReturns := fake.includeReturns
+	fake.recordInvocation("Include", []interface{}{arg1})
+	fake.includeMutex.Unlock()
+	if stub != nil {
+		return stub(arg1...)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRepository) IncludeCallCount() int {
+	fake.includeMutex.RLock()
+	defer fake.includeMutex.RUnlock()
+	return len(fake.includeArgsForCall)
+}
+
+func (fake *FakeRepository) IncludeCalls(stub func(...string) error) {
+	fake.includeMutex.Lock()
+	defer fake.includeMutex.Unlock()
+	fake.IncludeStub = stub
+}
+
+func (fake *FakeRepository) IncludeArgsForCall(i int) []string {
+	fake.includeMutex.RLock()
+	defer fake.includeMutex.RUnlock()
+	argsForCall := fake.includeArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) IncludeReturns(result1 error) {
+	fake.includeMutex.Lock()
+	defer fake.includeMutex.Unlock()
+	fake.IncludeStub = nil
+	fake.includeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) IncludeReturnsOnCall(i int, result1 error) {
+	fake.includeMutex.Lock()
+	defer fake.includeMutex.Unlock()
+	fake.IncludeStub = nil
+	if fake.includeReturnsOnCall == nil {
+		fake.includeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.includeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRepository) LastChangedFiles(arg1 string) ([]string, error) {
+	fake.lastChangedFilesMutex.Lock()
+	ret, specificReturn := fake.lastChangedFilesReturnsOnCall[len(fake.lastChangedFilesArgsForCall)]
+	fake.lastChangedFilesArgsForCall = append(fake.lastChangedFilesArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.LastChangedFilesStub
+	fakeReturns := fake.lastChangedFilesReturns
+	fake.recordInvocation("LastChangedFiles", []interface{}{arg1})
+	fake.lastChangedFilesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRepository) LastChangedFilesCallCount() int {
+	fake.lastChangedFilesMutex.RLock()
+	defer fake.lastChangedFilesMutex.RUnlock()
+	return len(fake.lastChangedFilesArgsForCall)
+}
+
+func (fake *FakeRepository) LastChangedFilesCalls(stub func(string) ([]string, error)) {
+	fake.lastChangedFilesMutex.Lock()
+	defer fake.lastChangedFilesMutex.Unlock()
+	fake.LastChangedFilesStub = stub
+}
+
+func (fake *FakeRepository) LastChangedFilesArgsForCall(i int) string {
+	fake.lastChangedFilesMutex.RLock()
+	defer fake.lastChangedFilesMutex.RUnlock()
+	argsForCall := fake.lastChangedFilesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRepository) LastChangedFilesReturns(result1 []string, result2 error) {
+	fake.lastChangedFilesMutex.Lock()
+	defer fake.lastChangedFilesMutex.Unlock()
+	fake.LastChangedFilesStub = nil
+	fake.lastChangedFilesReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) LastChangedFilesReturnsOnCall(i int, result1 []string, result2 error) {
+	fake.lastChangedFilesMutex.Lock()
+	defer fake.lastChangedFilesMutex.Unlock()
+	fake.LastChangedFilesStub = nil
+	if fake.lastChangedFilesReturnsOnCall == nil {
+		fake.lastChangedFilesReturnsOnCall = make(map[int]struct {
+			result1 []string
+			result2 error
+		})
+	}
+	fake.lastChangedFilesReturnsOnCall[i] = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeRepository) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.changedInRangeMutex.RLock()
+	defer fake.changedInRangeMutex.RUnlock()
+	fake.checkoutMutex.RLock()
+	defer fake.checkoutMutex.RUnlock()
+	fake.cloneMutex.RLock()
+	defer fake.cloneMutex.RUnlock()
+	fake.fileExistsMutex.RLock()
+	defer fake.fileExistsMutex.RUnlock()
+	fake.headRefMutex.RLock()
+	defer fake.headRefMutex.RUnlock()
+	fake.includeMutex.RLock()
+	defer fake.includeMutex.RUnlock()
+	fake.lastChangedFilesMutex.RLock()
+	defer fake.lastChangedFilesMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeRepository) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ in.Repository = new(FakeRepository)
@@ -0,0 +1,130 @@
+package in
+
+import (
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ Repository = (*GitRepository)(nil)
+
+type GitRepository struct {
+	Source out.Source
+	Output io.Writer
+
+	dir string
+}
+
+func NewGitRepository(source out.Source, output io.Writer) *GitRepository {
+	return &GitRepository{
+		Source: source,
+		Output: output,
+	}
+}
+
+func (gr *GitRepository) Clone(dir string, depth int) error {
+	gr.dir = dir
+
+	args := []string{"clone", "--single-branch"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	args = append(args, out.SparseCloneArgs(gr.Source)...)
+	args = append(args, gr.Source.URI, "--branch", gr.Source.Branch, dir)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = gr.Output
+	cmd.Stderr = gr.Output
+	err := cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	if !gr.Source.SparseClone {
+		return nil
+	}
+
+	_, err = gr.git("sparse-checkout", "set", "--cone", gr.Source.Pool)
+	return err
+}
+
+func (gr *GitRepository) Include(dirs ...string) error {
+	if !gr.Source.SparseClone {
+		return nil
+	}
+
+	_, err := gr.git(append([]string{"sparse-checkout", "add"}, dirs...)...)
+	return err
+}
+
+func (gr *GitRepository) Checkout(ref string) error {
+	_, err := gr.git("checkout", "-q", ref)
+	if err != nil {
+		return err
+	}
+
+	output, err := gr.git("log", "-1", "--oneline")
+	if err != nil {
+		return err
+	}
+	io.WriteString(gr.Output, output)
+
+	_, err = gr.git("clean", "--force", "--force", "-d")
+	return err
+}
+
+func (gr *GitRepository) LastChangedFiles(path string) ([]string, error) {
+	// queue tickets live alongside the locks but are not locks themselves.
+	// the whole commit is listed, as it may have claimed locks in other pools
+	// at the same time.
+	output, err := gr.git("log", "-1", "--full-diff", "--name-only", "--format=", "--", path, ":(exclude)"+path+"/waiting")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range strings.Split(strings.TrimSpace(output), "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+func (gr *GitRepository) ChangedInRange(path string, from string, to string) (bool, error) {
+	output, err := gr.git("log", "--oneline", from+".."+to, "--", path)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(output) != "", nil
+}
+
+func (gr *GitRepository) FileExists(path string, ref string) (bool, error) {
+	cmd := exec.Command("git", "-C", gr.dir, "cat-file", "-e", ref+":"+path)
+	err := cmd.Run()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (gr *GitRepository) HeadRef() (string, error) {
+	return gr.git("rev-parse", "HEAD")
+}
+
+func (gr *GitRepository) git(args ...string) (string, error) {
+	arguments := append([]string{"-C", gr.dir}, args...)
+	cmd := exec.Command("git", arguments...)
+	cmd.Stderr = gr.Output
+	s, err := cmd.Output()
+	return string(s), err
+}
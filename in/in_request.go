@@ -0,0 +1,17 @@
+package in
+
+import "github.com/concourse/pool-resource/out"
+
+type InRequest struct {
+	Source  out.Source  `json:"source"`
+	Version out.Version `json:"version"`
+	Params  InParams    `json:"params"`
+}
+
+type InParams struct {
+	Depth int `json:"depth"`
+}
+
+func (request InRequest) Validate() []string {
+	return request.Source.Validate()
+}
@@ -0,0 +1,8 @@
+package in
+
+import "github.com/concourse/pool-resource/out"
+
+type InResponse struct {
+	Version  out.Version        `json:"version"`
+	Metadata []out.MetadataPair `json:"metadata"`
+}
@@ -0,0 +1,13 @@
+package in_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestIn(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "In Suite")
+}
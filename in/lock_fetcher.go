@@ -0,0 +1,426 @@
+package in
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var ErrLockNoLongerAcquired = errors.New("lock instance is no longer acquired")
+
+type LockFetcher struct {
+	Source out.Source
+	Output io.Writer
+
+	Repository Repository
+}
+
+func NewLockFetcher(source out.Source, output io.Writer) LockFetcher {
+	lockFetcher := LockFetcher{
+		Source: source,
+		Output: output,
+	}
+
+	if store := out.NewPoolStore(source); store != nil {
+		lockFetcher.Repository = NewStoreRepository(store, output)
+	} else {
+		lockFetcher.Repository = NewGitRepository(source, output)
+	}
+
+	return lockFetcher
+}
+
+//go:generate go tool counterfeiter -generate
+
+//counterfeiter:generate -o ./fakes . Repository
+type Repository interface {
+	Clone(dir string, depth int) error
+	Include(dirs ...string) error
+	Checkout(ref string) error
+	LastChangedFiles(path string) (files []string, err error)
+	ChangedInRange(path string, from string, to string) (changed bool, err error)
+	FileExists(path string, ref string) (exists bool, err error)
+	HeadRef() (ref string, err error)
+}
+
+func (lf *LockFetcher) FetchLock(version out.Version, params InParams, destination string) ([]string, out.Version, error) {
+	ref := version.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	err := lf.Repository.Clone(destination, params.Depth)
+	if err != nil {
+		return nil, out.Version{}, fmt.Errorf("clone: %w", err)
+	}
+
+	err = lf.Repository.Checkout(ref)
+	if err != nil {
+		return nil, out.Version{}, fmt.Errorf("checkout: %w", err)
+	}
+
+	changedFilePaths, err := lf.Repository.LastChangedFiles(lf.Source.Pool)
+	if err != nil {
+		return nil, out.Version{}, fmt.Errorf("finding changed lock: %w", err)
+	}
+
+	otherPools := lf.otherPools(changedFilePaths)
+	if len(otherPools) > 0 {
+		err = lf.Repository.Include(otherPools...)
+		if err != nil {
+			return nil, out.Version{}, fmt.Errorf("checking out other pools: %w", err)
+		}
+	}
+
+	locks := lf.changedLocks(destination, changedFilePaths)
+
+	for _, lock := range locks {
+		err := lf.ensureStillAcquired(destination, lock, ref)
+		if err != nil {
+			return nil, out.Version{}, err
+		}
+	}
+
+	headRef, err := lf.Repository.HeadRef()
+	if err != nil {
+		return nil, out.Version{}, fmt.Errorf("rev-parse: %w", err)
+	}
+
+	fetchedVersion := out.Version{
+		Ref: strings.TrimSpace(headRef),
+	}
+
+	multiplePools := slices.ContainsFunc(locks, func(lock fetchedLock) bool {
+		return lock.pool != lf.Source.Pool
+	})
+
+	var lockNames []string
+	for _, lock := range locks {
+		if multiplePools {
+			lockNames = append(lockNames, lock.pool+"/"+lock.name)
+		} else {
+			lockNames = append(lockNames, lock.name)
+		}
+	}
+
+	if len(locks) <= 1 {
+		lock := fetchedLock{pool: lf.Source.Pool}
+		if len(locks) == 1 {
+			lock = locks[0]
+		}
+
+		err = lf.writeLock(destination, destination, lock, fetchedVersion)
+		if err != nil {
+			return nil, out.Version{}, err
+		}
+
+		return lockNames, fetchedVersion, nil
+	}
+
+	for i, lock := range locks {
+		lockDir := filepath.Join(destination, lockNames[i])
+
+		err = os.MkdirAll(lockDir, 0755)
+		if err != nil {
+			return nil, out.Version{}, fmt.Errorf("could not create the directory of your lock: %s", err)
+		}
+
+		err = lf.writeLock(destination, lockDir, lock, fetchedVersion)
+		if err != nil {
+			return nil, out.Version{}, err
+		}
+	}
+
+	return lockNames, fetchedVersion, nil
+}
+
+type fetchedLock struct {
+	pool string
+	name string
+
+	// claim is the id of the claim record the commit added to the lock
+	claim string
+}
+
+// changedLocks returns the locks changed by the last commit to the pool. A
+// commit acquiring several locks at once changes all of them, and may also
+// claim locks in other pools of the repository. Claiming a slot of a lock
+// with room for several holders only adds a claim record to it.
+func (lf *LockFetcher) changedLocks(destination string, changedFilePaths []string) []fetchedLock {
+	var locks []fetchedLock
+
+	for _, changedFilePath := range changedFilePaths {
+		lock, isLock := parseLockPath(changedFilePath)
+		if !isLock || strings.HasPrefix(lock.name, ".") || strings.HasPrefix(lock.claim, ".") {
+			continue
+		}
+
+		if lock.claim != "" {
+			_, err := os.Stat(filepath.Join(destination, changedFilePath))
+			if err != nil {
+				// the commit removed the claim rather than adding it
+				lock.claim = ""
+			}
+		}
+
+		if lock.pool != lf.Source.Pool {
+			claimedPath := filepath.Join(lock.pool, "claimed", lock.name)
+			if changedFilePath != claimedPath && lock.claim == "" {
+				continue
+			}
+
+			_, err := os.Stat(filepath.Join(destination, claimedPath))
+			if err != nil {
+				continue
+			}
+		}
+
+		index := slices.IndexFunc(locks, func(other fetchedLock) bool {
+			return other.pool == lock.pool && other.name == lock.name
+		})
+
+		if index == -1 {
+			locks = append(locks, lock)
+		} else if lock.claim != "" {
+			locks[index].claim = lock.claim
+		}
+	}
+
+	return locks
+}
+
+// otherPools lists the pools other than that of the source with locks among
+// the changed files, which a sparse clone has yet to check out.
+func (lf *LockFetcher) otherPools(changedFilePaths []string) []string {
+	var pools []string
+
+	for _, changedFilePath := range changedFilePaths {
+		lock, isLock := parseLockPath(changedFilePath)
+		if isLock && lock.pool != lf.Source.Pool && !slices.Contains(pools, lock.pool) {
+			pools = append(pools, lock.pool)
+		}
+	}
+
+	return pools
+}
+
+// parseLockPath finds the lock of a lock file, <pool>/claimed/<lock> or
+// <pool>/unclaimed/<lock>, or of a claim record, <pool>/claims/<lock>/<id>.
+// Any other file of a pool, such as a queue ticket, is not a lock.
+func parseLockPath(path string) (fetchedLock, bool) {
+	state := filepath.Base(filepath.Dir(path))
+	if state == "claimed" || state == "unclaimed" {
+		return fetchedLock{
+			pool: filepath.Dir(filepath.Dir(path)),
+			name: filepath.Base(path),
+		}, true
+	}
+
+	recordsDir := filepath.Dir(path)
+	if filepath.Base(filepath.Dir(recordsDir)) == "claims" {
+		return fetchedLock{
+			pool:  filepath.Dir(filepath.Dir(recordsDir)),
+			name:  filepath.Base(recordsDir),
+			claim: filepath.Base(path),
+		}, true
+	}
+
+	return fetchedLock{}, false
+}
+
+// ensureStillAcquired fails if a lock that is claimed at ref has been
+// unclaimed or reclaimed by someone else since.
+func (lf *LockFetcher) ensureStillAcquired(destination string, lock fetchedLock, ref string) error {
+	claimedPath := filepath.Join(lock.pool, "claimed", lock.name)
+
+	_, err := os.Stat(filepath.Join(destination, claimedPath))
+	if err != nil {
+		return nil
+	}
+
+	several, err := out.HeldBySeveral(destination, lock.pool, lock.name)
+	if err != nil {
+		return err
+	}
+
+	// the holders of a lock with room for several, or of a shared lock, come
+	// and go while it stays claimed, so only our own claim matters
+	if several && lock.claim != "" {
+		stillClaimed, err := lf.Repository.FileExists(filepath.Join(lock.pool, "claims", lock.name, lock.claim), lf.Source.Branch)
+		if err != nil {
+			return fmt.Errorf("checking claim records: %w", err)
+		}
+
+		if !stillClaimed {
+			return ErrLockNoLongerAcquired
+		}
+
+		return nil
+	}
+
+	changed, err := lf.Repository.ChangedInRange(claimedPath, ref, lf.Source.Branch)
+	if err != nil {
+		return fmt.Errorf("checking lock history: %w", err)
+	}
+
+	if changed {
+		return ErrLockNoLongerAcquired
+	}
+
+	// an expired lease can be reclaimed without the lock file moving, so
+	// also make sure our claim records have not been replaced
+	stillClaimed, err := lf.claimRecordsExist(destination, lock)
+	if err != nil {
+		return fmt.Errorf("checking claim records: %w", err)
+	}
+
+	if !stillClaimed {
+		return ErrLockNoLongerAcquired
+	}
+
+	return nil
+}
+
+// writeLock writes the name, metadata, ref and owner of a lock in the
+// repository cloned to destination into lockDir.
+func (lf *LockFetcher) writeLock(destination string, lockDir string, lock fetchedLock, fetchedVersion out.Version) error {
+	lockContents, found, err := lf.readLock(destination, lock)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		fmt.Fprintln(lf.Output, "lock does not exist")
+		return nil
+	}
+
+	err = os.WriteFile(filepath.Join(lockDir, "metadata"), lockContents, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write the metadata file of your lock: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(lockDir, "name"), []byte(lock.name+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write the name file of your lock: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(lockDir, "ref"), []byte(fetchedVersion.Ref+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write the ref file of your lock: %s", err)
+	}
+
+	if lock.claim != "" {
+		err = os.WriteFile(filepath.Join(lockDir, "claim"), []byte(lock.claim+"\n"), 0644)
+		if err != nil {
+			return fmt.Errorf("could not write the claim file of your lock: %s", err)
+		}
+	}
+
+	owner, found, err := lf.readClaimRecord(destination, lock)
+	if err != nil {
+		return err
+	}
+
+	if found {
+		err = os.WriteFile(filepath.Join(lockDir, "owner"), owner, 0644)
+		if err != nil {
+			return fmt.Errorf("could not write the owner file of your lock: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (lf *LockFetcher) claimRecordsExist(destination string, lock fetchedLock) (bool, error) {
+	recordsDir := filepath.Join(lock.pool, "claims", lock.name)
+
+	entries, err := os.ReadDir(filepath.Join(destination, recordsDir))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		exists, err := lf.Repository.FileExists(filepath.Join(recordsDir, entry.Name()), lf.Source.Branch)
+		if err != nil {
+			return false, err
+		}
+
+		if !exists {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// readClaimRecord returns the record of who holds the lock, if it is claimed
+// and the claim was recorded. That is the claim the lock was fetched with,
+// if it has one.
+func (lf *LockFetcher) readClaimRecord(destination string, lock fetchedLock) ([]byte, bool, error) {
+	_, err := os.Stat(filepath.Join(destination, lock.pool, "claimed", lock.name))
+	if err != nil {
+		return nil, false, nil
+	}
+
+	recordsDir := filepath.Join(destination, lock.pool, "claims", lock.name)
+
+	if lock.claim != "" {
+		contents, err := os.ReadFile(filepath.Join(recordsDir, lock.claim))
+		if err != nil {
+			return nil, false, fmt.Errorf("could not read the claim record of your lock: %s", err)
+		}
+
+		return contents, true, nil
+	}
+
+	entries, err := os.ReadDir(recordsDir)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read the claim records of your lock: %s", err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(recordsDir, entry.Name()))
+		if err != nil {
+			return nil, false, fmt.Errorf("could not read the claim record of your lock: %s", err)
+		}
+
+		return contents, true, nil
+	}
+
+	return nil, false, nil
+}
+
+func (lf *LockFetcher) readLock(destination string, lock fetchedLock) ([]byte, bool, error) {
+	if lock.name == "" {
+		return nil, false, nil
+	}
+
+	for _, claimedness := range []string{"claimed", "unclaimed"} {
+		contents, err := os.ReadFile(filepath.Join(destination, lock.pool, claimedness, lock.name))
+		if err == nil {
+			return contents, true, nil
+		}
+
+		if !os.IsNotExist(err) {
+			return nil, false, fmt.Errorf("could not read your lock: %s", err)
+		}
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,507 @@
+package in_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/concourse/pool-resource/in"
+	fakes "github.com/concourse/pool-resource/in/fakes"
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Lock Fetcher", func() {
+	var lockFetcher in.LockFetcher
+	var fakeRepository *fakes.FakeRepository
+	var output *gbytes.Buffer
+	var destination string
+
+	writeLock := func(claimedness string, name string, contents string) {
+		dir := filepath.Join(destination, "my-pool", claimedness)
+		err := os.MkdirAll(dir, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		destination, err = os.MkdirTemp("", "in-destination")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeRepository = new(fakes.FakeRepository)
+		fakeRepository.HeadRefReturns("some-ref\n", nil)
+
+		output = gbytes.NewBuffer()
+
+		lockFetcher = in.LockFetcher{
+			Source: out.Source{
+				URI:    "some-uri",
+				Pool:   "my-pool",
+				Branch: "some-branch",
+			},
+			Output:     output,
+			Repository: fakeRepository,
+		}
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(destination)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("clones into the destination with the requested depth", func() {
+		_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{Depth: 10}, destination)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeRepository.CloneCallCount()).Should(Equal(1))
+		dir, depth := fakeRepository.CloneArgsForCall(0)
+		Ω(dir).Should(Equal(destination))
+		Ω(depth).Should(Equal(10))
+	})
+
+	It("checks out the requested version", func() {
+		_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeRepository.CheckoutArgsForCall(0)).Should(Equal("some-ref"))
+	})
+
+	Context("when no version is given", func() {
+		It("checks out HEAD", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.CheckoutArgsForCall(0)).Should(Equal("HEAD"))
+		})
+	})
+
+	Context("when cloning fails", func() {
+		BeforeEach(func() {
+			fakeRepository.CloneReturns(errors.New("disaster"))
+		})
+
+		It("returns an error", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).Should(HaveOccurred())
+			Ω(fakeRepository.CheckoutCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when checking out the version fails", func() {
+		BeforeEach(func() {
+			fakeRepository.CheckoutReturns(errors.New("disaster"))
+		})
+
+		It("returns an error", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the version claimed a lock", func() {
+		BeforeEach(func() {
+			writeLock("claimed", "some-lock", `{"some":"json"}`)
+			fakeRepository.LastChangedFilesReturns([]string{"my-pool/claimed/some-lock"}, nil)
+		})
+
+		It("checks that the lock has not changed since the version", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.LastChangedFilesArgsForCall(0)).Should(Equal("my-pool"))
+
+			Ω(fakeRepository.ChangedInRangeCallCount()).Should(Equal(1))
+			path, from, to := fakeRepository.ChangedInRangeArgsForCall(0)
+			Ω(path).Should(Equal("my-pool/claimed/some-lock"))
+			Ω(from).Should(Equal("some-ref"))
+			Ω(to).Should(Equal("some-branch"))
+		})
+
+		Context("when the lock has not changed since", func() {
+			It("writes the name and metadata of the lock", func() {
+				lockNames, version, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(lockNames).Should(Equal([]string{"some-lock"}))
+				Ω(version).Should(Equal(out.Version{Ref: "some-ref"}))
+
+				name, err := os.ReadFile(filepath.Join(destination, "name"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(name)).Should(Equal("some-lock\n"))
+
+				metadata, err := os.ReadFile(filepath.Join(destination, "metadata"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(metadata).Should(MatchJSON(`{"some":"json"}`))
+
+				ref, err := os.ReadFile(filepath.Join(destination, "ref"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(ref)).Should(Equal("some-ref\n"))
+			})
+		})
+
+		Context("when the lock has been unclaimed or reclaimed since", func() {
+			BeforeEach(func() {
+				fakeRepository.ChangedInRangeReturns(true, nil)
+			})
+
+			It("refuses to fetch the lock", func() {
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).Should(Equal(in.ErrLockNoLongerAcquired))
+
+				Ω(filepath.Join(destination, "name")).ShouldNot(BeAnExistingFile())
+				Ω(filepath.Join(destination, "metadata")).ShouldNot(BeAnExistingFile())
+			})
+		})
+
+		Context("when the lock has claim records", func() {
+			BeforeEach(func() {
+				recordsDir := filepath.Join(destination, "my-pool", "claims", "some-lock")
+				err := os.MkdirAll(recordsDir, 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.WriteFile(filepath.Join(recordsDir, "some-claim"), []byte(`{"build_pipeline_name":"some-pipeline"}`), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the claim record as the owner of the lock", func() {
+				fakeRepository.FileExistsReturns(true, nil)
+
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				owner, err := os.ReadFile(filepath.Join(destination, "owner"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(owner).Should(MatchJSON(`{"build_pipeline_name":"some-pipeline"}`))
+			})
+
+			It("checks that the claim records still exist on the branch", func() {
+				fakeRepository.FileExistsReturns(true, nil)
+
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRepository.FileExistsCallCount()).Should(Equal(1))
+				path, ref := fakeRepository.FileExistsArgsForCall(0)
+				Ω(path).Should(Equal("my-pool/claims/some-lock/some-claim"))
+				Ω(ref).Should(Equal("some-branch"))
+			})
+
+			Context("when the lease has been reclaimed since", func() {
+				BeforeEach(func() {
+					fakeRepository.FileExistsReturns(false, nil)
+				})
+
+				It("refuses to fetch the lock", func() {
+					_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+					Ω(err).Should(Equal(in.ErrLockNoLongerAcquired))
+				})
+			})
+		})
+
+		Context("when checking the lock history fails", func() {
+			BeforeEach(func() {
+				fakeRepository.ChangedInRangeReturns(false, errors.New("disaster"))
+			})
+
+			It("returns an error", func() {
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).Should(HaveOccurred())
+				Ω(err).ShouldNot(Equal(in.ErrLockNoLongerAcquired))
+			})
+		})
+	})
+
+	It("only checks out the pool of the source if no other pool changed", func() {
+		writeLock("claimed", "some-lock", `{"some":"json"}`)
+		fakeRepository.LastChangedFilesReturns([]string{
+			"my-pool/claimed/some-lock",
+			"my-pool/unclaimed/some-lock",
+		}, nil)
+
+		_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeRepository.IncludeCallCount()).Should(Equal(0))
+	})
+
+	Context("when the version claimed several locks at once", func() {
+		BeforeEach(func() {
+			writeLock("claimed", "some-lock", `{"some":"json"}`)
+			writeLock("claimed", "some-other-lock", `{"other":"json"}`)
+			fakeRepository.LastChangedFilesReturns([]string{
+				"my-pool/claimed/some-lock",
+				"my-pool/claimed/some-other-lock",
+				"my-pool/unclaimed/some-lock",
+				"my-pool/unclaimed/some-other-lock",
+			}, nil)
+		})
+
+		It("checks that none of the locks have changed since the version", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.ChangedInRangeCallCount()).Should(Equal(2))
+			path, _, _ := fakeRepository.ChangedInRangeArgsForCall(0)
+			Ω(path).Should(Equal("my-pool/claimed/some-lock"))
+			path, _, _ = fakeRepository.ChangedInRangeArgsForCall(1)
+			Ω(path).Should(Equal("my-pool/claimed/some-other-lock"))
+		})
+
+		It("writes the name, metadata and ref of each lock into its own directory", func() {
+			lockNames, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lockNames).Should(Equal([]string{"some-lock", "some-other-lock"}))
+
+			name, err := os.ReadFile(filepath.Join(destination, "some-other-lock", "name"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(name)).Should(Equal("some-other-lock\n"))
+
+			metadata, err := os.ReadFile(filepath.Join(destination, "some-other-lock", "metadata"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metadata).Should(MatchJSON(`{"other":"json"}`))
+
+			ref, err := os.ReadFile(filepath.Join(destination, "some-lock", "ref"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(ref)).Should(Equal("some-ref\n"))
+
+			Ω(filepath.Join(destination, "name")).ShouldNot(BeAnExistingFile())
+		})
+
+		Context("when one of them has been unclaimed or reclaimed since", func() {
+			BeforeEach(func() {
+				fakeRepository.ChangedInRangeStub = func(path string, from string, to string) (bool, error) {
+					return path == "my-pool/claimed/some-other-lock", nil
+				}
+			})
+
+			It("refuses to fetch the locks", func() {
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).Should(Equal(in.ErrLockNoLongerAcquired))
+
+				Ω(filepath.Join(destination, "some-lock")).ShouldNot(BeADirectory())
+			})
+		})
+	})
+
+	Context("when the version claimed locks in several pools at once", func() {
+		BeforeEach(func() {
+			writeLock("claimed", "some-lock", `{"some":"json"}`)
+
+			otherPoolDir := filepath.Join(destination, "other-pool", "claimed")
+			err := os.MkdirAll(otherPoolDir, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(otherPoolDir, "other-lock"), []byte(`{"other":"json"}`), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeRepository.LastChangedFilesReturns([]string{
+				"my-pool/claimed/some-lock",
+				"my-pool/claims/some-lock/some-claim",
+				"my-pool/unclaimed/some-lock",
+				"other-pool/claimed/other-lock",
+				"other-pool/claims/other-lock/other-claim",
+				"other-pool/unclaimed/other-lock",
+			}, nil)
+		})
+
+		It("checks that none of the locks have changed since the version", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.ChangedInRangeCallCount()).Should(Equal(2))
+			path, _, _ := fakeRepository.ChangedInRangeArgsForCall(1)
+			Ω(path).Should(Equal("other-pool/claimed/other-lock"))
+		})
+
+		It("writes each lock into a directory named after its pool and name", func() {
+			lockNames, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lockNames).Should(Equal([]string{"my-pool/some-lock", "other-pool/other-lock"}))
+
+			name, err := os.ReadFile(filepath.Join(destination, "my-pool", "some-lock", "name"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(name)).Should(Equal("some-lock\n"))
+
+			metadata, err := os.ReadFile(filepath.Join(destination, "other-pool", "other-lock", "metadata"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metadata).Should(MatchJSON(`{"other":"json"}`))
+		})
+
+		It("makes sure the other pools are checked out", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.IncludeCallCount()).Should(Equal(1))
+			Ω(fakeRepository.IncludeArgsForCall(0)).Should(Equal([]string{"other-pool"}))
+		})
+
+		Context("when checking out the other pools fails", func() {
+			BeforeEach(func() {
+				fakeRepository.IncludeReturns(errors.New("some-error"))
+			})
+
+			It("returns an error", func() {
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).Should(MatchError(ContainSubstring("some-error")))
+			})
+		})
+	})
+
+	Context("when the version claimed a slot of a lock with room for several holders", func() {
+		BeforeEach(func() {
+			writeLock("claimed", "some-lock", `{"some":"json"}`)
+
+			capacityDir := filepath.Join(destination, "my-pool", "capacity")
+			err := os.MkdirAll(capacityDir, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(capacityDir, "some-lock"), []byte("3\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recordsDir := filepath.Join(destination, "my-pool", "claims", "some-lock")
+			err = os.MkdirAll(recordsDir, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, claim := range []string{"other-claim", "our-claim"} {
+				err = os.WriteFile(filepath.Join(recordsDir, claim), []byte(`{"build_name":"`+claim+`"}`), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			// only the claim record is added when the lock is already claimed
+			fakeRepository.LastChangedFilesReturns([]string{"my-pool/claims/some-lock/our-claim"}, nil)
+			fakeRepository.FileExistsReturns(true, nil)
+		})
+
+		It("writes the lock along with our claim on it", func() {
+			lockNames, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lockNames).Should(Equal([]string{"some-lock"}))
+
+			claim, err := os.ReadFile(filepath.Join(destination, "claim"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(claim)).Should(Equal("our-claim\n"))
+
+			owner, err := os.ReadFile(filepath.Join(destination, "owner"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(owner).Should(MatchJSON(`{"build_name":"our-claim"}`))
+		})
+
+		It("only checks that our claim still exists on the branch", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.ChangedInRangeCallCount()).Should(Equal(0))
+			Ω(fakeRepository.FileExistsCallCount()).Should(Equal(1))
+			path, _ := fakeRepository.FileExistsArgsForCall(0)
+			Ω(path).Should(Equal("my-pool/claims/some-lock/our-claim"))
+		})
+
+		Context("when our claim has been released since", func() {
+			BeforeEach(func() {
+				fakeRepository.FileExistsReturns(false, nil)
+			})
+
+			It("refuses to fetch the lock", func() {
+				_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+				Ω(err).Should(Equal(in.ErrLockNoLongerAcquired))
+			})
+		})
+	})
+
+	Context("when the version joined the shared holders of a lock", func() {
+		BeforeEach(func() {
+			writeLock("claimed", "some-lock", `{"some":"json"}`)
+
+			sharedDir := filepath.Join(destination, "my-pool", "shared")
+			err := os.MkdirAll(sharedDir, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(sharedDir, "some-lock"), nil, 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			recordsDir := filepath.Join(destination, "my-pool", "claims", "some-lock")
+			err = os.MkdirAll(recordsDir, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(recordsDir, "our-claim"), []byte(`{"build_name":"our-claim"}`), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeRepository.LastChangedFilesReturns([]string{"my-pool/claims/some-lock/our-claim"}, nil)
+			fakeRepository.FileExistsReturns(true, nil)
+		})
+
+		It("only checks that our claim still exists on the branch", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			claim, err := os.ReadFile(filepath.Join(destination, "claim"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(claim)).Should(Equal("our-claim\n"))
+
+			Ω(fakeRepository.ChangedInRangeCallCount()).Should(Equal(0))
+			Ω(fakeRepository.FileExistsCallCount()).Should(Equal(1))
+		})
+	})
+
+	Context("when the claim on a lock was not recorded", func() {
+		BeforeEach(func() {
+			writeLock("claimed", "some-lock", `{"some":"json"}`)
+			fakeRepository.LastChangedFilesReturns([]string{"my-pool/claimed/some-lock"}, nil)
+		})
+
+		It("does not write an owner file", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(filepath.Join(destination, "owner")).ShouldNot(BeAnExistingFile())
+		})
+	})
+
+	Context("when the version unclaimed a lock", func() {
+		BeforeEach(func() {
+			writeLock("unclaimed", "some-lock", `{"some":"json"}`)
+			fakeRepository.LastChangedFilesReturns([]string{"my-pool/unclaimed/some-lock"}, nil)
+		})
+
+		It("does not check the lock history", func() {
+			_, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRepository.ChangedInRangeCallCount()).Should(Equal(0))
+		})
+
+		It("writes the name and metadata of the lock", func() {
+			lockNames, _, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lockNames).Should(Equal([]string{"some-lock"}))
+
+			metadata, err := os.ReadFile(filepath.Join(destination, "metadata"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(metadata).Should(MatchJSON(`{"some":"json"}`))
+		})
+	})
+
+	Context("when the version removed a lock", func() {
+		BeforeEach(func() {
+			fakeRepository.LastChangedFilesReturns([]string{"my-pool/claimed/some-lock"}, nil)
+		})
+
+		It("returns the lock name without writing any files", func() {
+			lockNames, version, err := lockFetcher.FetchLock(out.Version{Ref: "some-ref"}, in.InParams{}, destination)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(lockNames).Should(Equal([]string{"some-lock"}))
+			Ω(version).Should(Equal(out.Version{Ref: "some-ref"}))
+			Ω(output).Should(gbytes.Say("lock does not exist"))
+
+			Ω(filepath.Join(destination, "name")).ShouldNot(BeAnExistingFile())
+			Ω(filepath.Join(destination, "metadata")).ShouldNot(BeAnExistingFile())
+		})
+	})
+})
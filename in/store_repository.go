@@ -0,0 +1,124 @@
+package in
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ Repository = (*StoreRepository)(nil)
+
+// StoreRepository fetches a pool kept outside of git. Only the latest
+// contents of its files are kept, so a lock is fetched with its contents as
+// they are now, even if it changed since the version being fetched.
+type StoreRepository struct {
+	Store  out.PoolStore
+	Output io.Writer
+
+	dir      string
+	state    out.PoolState
+	revision int64
+}
+
+func NewStoreRepository(store out.PoolStore, output io.Writer) *StoreRepository {
+	return &StoreRepository{
+		Store:  store,
+		Output: output,
+	}
+}
+
+// Clone loads the state of the pool, whose files are written once the
+// version to fetch is checked out. There is no history to leave out, so the
+// depth does not matter.
+func (sr *StoreRepository) Clone(dir string, depth int) error {
+	sr.dir = dir
+
+	state, err := sr.Store.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	sr.state = state
+	sr.revision = state.Revision
+
+	return nil
+}
+
+func (sr *StoreRepository) Include(dirs ...string) error {
+	return nil
+}
+
+// Checkout writes the files the pool had at the revision.
+func (sr *StoreRepository) Checkout(ref string) error {
+	revision := sr.state.Revision
+	if ref != "HEAD" {
+		var err error
+		revision, err = out.ParseRevision(ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	if revision > sr.state.Revision {
+		return fmt.Errorf("unknown revision: %d", revision)
+	}
+
+	for path, contents := range sr.state.At(revision) {
+		fullPath := filepath.Join(sr.dir, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(fullPath, []byte(contents), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	sr.revision = revision
+
+	change, found := sr.state.ChangeAt(revision)
+	if found {
+		fmt.Fprintf(sr.Output, "%d %s\n", change.Revision, change.Message)
+	}
+
+	return nil
+}
+
+func (sr *StoreRepository) LastChangedFiles(path string) ([]string, error) {
+	// queue tickets live alongside the locks but are not locks themselves
+	change, found := sr.state.LastChange(sr.revision, path, path+"/waiting")
+	if !found {
+		return nil, nil
+	}
+
+	return change.Paths, nil
+}
+
+// ChangedInRange looks at the changes after from up to the latest revision,
+// which is the only one a pool kept outside of git has to compare with.
+func (sr *StoreRepository) ChangedInRange(path string, from string, to string) (bool, error) {
+	revision, err := out.ParseRevision(from)
+	if err != nil {
+		return false, err
+	}
+
+	return sr.state.ChangedSince(revision, filepath.ToSlash(path)), nil
+}
+
+// FileExists is true if the file is there at the latest revision.
+func (sr *StoreRepository) FileExists(path string, ref string) (bool, error) {
+	_, found := sr.state.Files[filepath.ToSlash(path)]
+	return found, nil
+}
+
+func (sr *StoreRepository) HeadRef() (string, error) {
+	return strconv.FormatInt(sr.revision, 10), nil
+}
@@ -0,0 +1,169 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Filesystem backend", func() {
+	var (
+		poolDir   string
+		sourceDir string
+		source    out.Source
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		poolDir, err = os.MkdirTemp("", "pool-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		sourceDir, err = os.MkdirTemp("", "source-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		setup := exec.Command("bash", "-e", "-c", `
+			mkdir -p lock-pool/unclaimed lock-pool/claimed
+			touch lock-pool/unclaimed/.gitkeep lock-pool/claimed/.gitkeep
+
+			echo '{"some":"json"}' > lock-pool/unclaimed/some-lock
+			echo '{"some":"other-json"}' > lock-pool/unclaimed/some-other-lock
+		`)
+		setup.Dir = poolDir
+		setup.Stdout = GinkgoWriter
+		setup.Stderr = GinkgoWriter
+
+		err = setup.Run()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		source = out.Source{
+			Backend:    "filesystem",
+			Path:       poolDir,
+			Pool:       "lock-pool",
+			RetryDelay: 100 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		for _, dir := range []string{poolDir, sourceDir} {
+			err := os.RemoveAll(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	})
+
+	put := func(params out.OutParams) *gexec.Session {
+		return runOut(out.OutRequest{Source: source, Params: params}, sourceDir)
+	}
+
+	acquire := func() out.OutResponse {
+		session := put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+		<-session.Exited
+		Expect(session.ExitCode()).To(Equal(0))
+
+		var response out.OutResponse
+		err := json.Unmarshal(session.Out.Contents(), &response)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return response
+	}
+
+	sourceJSON := func() string {
+		return fmt.Sprintf(`{"backend": "filesystem", "path": %q, "pool": "lock-pool"}`, poolDir)
+	}
+
+	get := func(version out.Version, destination string) {
+		runIn(fmt.Sprintf(`{"source": %s, "version": {"ref": %q}}`, sourceJSON(), version.Ref), destination, 0)
+	}
+
+	locksIn := func(claimedness string) []string {
+		entries, err := os.ReadDir(filepath.Join(poolDir, "lock-pool", claimedness))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var locks []string
+		for _, entry := range entries {
+			if entry.Name() != ".gitkeep" {
+				locks = append(locks, entry.Name())
+			}
+		}
+
+		return locks
+	}
+
+	It("acquires a lock, fetches it, and releases it again", func() {
+		response := acquire()
+		Ω(response.Version).Should(Equal(out.Version{Ref: "1"}))
+
+		lock := response.Metadata[0].Value
+		Ω(locksIn("claimed")).Should(ConsistOf(lock))
+
+		destination := filepath.Join(sourceDir, "lock-step")
+		get(response.Version, destination)
+
+		name, err := os.ReadFile(filepath.Join(destination, "name"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(name)).Should(Equal(lock + "\n"))
+
+		Ω(filepath.Join(destination, "metadata")).Should(BeAnExistingFile())
+
+		session := put(out.OutParams{Release: "lock-step"})
+		<-session.Exited
+		Expect(session.ExitCode()).To(Equal(0))
+
+		Ω(locksIn("claimed")).Should(BeEmpty())
+		Ω(locksIn("unclaimed")).Should(ConsistOf("some-lock", "some-other-lock"))
+	})
+
+	It("hands each lock out once, and has others wait for one to be released", func() {
+		first := put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+		second := put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+
+		<-first.Exited
+		<-second.Exited
+		Expect(first.ExitCode()).To(Equal(0))
+		Expect(second.ExitCode()).To(Equal(0))
+
+		Ω(locksIn("claimed")).Should(ConsistOf("some-lock", "some-other-lock"))
+
+		waiting := put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+		Consistently(waiting.Exited, time.Second).ShouldNot(BeClosed())
+
+		// release a lock by hand, as a pool kept on the filesystem allows
+		err := os.Rename(
+			filepath.Join(poolDir, "lock-pool", "claimed", "some-lock"),
+			filepath.Join(poolDir, "lock-pool", "unclaimed", "some-lock"),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(waiting.Exited, 5*time.Second).Should(BeClosed())
+		Expect(waiting.ExitCode()).To(Equal(0))
+
+		Ω(locksIn("unclaimed")).Should(BeEmpty())
+	})
+
+	It("checks for new versions of the pool", func() {
+		session := runCheck(fmt.Sprintf(`{"source": %s}`, sourceJSON()))
+
+		var versions []out.Version
+		err := json.Unmarshal(session.Out.Contents(), &versions)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(versions).Should(BeEmpty())
+
+		acquire()
+		acquire()
+
+		session = runCheck(fmt.Sprintf(`{"source": %s, "version": {"ref": "1"}}`, sourceJSON()))
+
+		err = json.Unmarshal(session.Out.Contents(), &versions)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(versions).Should(Equal([]out.Version{{Ref: "1"}, {Ref: "2"}}))
+	})
+})
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/concourse/pool-resource/out"
@@ -22,8 +21,21 @@ func TestIntegration(t *testing.T) {
 
 var outPath string
 var inPath string
+var checkPath string
+
+// gitEngine runs every put with the given git_engine, e.g. go-git, unless the
+// request configures one itself.
+var gitEngine = os.Getenv("GIT_ENGINE")
+
+// outTempDir is where puts clone repositories to, and cache them.
+var outTempDir string
 
 var _ = BeforeSuite(func() {
+	var err error
+
+	outTempDir, err = os.MkdirTemp("", "out-temp-dir")
+	Ω(err).ShouldNot(HaveOccurred())
+
 	if _, err := os.Stat("/opt/go/out"); err == nil {
 		outPath = "/opt/go/out"
 	} else {
@@ -31,15 +43,26 @@ var _ = BeforeSuite(func() {
 		Ω(err).ShouldNot(HaveOccurred())
 	}
 
-	if _, err := os.Stat("/opt/resource/in"); err == nil {
-		inPath = "/opt/resource/in"
+	if _, err := os.Stat("/opt/go/in"); err == nil {
+		inPath = "/opt/go/in"
+	} else {
+		inPath, err = gexec.Build("github.com/concourse/pool-resource/cmd/in")
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	if _, err := os.Stat("/opt/go/check"); err == nil {
+		checkPath = "/opt/go/check"
 	} else {
-		pwd, err := os.Getwd()
+		checkPath, err = gexec.Build("github.com/concourse/pool-resource/cmd/check")
 		Ω(err).ShouldNot(HaveOccurred())
-		inPath = filepath.Join(pwd, "../assets/in")
 	}
 })
 
+var _ = AfterSuite(func() {
+	err := os.RemoveAll(outTempDir)
+	Ω(err).ShouldNot(HaveOccurred())
+})
+
 type version struct {
 	Ref string `json:"ref"`
 }
@@ -74,13 +97,42 @@ func runIn(inJson string, destination string, expectedExitCode int) *gexec.Sessi
 	return session
 }
 
+func runCheck(checkJson string, env ...string) *gexec.Session {
+	checkCmd := exec.Command(checkPath)
+	checkCmd.Env = append(os.Environ(), env...)
+
+	stdin, err := checkCmd.StdinPipe()
+	Ω(err).ShouldNot(HaveOccurred())
+
+	session, err := gexec.Start(checkCmd, GinkgoWriter, GinkgoWriter)
+	Ω(err).ShouldNot(HaveOccurred())
+
+	stdin.Write([]byte(checkJson))
+	stdin.Close()
+
+	<-session.Exited
+	Expect(session.ExitCode()).To(Equal(0))
+
+	return session
+}
+
 func runOut(request out.OutRequest, sourceDir string) *gexec.Session {
+	return runOutWithEnv(request, sourceDir)
+}
+
+func runOutWithEnv(request out.OutRequest, sourceDir string, env ...string) *gexec.Session {
+	if request.Source.GitEngine == "" && request.Source.UsesGit() {
+		request.Source.GitEngine = gitEngine
+	}
+
 	outCmd := exec.Command(outPath, sourceDir)
 
 	outCmd.Env = append(
 		os.Environ(),
 		"BUILD_URL=http://example.com/teams/team-name/pipelines/pipeline-name/jobs/job-name/builds/6543",
+		"TMPDIR="+outTempDir,
 	)
+	outCmd.Env = append(outCmd.Env, env...)
 
 	stdin, err := outCmd.StdinPipe()
 	Ω(err).ShouldNot(HaveOccurred())
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -77,7 +78,7 @@ func itWorksWithBranch(branchName string) {
 						RetryDelay: 100 * time.Millisecond,
 					},
 					Params: out.OutParams{
-						Acquire: true,
+						Acquire: out.AcquireParams{Enabled: true},
 					},
 				}
 			})
@@ -132,7 +133,7 @@ func itWorksWithBranch(branchName string) {
 				It("complains about it", func() {
 					errorMessages := string(session.Err.Contents())
 
-					Ω(errorMessages).Should(ContainSubstring("invalid payload (missing acquire, release, remove, claim, add, add_claimed, update, check, or check_unclaimed"))
+					Ω(errorMessages).Should(ContainSubstring("invalid payload (missing acquire, try_acquire, release, remove, claim, add, add_claimed, update, check, check_unclaimed, or renew)"))
 				})
 			})
 		})
@@ -147,7 +148,7 @@ func itWorksWithBranch(branchName string) {
 						RetryDelay: 100 * time.Millisecond,
 					},
 					Params: out.OutParams{
-						Acquire: true,
+						Acquire: out.AcquireParams{Enabled: true},
 					},
 				}
 
@@ -206,6 +207,428 @@ func itWorksWithBranch(branchName string) {
 				Ω(session).Should(gbytes.Say("claiming: " + outResponse.Metadata[0].Value))
 				Ω(session).Should(gbytes.Say("Build URL: http://example.com/teams/team-name/pipelines/pipeline-name/jobs/job-name/builds/6543"))
 			})
+
+			It("leaves nothing behind but the cached clone of the repository", func() {
+				tempDir, err := os.MkdirTemp("", "temp-dir")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer os.RemoveAll(tempDir)
+
+				session := runOutWithEnv(outRequest, sourceDir, "TMPDIR="+tempDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				leftovers, err := os.ReadDir(tempDir)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(leftovers).Should(HaveLen(1))
+				Ω(leftovers[0].Name()).Should(Equal("pool-resource-repo-cache"))
+			})
+
+			Context("when acquiring another lock", func() {
+				BeforeEach(func() {
+					session := runOut(outRequest, sourceDir)
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+
+					err := json.Unmarshal(session.Out.Contents(), &outResponse)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("claims it from the cached clone, brought up to date", func() {
+					claimed, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "--name-only", branchName, "lock-pool/claimed/").Output()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(strings.Fields(string(claimed))).Should(ConsistOf(
+						"lock-pool/claimed/.gitkeep",
+						"lock-pool/claimed/some-lock",
+						"lock-pool/claimed/some-other-lock",
+					))
+				})
+			})
+		})
+
+		Context("when acquiring several locks at once", func() {
+			BeforeEach(func() {
+				outRequest = out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Acquire: out.AcquireParams{Enabled: true, Count: 2},
+					},
+				}
+
+				session := runOut(outRequest, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				err := json.Unmarshal(session.Out.Contents(), &outResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("claims all of them in a single commit", func() {
+				Ω(outResponse.Version).Should(Equal(getVersion(bareGitRepo, "origin/"+branchName)))
+				Ω(strings.Split(outResponse.Metadata[0].Value, ",")).Should(ConsistOf("some-lock", "some-other-lock"))
+
+				log := exec.Command("git", "log", "-1", "--name-only", "--format=%s", outResponse.Version.Ref)
+				log.Dir = bareGitRepo
+				logOutput, err := log.Output()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(string(logOutput)).Should(ContainSubstring("claiming: " + strings.ReplaceAll(outResponse.Metadata[0].Value, ",", ", ")))
+				Ω(string(logOutput)).Should(ContainSubstring("lock-pool/claimed/some-lock"))
+				Ω(string(logOutput)).Should(ContainSubstring("lock-pool/claimed/some-other-lock"))
+			})
+
+			Context("when fetching and releasing them", func() {
+				var locksDir string
+
+				BeforeEach(func() {
+					var err error
+					locksDir, err = os.MkdirTemp("", "my-locks")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					jsonIn := fmt.Sprintf(`
+					{
+						"source": {
+							"uri": "%s",
+							"branch": "%s",
+							"pool": "lock-pool"
+						},
+						"version": {
+							"ref": "%s"
+						}
+					}`, bareGitRepo, branchName, outResponse.Version.Ref)
+
+					runIn(jsonIn, filepath.Join(locksDir, "envs"), 0)
+				})
+
+				AfterEach(func() {
+					err := os.RemoveAll(locksDir)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("fetches each lock into its own directory", func() {
+					metadata, err := os.ReadFile(filepath.Join(locksDir, "envs", "some-other-lock", "metadata"))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(metadata)).Should(Equal("{\"some\":\"wrong-json\"}\n"))
+
+					name, err := os.ReadFile(filepath.Join(locksDir, "envs", "some-lock", "name"))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(name)).Should(Equal("some-lock\n"))
+				})
+
+				It("releases all of them in a single push", func() {
+					session := runOut(out.OutRequest{
+						Source: outRequest.Source,
+						Params: out.OutParams{
+							Release: "envs",
+						},
+					}, locksDir)
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+
+					var releaseResponse out.OutResponse
+					err := json.Unmarshal(session.Out.Contents(), &releaseResponse)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					log := exec.Command("git", "log", "--format=%s", outResponse.Version.Ref+".."+releaseResponse.Version.Ref)
+					log.Dir = bareGitRepo
+					logOutput, err := log.Output()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					commits := strings.Split(strings.TrimSpace(string(logOutput)), "\n")
+					Ω(commits).Should(HaveLen(2))
+					Ω(commits[0]).Should(HavePrefix("unclaiming: some-other-lock"))
+					Ω(commits[1]).Should(HavePrefix("unclaiming: some-lock"))
+				})
+			})
+		})
+
+		Context("when acquiring locks from several pools at once", func() {
+			var otherPoolDir string
+			var session *gexec.Session
+
+			BeforeEach(func() {
+				var err error
+
+				otherPoolDir, err = os.MkdirTemp("", "other-pool")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				addOtherPool := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+					git clone --branch %s %s .
+
+					git config user.email "ginkgo@localhost"
+					git config user.name "Ginkgo Local"
+
+					mkdir -p other-pool/unclaimed other-pool/claimed
+					touch other-pool/unclaimed/.gitkeep other-pool/claimed/.gitkeep
+					echo '{"other":"json"}' > other-pool/unclaimed/other-lock
+
+					git add other-pool
+					git commit -m "adding other-pool"
+					git push
+				`, branchName, bareGitRepo))
+
+				addOtherPool.Stdout = GinkgoWriter
+				addOtherPool.Stderr = GinkgoWriter
+				addOtherPool.Dir = otherPoolDir
+
+				err = addOtherPool.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				outRequest = out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Acquire: out.AcquireParams{Enabled: true, Pools: []string{"lock-pool", "other-pool"}},
+					},
+				}
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(otherPoolDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			Context("when every pool has a lock available", func() {
+				BeforeEach(func() {
+					session = runOut(outRequest, sourceDir)
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+
+					err := json.Unmarshal(session.Out.Contents(), &outResponse)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("claims a lock from each pool in a single commit", func() {
+					Ω(outResponse.Metadata[0].Value).Should(MatchRegexp(`^lock-pool/some(-other)?-lock,other-pool/other-lock$`))
+					Ω(outResponse.Metadata[1]).Should(Equal(out.MetadataPair{Name: "pool_name", Value: "lock-pool,other-pool"}))
+
+					log := exec.Command("git", "log", "-1", "--name-only", "--format=%s", outResponse.Version.Ref)
+					log.Dir = bareGitRepo
+					logOutput, err := log.Output()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(string(logOutput)).Should(ContainSubstring("claiming: " + strings.ReplaceAll(outResponse.Metadata[0].Value, ",", ", ")))
+					Ω(string(logOutput)).Should(ContainSubstring("other-pool/claimed/other-lock"))
+					Ω(string(logOutput)).Should(MatchRegexp(`lock-pool/claimed/some(-other)?-lock`))
+				})
+
+				It("fetches each lock into a directory named after its pool", func() {
+					locksDir, err := os.MkdirTemp("", "my-locks")
+					Ω(err).ShouldNot(HaveOccurred())
+					defer os.RemoveAll(locksDir)
+
+					jsonIn := fmt.Sprintf(`
+					{
+						"source": {
+							"uri": "%s",
+							"branch": "%s",
+							"pool": "other-pool"
+						},
+						"version": {
+							"ref": "%s"
+						}
+					}`, bareGitRepo, branchName, outResponse.Version.Ref)
+
+					runIn(jsonIn, filepath.Join(locksDir, "envs"), 0)
+
+					metadata, err := os.ReadFile(filepath.Join(locksDir, "envs", "other-pool", "other-lock", "metadata"))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(metadata)).Should(Equal("{\"other\":\"json\"}\n"))
+
+					releaseOther := runOut(out.OutRequest{
+						Source: out.Source{
+							URI:    bareGitRepo,
+							Branch: branchName,
+							Pool:   "other-pool",
+						},
+						Params: out.OutParams{
+							Release: "envs/other-pool/other-lock",
+						},
+					}, locksDir)
+					<-releaseOther.Exited
+					Expect(releaseOther.ExitCode()).To(Equal(0))
+				})
+			})
+
+			Context("when one of the pools has no lock available", func() {
+				BeforeEach(func() {
+					claimOtherLock := exec.Command("bash", "-e", "-c", `
+						git mv other-pool/unclaimed/other-lock other-pool/claimed/other-lock
+						git commit -am "claiming other-lock"
+						git push
+					`)
+					claimOtherLock.Dir = otherPoolDir
+
+					err := claimOtherLock.Run()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					session = runOut(outRequest, sourceDir)
+				})
+
+				It("claims nothing until every pool has a lock available", func() {
+					Consistently(session, 2*time.Second).ShouldNot(gexec.Exit())
+
+					err := exec.Command("git", "-C", otherPoolDir, "fetch").Run()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					unclaimed := exec.Command("git", "ls-tree", "--name-only", "origin/"+branchName, "lock-pool/unclaimed/")
+					unclaimed.Dir = otherPoolDir
+					unclaimedOutput, err := unclaimed.Output()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(unclaimedOutput)).Should(ContainSubstring("lock-pool/unclaimed/some-lock"))
+					Ω(string(unclaimedOutput)).Should(ContainSubstring("lock-pool/unclaimed/some-other-lock"))
+
+					releaseOtherLock := exec.Command("bash", "-e", "-c", `
+						git pull -q
+						git mv other-pool/claimed/other-lock other-pool/unclaimed/other-lock
+						git commit -am "unclaiming other-lock"
+						git push
+					`)
+					releaseOtherLock.Dir = otherPoolDir
+
+					err = releaseOtherLock.Run()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+				})
+			})
+		})
+
+		Context("when acquiring a lock matching a selector", func() {
+			var session *gexec.Session
+
+			BeforeEach(func() {
+				outRequest = out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Acquire: out.AcquireParams{Enabled: true, Match: out.Selector{"some": "json"}},
+					},
+				}
+			})
+
+			It("only claims a lock whose metadata matches", func() {
+				session = runOut(outRequest, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				err := json.Unmarshal(session.Out.Contents(), &outResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(outResponse.Metadata[0]).Should(Equal(out.MetadataPair{Name: "lock_name", Value: "some-lock"}))
+			})
+
+			Context("when the matching lock is claimed", func() {
+				BeforeEach(func() {
+					claim := runOut(out.OutRequest{
+						Source: outRequest.Source,
+						Params: out.OutParams{Claim: "some-lock"},
+					}, sourceDir)
+					<-claim.Exited
+					Expect(claim.ExitCode()).To(Equal(0))
+
+					session = runOut(outRequest, sourceDir)
+				})
+
+				It("waits for it rather than claiming another lock", func() {
+					Consistently(session, 2*time.Second).ShouldNot(gexec.Exit())
+
+					unclaimed := exec.Command("git", "ls-tree", "--name-only", branchName, "lock-pool/unclaimed/")
+					unclaimed.Dir = bareGitRepo
+					unclaimedOutput, err := unclaimed.Output()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(unclaimedOutput)).Should(ContainSubstring("lock-pool/unclaimed/some-other-lock"))
+
+					session.Kill()
+				})
+			})
+		})
+
+		Context("when acquiring locks with a selection strategy", func() {
+			acquireAndRelease := func(strategy string) string {
+				source := out.Source{
+					URI:               bareGitRepo,
+					Branch:            branchName,
+					Pool:              "lock-pool",
+					RetryDelay:        100 * time.Millisecond,
+					SelectionStrategy: strategy,
+				}
+
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				var response out.OutResponse
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Ω(err).ShouldNot(HaveOccurred())
+				lockName := response.Metadata[0].Value
+
+				lockDir := filepath.Join(sourceDir, lockName)
+				err = os.MkdirAll(lockDir, 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+				err = os.WriteFile(filepath.Join(lockDir, "name"), []byte(lockName), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				session = runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Release: lockName},
+				}, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				return lockName
+			}
+
+			It("claims the first lock by name with alphabetical", func() {
+				Ω(acquireAndRelease("alphabetical")).Should(Equal("some-lock"))
+				Ω(acquireAndRelease("alphabetical")).Should(Equal("some-lock"))
+			})
+
+			It("takes turns with round_robin", func() {
+				Ω(acquireAndRelease("round_robin")).Should(Equal("some-lock"))
+				Ω(acquireAndRelease("round_robin")).Should(Equal("some-other-lock"))
+				Ω(acquireAndRelease("round_robin")).Should(Equal("some-lock"))
+			})
+
+			It("claims the lock claimed longest ago with least_recently_used", func() {
+				Ω(acquireAndRelease("alphabetical")).Should(Equal("some-lock"))
+				Ω(acquireAndRelease("least_recently_used")).Should(Equal("some-other-lock"))
+				Ω(acquireAndRelease("least_recently_used")).Should(Equal("some-lock"))
+			})
+
+			It("rejects unknown strategies", func() {
+				session := runOut(out.OutRequest{
+					Source: out.Source{
+						URI:               bareGitRepo,
+						Branch:            branchName,
+						Pool:              "lock-pool",
+						SelectionStrategy: "best_fit",
+					},
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(1))
+
+				Ω(session.Err).Should(gbytes.Say(`invalid payload \(unknown selection_strategy: best_fit\)`))
+			})
 		})
 
 		Context("when there are no locks to be claimed", func() {
@@ -223,7 +646,7 @@ func itWorksWithBranch(branchName string) {
 						RetryDelay: 1 * time.Second,
 					},
 					Params: out.OutParams{
-						Acquire: true,
+						Acquire: out.AcquireParams{Enabled: true},
 					},
 				}
 
@@ -288,6 +711,586 @@ func itWorksWithBranch(branchName string) {
 			})
 		})
 
+		Context("when trying to acquire a lock", func() {
+			var source out.Source
+
+			BeforeEach(func() {
+				source = out.Source{
+					URI:        bareGitRepo,
+					Branch:     branchName,
+					Pool:       "lock-pool",
+					RetryDelay: 100 * time.Millisecond,
+				}
+			})
+
+			tryAcquire := func() out.OutResponse {
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{TryAcquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+
+				var response out.OutResponse
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				return response
+			}
+
+			It("acquires the locks while there are any, then moves on without them", func() {
+				for range 2 {
+					response := tryAcquire()
+					Ω(response.Metadata).Should(ContainElement(out.MetadataPair{Name: "acquired", Value: "true"}))
+				}
+
+				headBefore, err := exec.Command("git", "--git-dir", bareGitRepo, "rev-parse", branchName).Output()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response := tryAcquire()
+				Ω(response.Metadata).Should(Equal([]out.MetadataPair{
+					{Name: "lock_name", Value: ""},
+					{Name: "pool_name", Value: "lock-pool"},
+					{Name: "acquired", Value: "false"},
+				}))
+				Ω(response.Version.Ref).Should(Equal(strings.TrimSpace(string(headBefore))))
+
+				headAfter, err := exec.Command("git", "--git-dir", bareGitRepo, "rev-parse", branchName).Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(headAfter).Should(Equal(headBefore))
+			})
+		})
+
+		Context("when a lock has room for several holders", func() {
+			var setupDir string
+			var locksDir string
+			var source out.Source
+
+			BeforeEach(func() {
+				var err error
+
+				setupDir, err = os.MkdirTemp("", "capacity-setup")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				locksDir, err = os.MkdirTemp("", "capacity-locks")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				setup := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+				git clone --branch %s %s .
+
+				git config user.email "ginkgo@localhost"
+				git config user.name "Ginkgo Local"
+
+				mkdir -p lock-pool/capacity
+				echo 2 > lock-pool/capacity/some-lock
+				git add lock-pool/capacity
+				git mv lock-pool/unclaimed/some-other-lock lock-pool/claimed/
+				git commit -am "giving some-lock room for 2 holders"
+				git push
+			`, branchName, bareGitRepo))
+
+				setup.Stdout = GinkgoWriter
+				setup.Stderr = GinkgoWriter
+				setup.Dir = setupDir
+
+				err = setup.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				source = out.Source{
+					URI:        bareGitRepo,
+					Branch:     branchName,
+					Pool:       "lock-pool",
+					RetryDelay: 100 * time.Millisecond,
+				}
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(setupDir)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.RemoveAll(locksDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			acquireInto := func(step string) {
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{TryAcquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+
+				var response out.OutResponse
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.Metadata).Should(ContainElement(out.MetadataPair{Name: "lock_name", Value: "some-lock"}))
+				Ω(response.Metadata).Should(ContainElement(out.MetadataPair{Name: "acquired", Value: "true"}))
+
+				jsonIn := fmt.Sprintf(`
+				{
+					"source": {
+						"uri": "%s",
+						"branch": "%s",
+						"pool": "lock-pool"
+					},
+					"version": {
+						"ref": "%s"
+					}
+				}`, bareGitRepo, branchName, response.Version.Ref)
+
+				runIn(jsonIn, filepath.Join(locksDir, step), 0)
+			}
+
+			release := func(step string) {
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Release: step},
+				}, locksDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+			}
+
+			claimsOnBranch := func() []string {
+				output, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "-r", "--name-only", branchName, "lock-pool/claimed", "lock-pool/unclaimed", "lock-pool/claims").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				return strings.Fields(string(output))
+			}
+
+			It("gives each holder a slot, and unclaims the lock once the last one releases it", func() {
+				acquireInto("first")
+				acquireInto("second")
+
+				first, err := os.ReadFile(filepath.Join(locksDir, "first", "claim"))
+				Ω(err).ShouldNot(HaveOccurred())
+				second, err := os.ReadFile(filepath.Join(locksDir, "second", "claim"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(first).ShouldNot(Equal(second))
+
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{TryAcquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+
+				var response out.OutResponse
+				err = json.Unmarshal(session.Out.Contents(), &response)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.Metadata).Should(ContainElement(out.MetadataPair{Name: "acquired", Value: "false"}))
+
+				release("first")
+
+				Ω(claimsOnBranch()).Should(ConsistOf(
+					"lock-pool/claimed/.gitkeep",
+					"lock-pool/unclaimed/.gitkeep",
+					"lock-pool/claimed/some-lock",
+					"lock-pool/claimed/some-other-lock",
+					"lock-pool/claims/some-lock/"+strings.TrimSpace(string(second)),
+				))
+
+				release("second")
+
+				Ω(claimsOnBranch()).Should(ConsistOf(
+					"lock-pool/claimed/.gitkeep",
+					"lock-pool/unclaimed/.gitkeep",
+					"lock-pool/unclaimed/some-lock",
+					"lock-pool/claimed/some-other-lock",
+				))
+			})
+
+			It("waits for every holder to release it before claiming it exclusively, and keeps others out meanwhile", func() {
+				acquireInto("first")
+
+				exclusive := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Claim: "some-lock", Mode: out.ExclusiveMode},
+				}, sourceDir)
+				Consistently(exclusive, 2*time.Second).ShouldNot(gexec.Exit())
+
+				release("first")
+
+				Eventually(exclusive, 10*time.Second).Should(gexec.Exit(0))
+
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{TryAcquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+
+				var response out.OutResponse
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.Metadata).Should(ContainElement(out.MetadataPair{Name: "acquired", Value: "false"}))
+			})
+		})
+
+		Context("when claiming a lock in shared mode", func() {
+			var locksDir string
+			var source out.Source
+
+			BeforeEach(func() {
+				var err error
+
+				locksDir, err = os.MkdirTemp("", "shared-locks")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				source = out.Source{
+					URI:        bareGitRepo,
+					Branch:     branchName,
+					Pool:       "lock-pool",
+					RetryDelay: 100 * time.Millisecond,
+				}
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(locksDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			claimInto := func(step string) {
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Claim: "some-lock", Mode: out.SharedMode},
+				}, sourceDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+
+				var response out.OutResponse
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				jsonIn := fmt.Sprintf(`
+				{
+					"source": {
+						"uri": "%s",
+						"branch": "%s",
+						"pool": "lock-pool"
+					},
+					"version": {
+						"ref": "%s"
+					}
+				}`, bareGitRepo, branchName, response.Version.Ref)
+
+				runIn(jsonIn, filepath.Join(locksDir, step), 0)
+			}
+
+			release := func(step string) {
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Release: step},
+				}, locksDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+			}
+
+			treeOnBranch := func() []string {
+				output, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "-r", "--name-only", branchName, "lock-pool/claimed/some-lock", "lock-pool/unclaimed/some-lock", "lock-pool/shared", "lock-pool/claims").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				return strings.Fields(string(output))
+			}
+
+			It("lets several builds hold it, and keeps exclusive claims waiting until they all release it", func() {
+				claimInto("first")
+				claimInto("second")
+
+				second, err := os.ReadFile(filepath.Join(locksDir, "second", "claim"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(treeOnBranch()).Should(HaveLen(4))
+				Ω(treeOnBranch()).Should(ContainElements("lock-pool/claimed/some-lock", "lock-pool/shared/some-lock"))
+
+				exclusive := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Claim: "some-lock", Timeout: time.Second},
+				}, sourceDir)
+				Eventually(exclusive, 10*time.Second).Should(gexec.Exit(1))
+				Ω(exclusive.Err).Should(gbytes.Say("timed out after 1s"))
+
+				check := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Check: "first", Mode: out.SharedMode},
+				}, locksDir)
+				Eventually(check, 10*time.Second).Should(gexec.Exit(0))
+
+				release("first")
+
+				Ω(treeOnBranch()).Should(ConsistOf(
+					"lock-pool/claimed/some-lock",
+					"lock-pool/shared/some-lock",
+					"lock-pool/claims/some-lock/"+strings.TrimSpace(string(second)),
+				))
+
+				release("second")
+
+				Ω(treeOnBranch()).Should(ConsistOf("lock-pool/unclaimed/some-lock"))
+
+				exclusive = runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Claim: "some-lock", Timeout: time.Second},
+				}, sourceDir)
+				Eventually(exclusive, 10*time.Second).Should(gexec.Exit(0))
+			})
+		})
+
+		Context("when waiting for a lock with a timeout", func() {
+			var claimAllLocksDir string
+
+			BeforeEach(func() {
+				var err error
+
+				claimAllLocksDir, err = os.MkdirTemp("", "claiming-locks")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				claimAllLocks := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+				git clone --branch %s %s .
+
+				git config user.email "ginkgo@localhost"
+				git config user.name "Ginkgo Local"
+
+				git mv lock-pool/unclaimed/* lock-pool/claimed/
+				git commit -am "claiming all locks"
+				git push
+			`, branchName, bareGitRepo))
+
+				claimAllLocks.Stdout = GinkgoWriter
+				claimAllLocks.Stderr = GinkgoWriter
+				claimAllLocks.Dir = claimAllLocksDir
+
+				err = claimAllLocks.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(claimAllLocksDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("gives up, listing who holds the locks", func() {
+				session := runOut(out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Acquire: out.AcquireParams{Enabled: true},
+						Timeout: time.Second,
+					},
+				}, sourceDir)
+
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+
+				Ω(session.Err).Should(gbytes.Say("error acquiring lock: timed out after 1s, locks held by:"))
+				Ω(session.Err).Should(gbytes.Say("lock-pool/some-lock: unknown build"))
+				Ω(session.Err).Should(gbytes.Say("lock-pool/some-other-lock: unknown build"))
+			})
+
+			It("gives up claiming a specific lock, listing who holds it", func() {
+				session := runOut(out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Claim:   "some-lock",
+						Timeout: time.Second,
+					},
+				}, sourceDir)
+
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+
+				Ω(session.Err).Should(gbytes.Say("error claiming lock: timed out after 1s, locks held by:\n  lock-pool/some-lock: unknown build\n"))
+			})
+
+			It("stops waiting once the build is aborted", func() {
+				session := runOut(out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Claim:   "some-lock",
+						Timeout: time.Minute,
+					},
+				}, sourceDir)
+				Eventually(session.Err, 10*time.Second).Should(gbytes.Say("waiting for lock"))
+
+				session.Terminate()
+
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+				Ω(session.Err).Should(gbytes.Say("stopped claiming lock: aborted by terminated"))
+			})
+		})
+
+		Context("when builds wait in a pool with a fair queue", func() {
+			var claimAllLocksDir string
+			var source out.Source
+
+			BeforeEach(func() {
+				var err error
+
+				source = out.Source{
+					URI:        bareGitRepo,
+					Branch:     branchName,
+					Pool:       "lock-pool",
+					RetryDelay: 100 * time.Millisecond,
+					FairQueue:  true,
+				}
+
+				claimAllLocksDir, err = os.MkdirTemp("", "claiming-locks")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				claimAllLocks := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+				git clone --branch %s %s .
+
+				git config user.email "ginkgo@localhost"
+				git config user.name "Ginkgo Local"
+
+				git mv lock-pool/unclaimed/* lock-pool/claimed/
+				git commit -am "claiming all locks"
+				git push
+			`, branchName, bareGitRepo))
+
+				claimAllLocks.Stdout = GinkgoWriter
+				claimAllLocks.Stderr = GinkgoWriter
+				claimAllLocks.Dir = claimAllLocksDir
+
+				err = claimAllLocks.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(claimAllLocksDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			releaseLock := func(lock string) {
+				releaseLock := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+				git pull --rebase
+				git mv lock-pool/claimed/%[1]s lock-pool/unclaimed/%[1]s
+				git commit -am "unclaiming %[1]s"
+				git push
+			`, lock))
+
+				releaseLock.Stdout = GinkgoWriter
+				releaseLock.Stderr = GinkgoWriter
+				releaseLock.Dir = claimAllLocksDir
+
+				err := releaseLock.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			It("hands released locks out in the order the builds started waiting", func() {
+				first := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(first.Err, 10*time.Second).Should(gbytes.Say("waiting in the queue of pool: lock-pool"))
+
+				second := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(second.Err, 10*time.Second).Should(gbytes.Say("waiting in the queue of pool: lock-pool"))
+
+				releaseLock("some-lock")
+
+				Eventually(first, 10*time.Second).Should(gexec.Exit(0))
+				Consistently(second, 2*time.Second).ShouldNot(gexec.Exit())
+
+				releaseLock("some-other-lock")
+
+				Eventually(second, 10*time.Second).Should(gexec.Exit(0))
+
+				var firstResponse, secondResponse out.OutResponse
+				err := json.Unmarshal(first.Out.Contents(), &firstResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+				err = json.Unmarshal(second.Out.Contents(), &secondResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(firstResponse.Metadata[0].Value).Should(Equal("some-lock"))
+				Ω(secondResponse.Metadata[0].Value).Should(Equal("some-other-lock"))
+
+				waiting, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "--name-only", "-r", branchName, "lock-pool/waiting").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(strings.TrimSpace(string(waiting))).Should(BeEmpty())
+			})
+
+			It("hands released locks to builds with a higher priority first", func() {
+				soak := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true, Priority: -1}},
+				}, sourceDir)
+				Eventually(soak.Err, 10*time.Second).Should(gbytes.Say("waiting in the queue of pool: lock-pool"))
+
+				releaseCandidate := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true, Priority: 10}},
+				}, sourceDir)
+				Eventually(releaseCandidate.Err, 10*time.Second).Should(gbytes.Say("waiting in the queue of pool: lock-pool"))
+				Eventually(releaseCandidate.Err, 10*time.Second).Should(gbytes.Say("first in the queue, waiting for a lock"))
+				Eventually(soak.Err, 10*time.Second).Should(gbytes.Say("1 ahead in the queue"))
+
+				releaseLock("some-lock")
+
+				Eventually(releaseCandidate, 10*time.Second).Should(gexec.Exit(0))
+				Consistently(soak, 2*time.Second).ShouldNot(gexec.Exit())
+
+				releaseLock("some-other-lock")
+
+				Eventually(soak, 10*time.Second).Should(gexec.Exit(0))
+			})
+
+			It("leaves the queue once the build is aborted", func() {
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(session.Err, 10*time.Second).Should(gbytes.Say("waiting in the queue of pool: lock-pool"))
+
+				session.Terminate()
+
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+				Ω(session.Err).Should(gbytes.Say("stopped acquiring lock: aborted by terminated"))
+
+				waiting, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "--name-only", "-r", branchName, "lock-pool/waiting").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(strings.TrimSpace(string(waiting))).Should(BeEmpty())
+
+				claimed, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "--name-only", "-r", branchName, "lock-pool/claims").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(strings.TrimSpace(string(claimed))).Should(BeEmpty())
+			})
+
+			It("skips past and removes the tickets of builds that stopped waiting", func() {
+				addStaleTicket := exec.Command("bash", "-e", "-c", `
+				mkdir -p lock-pool/waiting
+				echo '{"enqueued_at":"2020-01-01T00:00:00Z","expires_at":"2020-01-01T00:05:00Z"}' > lock-pool/waiting/20200101T000000.000000000Z-abandoned
+				git add lock-pool/waiting
+				git commit -m "enqueuing: 20200101T000000.000000000Z-abandoned (waiting for any lock)"
+				git push
+			`)
+
+				addStaleTicket.Stdout = GinkgoWriter
+				addStaleTicket.Stderr = GinkgoWriter
+				addStaleTicket.Dir = claimAllLocksDir
+
+				err := addStaleTicket.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				releaseLock("some-lock")
+
+				session := runOut(out.OutRequest{
+					Source: source,
+					Params: out.OutParams{Acquire: out.AcquireParams{Enabled: true}},
+				}, sourceDir)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(0))
+
+				waiting, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "--name-only", "-r", branchName, "lock-pool/waiting").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(strings.TrimSpace(string(waiting))).Should(BeEmpty())
+			})
+		})
+
 		Context("when claiming a specific lock", func() {
 			BeforeEach(func() {
 				outRequest = out.OutRequest{
@@ -389,6 +1392,308 @@ func itWorksWithBranch(branchName string) {
 			})
 		})
 
+		Context("when claiming a lock from a build", func() {
+			var inDir string
+
+			BeforeEach(func() {
+				var err error
+				inDir, err = os.MkdirTemp("", "in-dir")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				outRequest = out.OutRequest{
+					Source: out.Source{
+						URI:        bareGitRepo,
+						Branch:     branchName,
+						Pool:       "lock-pool",
+						RetryDelay: 100 * time.Millisecond,
+					},
+					Params: out.OutParams{
+						Claim: "some-lock",
+					},
+				}
+
+				session := runOutWithEnv(outRequest, sourceDir,
+					"BUILD_ID=6543",
+					"BUILD_NAME=42",
+					"BUILD_JOB_NAME=job-name",
+					"BUILD_PIPELINE_NAME=pipeline-name",
+					"BUILD_TEAM_NAME=team-name",
+					"ATC_EXTERNAL_URL=http://example.com",
+				)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				err = json.Unmarshal(session.Out.Contents(), &outResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(inDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("describes the owner of the claim in the metadata", func() {
+				Ω(outResponse.Metadata).Should(Equal([]out.MetadataPair{
+					{Name: "lock_name", Value: "some-lock"},
+					{Name: "pool_name", Value: "lock-pool"},
+					{Name: "claimed_by_team", Value: "team-name"},
+					{Name: "claimed_by_pipeline", Value: "pipeline-name"},
+					{Name: "claimed_by_job", Value: "job-name"},
+					{Name: "claimed_by_build", Value: "42"},
+					{Name: "claimed_by_build_id", Value: "6543"},
+				}))
+			})
+
+			It("records the owner so that fetching the lock outputs it", func() {
+				jsonIn := fmt.Sprintf(`
+				{
+					"source": {
+						"uri": "%s",
+						"branch": "%s",
+						"pool": "lock-pool"
+					},
+					"version": {
+						"ref": "%s"
+					}
+				}`, bareGitRepo, branchName, outResponse.Version.Ref)
+
+				runIn(jsonIn, filepath.Join(inDir, "lock"), 0)
+
+				contents, err := os.ReadFile(filepath.Join(inDir, "lock", "owner"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var record out.ClaimRecord
+				err = json.Unmarshal(contents, &record)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(record.Owner).Should(Equal(out.Owner{
+					BuildID:           "6543",
+					BuildName:         "42",
+					BuildJobName:      "job-name",
+					BuildPipelineName: "pipeline-name",
+					BuildTeamName:     "team-name",
+					ATCExternalURL:    "http://example.com",
+				}))
+				Ω(record.ClaimedAt).Should(BeTemporally("~", time.Now(), time.Minute))
+			})
+		})
+
+		Context("when claiming a lock with a lease", func() {
+			var leaseResponse out.OutResponse
+
+			BeforeEach(func() {
+				outRequest = out.OutRequest{
+					Source: out.Source{
+						URI:           bareGitRepo,
+						Branch:        branchName,
+						Pool:          "lock-pool",
+						RetryDelay:    100 * time.Millisecond,
+						LeaseDuration: 1 * time.Hour,
+					},
+					Params: out.OutParams{
+						Claim: "some-lock",
+					},
+				}
+
+				session := runOut(outRequest, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				err := json.Unmarshal(session.Out.Contents(), &leaseResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("records the expiry of the claim next to the lock", func() {
+				reCloneRepo, err := os.MkdirTemp("", "git-version-repo")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer os.RemoveAll(reCloneRepo)
+
+				reClone := exec.Command("git", "clone", "--branch", branchName, bareGitRepo, ".")
+				reClone.Dir = reCloneRepo
+				err = reClone.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				records, err := os.ReadDir(filepath.Join(reCloneRepo, "lock-pool", "claims", "some-lock"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(records).Should(HaveLen(1))
+
+				contents, err := os.ReadFile(filepath.Join(reCloneRepo, "lock-pool", "claims", "some-lock", records[0].Name()))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var record out.ClaimRecord
+				err = json.Unmarshal(contents, &record)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(record.ExpiresAt).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			})
+
+			Context("when renewing the lease", func() {
+				var renewDir string
+				var renewRequest out.OutRequest
+
+				BeforeEach(func() {
+					var err error
+					renewDir, err = os.MkdirTemp("", "renew-dir")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					jsonIn := fmt.Sprintf(`
+					{
+						"source": {
+							"uri": "%s",
+							"branch": "%s",
+							"pool": "lock-pool"
+						},
+						"version": {
+							"ref": "%s"
+						}
+					}`, bareGitRepo, branchName, leaseResponse.Version.Ref)
+
+					runIn(jsonIn, filepath.Join(renewDir, "lock-step-name"), 0)
+
+					renewRequest = out.OutRequest{
+						Source: outRequest.Source,
+						Params: out.OutParams{
+							Renew:         "lock-step-name",
+							LeaseDuration: 48 * time.Hour,
+						},
+					}
+				})
+
+				AfterEach(func() {
+					err := os.RemoveAll(renewDir)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("pushes the new expiry of the lease", func() {
+					session := runOut(renewRequest, renewDir)
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+
+					var renewResponse out.OutResponse
+					err := json.Unmarshal(session.Out.Contents(), &renewResponse)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					log := exec.Command("git", "log", "-1", renewResponse.Version.Ref)
+					log.Dir = bareGitRepo
+
+					logSession, err := gexec.Start(log, GinkgoWriter, GinkgoWriter)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					<-logSession.Exited
+
+					Ω(logSession).Should(gbytes.Say("renewing: some-lock \\(lease expires at " + time.Now().Add(48*time.Hour).UTC().Format("2006-01-02")))
+				})
+
+				Context("when the lock has been released in the meantime", func() {
+					BeforeEach(func() {
+						releaseRequest := out.OutRequest{
+							Source: outRequest.Source,
+							Params: out.OutParams{
+								Release: "lock-step-name",
+							},
+						}
+
+						session := runOut(releaseRequest, renewDir)
+						<-session.Exited
+						Expect(session.ExitCode()).To(Equal(0))
+					})
+
+					It("fails loudly instead of renewing", func() {
+						session := runOut(renewRequest, renewDir)
+						<-session.Exited
+						Expect(session.ExitCode()).To(Equal(1))
+
+						Ω(session.Err).Should(gbytes.Say("the lock: some-lock has been released or claimed by someone else"))
+					})
+				})
+			})
+
+			Context("when the lease has not expired", func() {
+				It("does not hand the lock to anyone else", func() {
+					claimSession := runOut(outRequest, sourceDir)
+					Consistently(claimSession, 2*time.Second).ShouldNot(gexec.Exit())
+					claimSession.Terminate().Wait()
+				})
+			})
+
+			Context("when every lock is claimed and a lease has expired", func() {
+				var reclaimResponse out.OutResponse
+
+				BeforeEach(func() {
+					expireLease := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+						git clone --branch %s %s .
+
+						git config user.email "ginkgo@localhost"
+						git config user.name "Ginkgo Local"
+
+						for record in lock-pool/claims/some-lock/*; do
+							echo '{"claimed_at":"2000-01-01T00:00:00Z","expires_at":"2000-01-01T01:00:00Z"}' > $record
+						done
+
+						git mv lock-pool/unclaimed/some-other-lock lock-pool/claimed/
+						git commit -am "expire some-lock and claim some-other-lock"
+						git push
+					`, branchName, bareGitRepo))
+
+					expireLease.Stdout = GinkgoWriter
+					expireLease.Stderr = GinkgoWriter
+					expireLease.Dir, _ = os.MkdirTemp("", "expiring-leases")
+					defer os.RemoveAll(expireLease.Dir)
+
+					err := expireLease.Run()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					outRequest.Params = out.OutParams{Acquire: out.AcquireParams{Enabled: true}}
+
+					session := runOut(outRequest, sourceDir)
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+
+					err = json.Unmarshal(session.Out.Contents(), &reclaimResponse)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("reclaims the lock with the expired lease", func() {
+					Ω(reclaimResponse.Metadata).Should(ContainElement(out.MetadataPair{Name: "lock_name", Value: "some-lock"}))
+				})
+
+				It("records the reclaim in the commit message", func() {
+					log := exec.Command("git", "log", "-1", reclaimResponse.Version.Ref)
+					log.Dir = bareGitRepo
+
+					session, err := gexec.Start(log, GinkgoWriter, GinkgoWriter)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					<-session.Exited
+
+					Ω(session).Should(gbytes.Say("reclaiming: some-lock \\(lease expired at 2000-01-01T01:00:00Z\\)"))
+				})
+
+				It("no longer lets the previous holder fetch the lock", func() {
+					inDir, err := os.MkdirTemp("", "in-dir")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					defer os.RemoveAll(inDir)
+
+					jsonIn := fmt.Sprintf(`
+					{
+						"source": {
+							"uri": "%s",
+							"branch": "%s",
+							"pool": "lock-pool"
+						},
+						"version": {
+							"ref": "%s"
+						}
+					}`, bareGitRepo, branchName, leaseResponse.Version.Ref)
+
+					session := runIn(jsonIn, filepath.Join(inDir, "lock"), 1)
+					Ω(session.Err).Should(gbytes.Say("error: lock instance is no longer acquired"))
+				})
+			})
+		})
+
 		Context("when removing a lock", func() {
 			var myLocksGetDir string
 			var outRemoveRequest out.OutRequest
@@ -403,7 +1708,7 @@ func itWorksWithBranch(branchName string) {
 						Pool:   "lock-pool",
 					},
 					Params: out.OutParams{
-						Acquire: true,
+						Acquire: out.AcquireParams{Enabled: true},
 					},
 				}
 
@@ -529,7 +1834,7 @@ func itWorksWithBranch(branchName string) {
 						Pool:   "lock-pool",
 					},
 					Params: out.OutParams{
-						Acquire: true,
+						Acquire: out.AcquireParams{Enabled: true},
 					},
 				}
 
@@ -638,6 +1943,125 @@ func itWorksWithBranch(branchName string) {
 			})
 		})
 
+		Context("when releasing a lock that has been claimed by someone else since it was fetched", func() {
+			var myLocksGetDir string
+			var outReleaseRequest out.OutRequest
+
+			BeforeEach(func() {
+				var err error
+
+				outRequest = out.OutRequest{
+					Source: out.Source{
+						URI:    bareGitRepo,
+						Branch: branchName,
+						Pool:   "lock-pool",
+					},
+					Params: out.OutParams{
+						Claim: "some-lock",
+					},
+				}
+
+				session := runOut(outRequest, sourceDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(0))
+
+				err = json.Unmarshal(session.Out.Contents(), &outResponse)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				myLocksGetDir, err = os.MkdirTemp("", "my-locks")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				jsonIn := fmt.Sprintf(`
+				{
+					"source": {
+						"uri": "%s",
+						"branch": "%s",
+						"pool": "lock-pool"
+					},
+					"version": {
+						"ref": "%s"
+					}
+				}`, bareGitRepo, branchName, outResponse.Version.Ref)
+
+				runIn(jsonIn, filepath.Join(myLocksGetDir, "lock-step-name"), 0)
+
+				reclaimLock := exec.Command("bash", "-e", "-c", fmt.Sprintf(`
+					git clone --branch %s %s .
+
+					git config user.email "ginkgo@localhost"
+					git config user.name "Ginkgo Local"
+
+					git mv lock-pool/claimed/some-lock lock-pool/unclaimed/
+					git commit -am "unclaiming: some-lock"
+					git mv lock-pool/unclaimed/some-lock lock-pool/claimed/
+					git commit -am "claiming: some-lock"
+					git push
+				`, branchName, bareGitRepo))
+
+				reclaimLock.Stdout = GinkgoWriter
+				reclaimLock.Stderr = GinkgoWriter
+				reclaimLock.Dir, err = os.MkdirTemp("", "reclaiming-locks")
+				Ω(err).ShouldNot(HaveOccurred())
+				defer os.RemoveAll(reclaimLock.Dir)
+
+				err = reclaimLock.Run()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				outReleaseRequest = out.OutRequest{
+					Source: outRequest.Source,
+					Params: out.OutParams{
+						Release: "lock-step-name",
+					},
+				}
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(myLocksGetDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("refuses to release the lock", func() {
+				session := runOut(outReleaseRequest, myLocksGetDir)
+				<-session.Exited
+				Expect(session.ExitCode()).To(Equal(1))
+
+				Ω(session.Err).Should(gbytes.Say("the lock: some-lock has been released or claimed by someone else"))
+
+				version := getVersion(bareGitRepo, "origin/"+branchName)
+				log := exec.Command("git", "log", "-1", "--format=%s", version.Ref)
+				log.Dir = bareGitRepo
+				subject, err := log.Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(subject)).Should(Equal("claiming: some-lock\n"))
+			})
+
+			Context("when forcing the release", func() {
+				BeforeEach(func() {
+					outReleaseRequest.Params.ForceRelease = true
+				})
+
+				It("releases the lock anyway", func() {
+					session := runOut(outReleaseRequest, myLocksGetDir)
+					<-session.Exited
+					Expect(session.ExitCode()).To(Equal(0))
+
+					var outReleaseResponse out.OutResponse
+					err := json.Unmarshal(session.Out.Contents(), &outReleaseResponse)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					log := exec.Command("git", "log", "-1", outReleaseResponse.Version.Ref)
+					log.Dir = bareGitRepo
+
+					logSession, err := gexec.Start(log, GinkgoWriter, GinkgoWriter)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					<-logSession.Exited
+
+					Ω(logSession).Should(gbytes.Say("unclaiming: some-lock"))
+				})
+			})
+		})
+
 		Context("when adding an initially unclaimed lock to the pool", func() {
 			var lockToAddDir string
 			var cloneDir string
@@ -1029,7 +2453,7 @@ func itWorksWithBranch(branchName string) {
 						RetryDelay: 1 * time.Second,
 					},
 					Params: out.OutParams{
-						Acquire: true,
+						Acquire: out.AcquireParams{Enabled: true},
 					},
 				}
 
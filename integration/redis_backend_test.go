@@ -0,0 +1,100 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Redis backend", func() {
+	var (
+		fakeRedis *miniredis.Miniredis
+		sourceDir string
+		source    out.Source
+	)
+
+	BeforeEach(func() {
+		var err error
+		fakeRedis, err = miniredis.Run()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		sourceDir, err = os.MkdirTemp("", "source-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		source = out.Source{
+			Backend:    "redis",
+			Redis:      out.RedisSource{Address: fakeRedis.Addr()},
+			Pool:       "lock-pool",
+			RetryDelay: 100 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		fakeRedis.Close()
+
+		err := os.RemoveAll(sourceDir)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	put := func(params out.OutParams) out.OutResponse {
+		session := runOut(out.OutRequest{Source: source, Params: params}, sourceDir)
+		<-session.Exited
+		Expect(session.ExitCode()).To(Equal(0))
+
+		var response out.OutResponse
+		err := json.Unmarshal(session.Out.Contents(), &response)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return response
+	}
+
+	It("counts up a revision as locks are added, acquired, and released", func() {
+		for _, lock := range []string{"some-lock", "some-other-lock"} {
+			lockDir := filepath.Join(sourceDir, lock)
+			err := os.MkdirAll(lockDir, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(lockDir, "name"), []byte(lock), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+			err = os.WriteFile(filepath.Join(lockDir, "metadata"), []byte(`{"some":"json"}`), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			put(out.OutParams{Add: lock})
+		}
+
+		first := put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+		second := put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+		Ω(first.Version).Should(Equal(out.Version{Ref: "3"}))
+		Ω(second.Version).Should(Equal(out.Version{Ref: "4"}))
+		Ω(first.Metadata[0].Value).ShouldNot(Equal(second.Metadata[0].Value))
+
+		sourceJSON, err := json.Marshal(source)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		destination := filepath.Join(sourceDir, "lock-step")
+		runIn(fmt.Sprintf(`{"source": %s, "version": {"ref": "3"}}`, sourceJSON), destination, 0)
+
+		name, err := os.ReadFile(filepath.Join(destination, "name"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(name)).Should(Equal(first.Metadata[0].Value + "\n"))
+
+		released := put(out.OutParams{Release: "lock-step"})
+		Ω(released.Version).Should(Equal(out.Version{Ref: "5"}))
+		Ω(fakeRedis.HGet("pool-resource", "revision")).Should(Equal("5"))
+
+		session := runCheck(fmt.Sprintf(`{"source": %s, "version": {"ref": "4"}}`, sourceJSON))
+
+		var versions []out.Version
+		err = json.Unmarshal(session.Out.Contents(), &versions)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(versions).Should(Equal([]out.Version{{Ref: "4"}, {Ref: "5"}}))
+	})
+})
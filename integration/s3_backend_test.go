@@ -0,0 +1,143 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/concourse/pool-resource/out"
+	"github.com/concourse/pool-resource/out/fakes3"
+)
+
+var _ = Describe("S3 backend", func() {
+	var (
+		fakeS3    *fakes3.Server
+		sourceDir string
+		source    out.Source
+	)
+
+	BeforeEach(func() {
+		fakeS3 = fakes3.New()
+
+		var err error
+		sourceDir, err = os.MkdirTemp("", "source-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		source = out.Source{
+			Backend: "s3",
+			S3: out.S3Source{
+				Bucket:          "some-bucket",
+				Endpoint:        fakeS3.URL,
+				UsePathStyle:    true,
+				AccessKeyID:     "some-access-key-id",
+				SecretAccessKey: "some-secret-access-key",
+			},
+			Pool:       "lock-pool",
+			RetryDelay: 100 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		fakeS3.Close()
+
+		err := os.RemoveAll(sourceDir)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	put := func(params out.OutParams) out.OutResponse {
+		session := runOut(out.OutRequest{Source: source, Params: params}, sourceDir)
+		<-session.Exited
+		Expect(session.ExitCode()).To(Equal(0))
+
+		var response out.OutResponse
+		err := json.Unmarshal(session.Out.Contents(), &response)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return response
+	}
+
+	sourceJSON := func() string {
+		source, err := json.Marshal(source)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return string(source)
+	}
+
+	It("adds a lock to an empty bucket, then acquires, fetches, and releases it", func() {
+		lockDir := filepath.Join(sourceDir, "new-lock")
+		err := os.MkdirAll(lockDir, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.WriteFile(filepath.Join(lockDir, "name"), []byte("some-lock"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+		err = os.WriteFile(filepath.Join(lockDir, "metadata"), []byte(`{"some":"json"}`), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		response := put(out.OutParams{Add: "new-lock"})
+		Ω(response.Version).Should(Equal(out.Version{Ref: "1"}))
+
+		response = put(out.OutParams{Acquire: out.AcquireParams{Enabled: true}})
+		Ω(response.Version).Should(Equal(out.Version{Ref: "2"}))
+
+		destination := filepath.Join(sourceDir, "lock-step")
+		runIn(fmt.Sprintf(`{"source": %s, "version": {"ref": "2"}}`, sourceJSON()), destination, 0)
+
+		metadata, err := os.ReadFile(filepath.Join(destination, "metadata"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(metadata)).Should(Equal(`{"some":"json"}`))
+
+		session := runCheck(fmt.Sprintf(`{"source": %s, "version": {"ref": "1"}}`, sourceJSON()))
+
+		var versions []out.Version
+		err = json.Unmarshal(session.Out.Contents(), &versions)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(versions).Should(Equal([]out.Version{{Ref: "1"}, {Ref: "2"}}))
+
+		response = put(out.OutParams{Release: "lock-step"})
+		Ω(response.Version).Should(Equal(out.Version{Ref: "3"}))
+
+		contents, found := fakeS3.Object("some-bucket", "pool-resource.json")
+		Ω(found).Should(BeTrue())
+
+		var state out.PoolState
+		err = json.Unmarshal(contents, &state)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(state.Files).Should(HaveKey("lock-pool/unclaimed/some-lock"))
+		Ω(state.Files).ShouldNot(HaveKey("lock-pool/claimed/some-lock"))
+	})
+
+	It("hands a lock out once when two builds try to acquire it at the same time", func() {
+		var state out.PoolState
+		state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}"}, "adding some-lock")
+
+		contents, err := json.Marshal(state)
+		Ω(err).ShouldNot(HaveOccurred())
+		fakeS3.PutObject("some-bucket", "pool-resource.json", contents)
+
+		request := out.OutRequest{Source: source, Params: out.OutParams{TryAcquire: out.AcquireParams{Enabled: true}}}
+
+		sessions := []*gexec.Session{runOut(request, sourceDir), runOut(request, sourceDir)}
+
+		var acquired int
+		for _, session := range sessions {
+			<-session.Exited
+			Expect(session.ExitCode()).To(Equal(0))
+
+			var response out.OutResponse
+			err := json.Unmarshal(session.Out.Contents(), &response)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			if response.Metadata[2].Value == "true" {
+				acquired++
+			}
+		}
+
+		Ω(acquired).Should(Equal(1))
+	})
+})
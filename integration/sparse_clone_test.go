@@ -0,0 +1,234 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Sparse clone", func() {
+	var (
+		bareGitRepo string
+		sourceDir   string
+		tempDir     string
+		source      out.Source
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		bareGitRepo, err = os.MkdirTemp("", "bare-git-repo")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		sourceDir, err = os.MkdirTemp("", "source-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		// keeps the clones cached by puts and checks to this test
+		tempDir, err = os.MkdirTemp("", "temp-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		setup := exec.Command("bash", "-e", "-c", `
+			git init -q --bare --initial-branch=master .
+			git config uploadpack.allowFilter true
+
+			clone=$(mktemp -d)
+			git clone -q "$PWD" "$clone"
+			cd "$clone"
+
+			git config user.email "ginkgo@localhost"
+			git config user.name "Ginkgo Local"
+
+			echo "the locks of our environments" > README.md
+
+			for pool in lock-pool other-pool unrelated-pool; do
+				mkdir -p $pool/unclaimed $pool/claimed
+				touch $pool/unclaimed/.gitkeep $pool/claimed/.gitkeep
+				echo '{"pool":"'$pool'"}' > $pool/unclaimed/some-lock
+			done
+
+			git add .
+			git commit -q -m "adding pools"
+			git push -q origin HEAD:master
+
+			rm -rf "$clone"
+		`)
+		setup.Dir = bareGitRepo
+		setup.Stdout = GinkgoWriter
+		setup.Stderr = GinkgoWriter
+
+		err = setup.Run()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		source = out.Source{
+			URI:         "file://" + bareGitRepo,
+			Branch:      "master",
+			Pool:        "lock-pool",
+			RetryDelay:  100 * time.Millisecond,
+			GitEngine:   "git",
+			SparseClone: true,
+		}
+	})
+
+	AfterEach(func() {
+		for _, dir := range []string{bareGitRepo, sourceDir, tempDir} {
+			err := os.RemoveAll(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	})
+
+	acquire := func(pools ...string) out.OutResponse {
+		session := runOutWithEnv(out.OutRequest{
+			Source: source,
+			Params: out.OutParams{
+				Acquire: out.AcquireParams{Enabled: true, Pools: pools},
+			},
+		}, sourceDir, "TMPDIR="+tempDir)
+		<-session.Exited
+		Expect(session.ExitCode()).To(Equal(0))
+
+		var response out.OutResponse
+		err := json.Unmarshal(session.Out.Contents(), &response)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return response
+	}
+
+	claimedOnMaster := func() []string {
+		claimed, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "-r", "--name-only", "master").Output()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var files []string
+		for _, file := range strings.Fields(string(claimed)) {
+			if strings.Contains(file, "/claimed/") && !strings.HasSuffix(file, ".gitkeep") {
+				files = append(files, file)
+			}
+		}
+
+		return files
+	}
+
+	get := func(version out.Version, destination string) {
+		jsonIn := fmt.Sprintf(`{
+			"source": {
+				"uri": "%s",
+				"branch": "master",
+				"pool": "lock-pool",
+				"sparse_clone": true
+			},
+			"version": {
+				"ref": "%s"
+			}
+		}`, source.URI, version.Ref)
+
+		runIn(jsonIn, destination, 0)
+	}
+
+	It("acquires a lock from a clone of only the pool", func() {
+		response := acquire()
+		Ω(response.Metadata[0]).Should(Equal(out.MetadataPair{Name: "lock_name", Value: "some-lock"}))
+
+		Ω(claimedOnMaster()).Should(ConsistOf("lock-pool/claimed/some-lock"))
+
+		clones, err := filepath.Glob(filepath.Join(tempDir, "pool-resource-repo-cache", "*", ".git"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(clones).Should(HaveLen(1))
+
+		clone := filepath.Dir(clones[0])
+		Ω(filepath.Join(clone, "lock-pool", "claimed", "some-lock")).Should(BeAnExistingFile())
+		Ω(filepath.Join(clone, "README.md")).Should(BeAnExistingFile())
+		Ω(filepath.Join(clone, "other-pool")).ShouldNot(BeADirectory())
+
+		promisor, err := exec.Command("git", "-C", clone, "config", "remote.origin.promisor").Output()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(strings.TrimSpace(string(promisor))).Should(Equal("true"))
+	})
+
+	It("acquires locks from several pools by checking them out as well", func() {
+		acquire("lock-pool", "other-pool")
+
+		Ω(claimedOnMaster()).Should(ConsistOf(
+			"lock-pool/claimed/some-lock",
+			"other-pool/claimed/some-lock",
+		))
+	})
+
+	It("keeps the rest of the repository as it was", func() {
+		acquire()
+
+		tree, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "-r", "--name-only", "master").Output()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(strings.Fields(string(tree))).Should(ContainElements(
+			"README.md",
+			"other-pool/unclaimed/some-lock",
+			"unrelated-pool/unclaimed/some-lock",
+		))
+	})
+
+	It("fetches the acquired lock with only the pool checked out", func() {
+		response := acquire()
+
+		destination, err := os.MkdirTemp("", "in-destination")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(destination)
+
+		get(response.Version, destination)
+
+		name, err := os.ReadFile(filepath.Join(destination, "name"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(name)).Should(Equal("some-lock\n"))
+
+		metadata, err := os.ReadFile(filepath.Join(destination, "metadata"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(metadata)).Should(MatchJSON(`{"pool":"lock-pool"}`))
+
+		Ω(filepath.Join(destination, "other-pool")).ShouldNot(BeADirectory())
+		Ω(filepath.Join(destination, "unrelated-pool")).ShouldNot(BeADirectory())
+	})
+
+	It("fetches locks acquired from several pools", func() {
+		response := acquire("lock-pool", "other-pool")
+
+		destination, err := os.MkdirTemp("", "in-destination")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(destination)
+
+		get(response.Version, destination)
+
+		metadata, err := os.ReadFile(filepath.Join(destination, "other-pool", "some-lock", "metadata"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(metadata)).Should(MatchJSON(`{"pool":"other-pool"}`))
+
+		Ω(filepath.Join(destination, "unrelated-pool")).ShouldNot(BeADirectory())
+	})
+
+	It("checks for new versions of the pool", func() {
+		response := acquire()
+
+		jsonCheck := fmt.Sprintf(`{
+			"source": {
+				"uri": "%s",
+				"branch": "master",
+				"pool": "lock-pool",
+				"sparse_clone": true
+			}
+		}`, source.URI)
+
+		session := runCheck(jsonCheck, "TMPDIR="+tempDir)
+
+		var versions []out.Version
+		err := json.Unmarshal(session.Out.Contents(), &versions)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(versions).Should(Equal([]out.Version{response.Version}))
+	})
+})
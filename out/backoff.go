@@ -0,0 +1,114 @@
+package out
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const defaultMaxUnexpectedErrors = 5
+
+// RetryBackoff configures how long to wait before trying again, depending on
+// why the attempt did not go through.
+type RetryBackoff struct {
+	// waiting for a lock to become available, or for our turn in the queue
+	NoLocks Backoff `json:"no_locks" mapstructure:"no_locks"`
+
+	// someone else changed the pool first
+	Conflict Backoff `json:"conflict"`
+
+	// anything else that went wrong while changing the pool
+	UnexpectedError Backoff `json:"unexpected_error" mapstructure:"unexpected_error"`
+
+	MaxUnexpectedErrors int `json:"max_unexpected_errors,omitempty" mapstructure:"max_unexpected_errors"`
+}
+
+// Backoff waits Initial before the first retry, and Multiplier times as
+// long before every retry after it, up to Max. Jitter is the fraction of
+// every wait that is randomly cut from it, which keeps builds waiting on the
+// same pool from retrying in lockstep.
+type Backoff struct {
+	Initial    time.Duration `json:"initial,omitempty"`
+	Max        time.Duration `json:"max,omitempty"`
+	Multiplier float64       `json:"multiplier,omitempty"`
+	Jitter     float64       `json:"jitter,omitempty"`
+}
+
+// WithDefaults fills in what is not configured, such that every retry waits
+// for the retry_delay of the source, as it did before backoff could be
+// configured.
+func (rb RetryBackoff) WithDefaults(retryDelay time.Duration) RetryBackoff {
+	rb.NoLocks = rb.NoLocks.withDefaults(retryDelay)
+	rb.Conflict = rb.Conflict.withDefaults(retryDelay)
+	rb.UnexpectedError = rb.UnexpectedError.withDefaults(retryDelay)
+
+	if rb.MaxUnexpectedErrors == 0 {
+		rb.MaxUnexpectedErrors = defaultMaxUnexpectedErrors
+	}
+
+	return rb
+}
+
+func (b Backoff) withDefaults(retryDelay time.Duration) Backoff {
+	if b.Initial == 0 {
+		b.Initial = retryDelay
+	}
+
+	if b.Multiplier == 0 {
+		b.Multiplier = 1
+	}
+
+	return b
+}
+
+// Delay returns how long to wait before the given retry, counting from 1.
+func (b Backoff) Delay(retry int) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(retry-1))
+
+	if b.Max != 0 {
+		delay = math.Min(delay, float64(b.Max))
+	}
+
+	// the largest float that still fits a duration, as MaxInt64 rounds up
+	delay = math.Min(delay, math.Nextafter(math.MaxInt64, 0))
+	delay -= delay * b.Jitter * rand.Float64()
+
+	return time.Duration(delay)
+}
+
+func (rb RetryBackoff) validate() []string {
+	var errorMessages []string
+
+	errorMessages = append(errorMessages, rb.NoLocks.validate("retry_backoff.no_locks")...)
+	errorMessages = append(errorMessages, rb.Conflict.validate("retry_backoff.conflict")...)
+	errorMessages = append(errorMessages, rb.UnexpectedError.validate("retry_backoff.unexpected_error")...)
+
+	if rb.MaxUnexpectedErrors < 0 {
+		errorMessages = append(errorMessages, "invalid payload (retry_backoff.max_unexpected_errors must be positive)")
+	}
+
+	return errorMessages
+}
+
+func (b Backoff) validate(name string) []string {
+	var errorMessages []string
+
+	if b.Initial < 0 || b.Max < 0 {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s durations must be positive)", name))
+	}
+
+	if b.Max != 0 && b.Max < b.Initial {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s max must not be less than initial)", name))
+	}
+
+	if b.Multiplier != 0 && b.Multiplier < 1 {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s multiplier must be at least 1)", name))
+	}
+
+	if b.Jitter < 0 || b.Jitter > 1 {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s jitter must be between 0 and 1)", name))
+	}
+
+	return errorMessages
+}
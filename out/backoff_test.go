@@ -0,0 +1,74 @@
+package out_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Backoff", func() {
+	It("waits for the retry delay before every retry by default", func() {
+		backoff := out.RetryBackoff{}.WithDefaults(10 * time.Second)
+
+		for retry := 1; retry <= 3; retry++ {
+			Ω(backoff.NoLocks.Delay(retry)).Should(Equal(10 * time.Second))
+			Ω(backoff.Conflict.Delay(retry)).Should(Equal(10 * time.Second))
+			Ω(backoff.UnexpectedError.Delay(retry)).Should(Equal(10 * time.Second))
+		}
+
+		Ω(backoff.MaxUnexpectedErrors).Should(Equal(5))
+	})
+
+	It("keeps what is configured", func() {
+		backoff := out.RetryBackoff{
+			Conflict:            out.Backoff{Initial: time.Second, Multiplier: 3},
+			MaxUnexpectedErrors: 2,
+		}.WithDefaults(10 * time.Second)
+
+		Ω(backoff.Conflict).Should(Equal(out.Backoff{Initial: time.Second, Multiplier: 3}))
+		Ω(backoff.NoLocks).Should(Equal(out.Backoff{Initial: 10 * time.Second, Multiplier: 1}))
+		Ω(backoff.MaxUnexpectedErrors).Should(Equal(2))
+	})
+
+	It("grows every wait by the multiplier, up to the max", func() {
+		backoff := out.Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+
+		var delays []time.Duration
+		for retry := 1; retry <= 6; retry++ {
+			delays = append(delays, backoff.Delay(retry))
+		}
+
+		Ω(delays).Should(Equal([]time.Duration{
+			1 * time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			8 * time.Second,
+			10 * time.Second,
+			10 * time.Second,
+		}))
+	})
+
+	It("does not overflow without a max", func() {
+		backoff := out.Backoff{Initial: time.Hour, Multiplier: 10}
+
+		Ω(backoff.Delay(100)).Should(BeNumerically(">", time.Hour))
+	})
+
+	It("cuts up to the jitter from every wait", func() {
+		backoff := out.Backoff{Initial: 10 * time.Second, Multiplier: 1, Jitter: 0.5}
+
+		delays := map[time.Duration]bool{}
+		for range 100 {
+			delay := backoff.Delay(1)
+			Ω(delay).Should(BeNumerically(">=", 5*time.Second))
+			Ω(delay).Should(BeNumerically("<=", 10*time.Second))
+
+			delays[delay] = true
+		}
+
+		Ω(len(delays)).Should(BeNumerically(">", 1))
+	})
+})
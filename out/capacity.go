@@ -0,0 +1,35 @@
+package out
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CapacityPath is where a lock declares how many holders it can have at
+// once, relative to the root of the repository.
+func CapacityPath(pool string, lock string) string {
+	return filepath.Join(pool, "capacity", lock)
+}
+
+// ReadCapacity returns how many holders a lock in the repository cloned to
+// dir can have at once. Locks that do not declare a capacity can only be
+// held by one holder at a time.
+func ReadCapacity(dir string, pool string, lock string) (int, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, CapacityPath(pool, lock)))
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	capacity, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil || capacity < 1 {
+		return 0, fmt.Errorf("invalid capacity for lock %s: %q", lock, strings.TrimSpace(string(contents)))
+	}
+
+	return capacity, nil
+}
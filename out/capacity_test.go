@@ -0,0 +1,60 @@
+package out_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("ReadCapacity", func() {
+	var dir string
+
+	writeCapacity := func(contents string) {
+		err := os.MkdirAll(filepath.Join(dir, "my-pool", "capacity"), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.WriteFile(filepath.Join(dir, out.CapacityPath("my-pool", "some-lock")), []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "capacity")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(dir)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("is one for locks that do not declare a capacity", func() {
+		capacity, err := out.ReadCapacity(dir, "my-pool", "some-lock")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(capacity).Should(Equal(1))
+	})
+
+	It("reads the capacity declared for the lock", func() {
+		writeCapacity("4\n")
+
+		capacity, err := out.ReadCapacity(dir, "my-pool", "some-lock")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(capacity).Should(Equal(4))
+	})
+
+	It("rejects capacities that are not a positive number", func() {
+		writeCapacity("0")
+
+		_, err := out.ReadCapacity(dir, "my-pool", "some-lock")
+		Ω(err).Should(MatchError(`invalid capacity for lock some-lock: "0"`))
+
+		writeCapacity("lots")
+
+		_, err = out.ReadCapacity(dir, "my-pool", "some-lock")
+		Ω(err).Should(MatchError(`invalid capacity for lock some-lock: "lots"`))
+	})
+})
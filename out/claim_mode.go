@@ -0,0 +1,57 @@
+package out
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ClaimMode is how a lock is claimed. A lock claimed exclusively has a
+// single holder, whereas any number of builds can hold a lock claimed in
+// shared mode at once.
+type ClaimMode string
+
+const (
+	ExclusiveMode ClaimMode = "exclusive"
+	SharedMode    ClaimMode = "shared"
+)
+
+func (mode ClaimMode) Valid() bool {
+	return mode == "" || mode == ExclusiveMode || mode == SharedMode
+}
+
+// SharedPath marks a claimed lock as held in shared mode, relative to the
+// root of the repository. Each of its holders has a claim record.
+func SharedPath(pool string, lock string) string {
+	return filepath.Join(pool, "shared", lock)
+}
+
+// IsShared is true if a lock in the repository cloned to dir is held in
+// shared mode.
+func IsShared(dir string, pool string, lock string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dir, SharedPath(pool, lock)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// HeldBySeveral is true for locks whose holders come and go while the lock
+// stays claimed: those with room for several holders, and those held in
+// shared mode. Releasing or renewing such a lock only affects a single
+// claim on it.
+func HeldBySeveral(dir string, pool string, lock string) (bool, error) {
+	capacity, err := ReadCapacity(dir, pool, lock)
+	if err != nil {
+		return false, err
+	}
+
+	if capacity > 1 {
+		return true, nil
+	}
+
+	return IsShared(dir, pool, lock)
+}
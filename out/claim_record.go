@@ -0,0 +1,107 @@
+package out
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ClaimRecord is stored next to a claimed lock, under
+// <pool>/claims/<lock>/<id>, and describes a single claim on that lock.
+type ClaimRecord struct {
+	ID        string    `json:"-"`
+	ClaimedAt time.Time `json:"claimed_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// Exclusive keeps anyone else from taking a slot of a lock with room for
+	// several holders while the claim lasts.
+	Exclusive bool `json:"exclusive,omitempty"`
+
+	Owner
+}
+
+// Owner identifies the build that made a claim, as described by the build
+// metadata Concourse passes to resources.
+type Owner struct {
+	BuildID           string `json:"build_id,omitempty"`
+	BuildName         string `json:"build_name,omitempty"`
+	BuildJobName      string `json:"build_job_name,omitempty"`
+	BuildPipelineName string `json:"build_pipeline_name,omitempty"`
+	BuildTeamName     string `json:"build_team_name,omitempty"`
+	ATCExternalURL    string `json:"atc_external_url,omitempty"`
+}
+
+func NewClaimRecord(now time.Time, leaseDuration time.Duration, owner Owner) ClaimRecord {
+	record := ClaimRecord{
+		ID:        newClaimID(),
+		ClaimedAt: now.UTC(),
+		Owner:     owner,
+	}
+
+	if leaseDuration > 0 {
+		record.ExpiresAt = now.Add(leaseDuration).UTC()
+	}
+
+	return record
+}
+
+func (record ClaimRecord) Expired(now time.Time) bool {
+	return !record.ExpiresAt.IsZero() && now.After(record.ExpiresAt)
+}
+
+func OwnerFromEnv() Owner {
+	return Owner{
+		BuildID:           os.Getenv("BUILD_ID"),
+		BuildName:         os.Getenv("BUILD_NAME"),
+		BuildJobName:      os.Getenv("BUILD_JOB_NAME"),
+		BuildPipelineName: os.Getenv("BUILD_PIPELINE_NAME"),
+		BuildTeamName:     os.Getenv("BUILD_TEAM_NAME"),
+		ATCExternalURL:    os.Getenv("ATC_EXTERNAL_URL"),
+	}
+}
+
+func (owner Owner) MetadataPairs() []MetadataPair {
+	var pairs []MetadataPair
+
+	for _, field := range []MetadataPair{
+		{Name: "claimed_by_team", Value: owner.BuildTeamName},
+		{Name: "claimed_by_pipeline", Value: owner.BuildPipelineName},
+		{Name: "claimed_by_job", Value: owner.BuildJobName},
+		{Name: "claimed_by_build", Value: owner.BuildName},
+		{Name: "claimed_by_build_id", Value: owner.BuildID},
+	} {
+		if field.Value != "" {
+			pairs = append(pairs, field)
+		}
+	}
+
+	return pairs
+}
+
+// String describes the build in the same way as the Concourse UI, along with
+// a link to it if the external URL of Concourse is known.
+func (owner Owner) String() string {
+	if owner == (Owner{}) {
+		return "unknown build"
+	}
+
+	description := fmt.Sprintf("%s/%s/%s #%s", owner.BuildTeamName, owner.BuildPipelineName, owner.BuildJobName, owner.BuildName)
+	if owner.BuildJobName == "" {
+		description = fmt.Sprintf("one-off build #%s", owner.BuildID)
+	}
+
+	if owner.ATCExternalURL != "" && owner.BuildID != "" {
+		description += fmt.Sprintf(" (%s/builds/%s)", strings.TrimSuffix(owner.ATCExternalURL, "/"), owner.BuildID)
+	}
+
+	return description
+}
+
+func newClaimID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package out_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("ClaimRecord", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	})
+
+	Describe("NewClaimRecord", func() {
+		It("generates a unique id for every claim", func() {
+			first := out.NewClaimRecord(now, 0, out.Owner{})
+			second := out.NewClaimRecord(now, 0, out.Owner{})
+
+			Ω(first.ID).ShouldNot(BeEmpty())
+			Ω(first.ID).ShouldNot(Equal(second.ID))
+		})
+
+		Context("without a lease duration", func() {
+			It("never expires", func() {
+				record := out.NewClaimRecord(now, 0, out.Owner{})
+
+				Ω(record.ExpiresAt.IsZero()).Should(BeTrue())
+				Ω(record.Expired(now.Add(100 * 365 * 24 * time.Hour))).Should(BeFalse())
+			})
+		})
+
+		Context("with a lease duration", func() {
+			It("expires once the lease has passed", func() {
+				record := out.NewClaimRecord(now, time.Hour, out.Owner{})
+
+				Ω(record.ExpiresAt).Should(Equal(now.Add(time.Hour)))
+				Ω(record.Expired(now.Add(time.Hour))).Should(BeFalse())
+				Ω(record.Expired(now.Add(time.Hour + time.Second))).Should(BeTrue())
+			})
+		})
+	})
+
+	It("serializes the owner alongside the claim", func() {
+		record := out.NewClaimRecord(now, 0, out.Owner{
+			BuildID:           "42",
+			BuildName:         "7",
+			BuildJobName:      "deploy",
+			BuildPipelineName: "main",
+			BuildTeamName:     "team",
+			ATCExternalURL:    "https://ci.example.com",
+		})
+
+		contents, err := json.Marshal(record)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(contents).Should(MatchJSON(`{
+			"claimed_at": "2020-01-02T03:04:05Z",
+			"build_id": "42",
+			"build_name": "7",
+			"build_job_name": "deploy",
+			"build_pipeline_name": "main",
+			"build_team_name": "team",
+			"atc_external_url": "https://ci.example.com"
+		}`))
+	})
+
+	Describe("Owner", func() {
+		It("describes the owner as metadata, skipping unknown fields", func() {
+			owner := out.Owner{
+				BuildJobName:      "deploy",
+				BuildPipelineName: "main",
+				BuildName:         "7",
+			}
+
+			Ω(owner.MetadataPairs()).Should(Equal([]out.MetadataPair{
+				{Name: "claimed_by_pipeline", Value: "main"},
+				{Name: "claimed_by_job", Value: "deploy"},
+				{Name: "claimed_by_build", Value: "7"},
+			}))
+		})
+
+		It("describes the build, with a link to it if possible", func() {
+			owner := out.Owner{
+				BuildID:           "123",
+				BuildName:         "7",
+				BuildJobName:      "deploy",
+				BuildPipelineName: "main",
+				BuildTeamName:     "platform",
+				ATCExternalURL:    "https://ci.example.com/",
+			}
+			Ω(owner.String()).Should(Equal("platform/main/deploy #7 (https://ci.example.com/builds/123)"))
+
+			Ω(out.Owner{BuildID: "123"}.String()).Should(Equal("one-off build #123"))
+			Ω(out.Owner{}.String()).Should(Equal("unknown build"))
+		})
+	})
+})
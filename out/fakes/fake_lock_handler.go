@@ -2,6 +2,7 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 
 	"github.com/concourse/pool-resource/out"
@@ -23,9 +24,10 @@ type FakeLockHandler struct {
 		result1 string
 		result2 error
 	}
-	BroadcastLockPoolStub        func() (string, error)
+	BroadcastLockPoolStub        func(context.Context) (string, error)
 	broadcastLockPoolMutex       sync.RWMutex
 	broadcastLockPoolArgsForCall []struct {
+		arg1 context.Context
 	}
 	broadcastLockPoolReturns struct {
 		result1 string
@@ -35,10 +37,11 @@ type FakeLockHandler struct {
 		result1 string
 		result2 error
 	}
-	CheckLockStub        func(string) (string, error)
+	CheckLockStub        func(string, out.ClaimMode) (string, error)
 	checkLockMutex       sync.RWMutex
 	checkLockArgsForCall []struct {
 		arg1 string
+		arg2 out.ClaimMode
 	}
 	checkLockReturns struct {
 		result1 string
@@ -61,10 +64,11 @@ type FakeLockHandler struct {
 		result1 string
 		result2 error
 	}
-	ClaimLockStub        func(string) (string, error)
+	ClaimLockStub        func(string, out.ClaimMode) (string, error)
 	claimLockMutex       sync.RWMutex
 	claimLockArgsForCall []struct {
 		arg1 string
+		arg2 out.ClaimMode
 	}
 	claimLockReturns struct {
 		result1 string
@@ -74,20 +78,109 @@ type FakeLockHandler struct {
 		result1 string
 		result2 error
 	}
-	GrabAvailableLockStub        func() (string, string, error)
+	CleanupStub        func() error
+	cleanupMutex       sync.RWMutex
+	cleanupArgsForCall []struct {
+	}
+	cleanupReturns struct {
+		result1 error
+	}
+	cleanupReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CurrentVersionStub        func() (string, error)
+	currentVersionMutex       sync.RWMutex
+	currentVersionArgsForCall []struct {
+	}
+	currentVersionReturns struct {
+		result1 string
+		result2 error
+	}
+	currentVersionReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	EnqueueStub        func(string, int) (string, string, error)
+	enqueueMutex       sync.RWMutex
+	enqueueArgsForCall []struct {
+		arg1 string
+		arg2 int
+	}
+	enqueueReturns struct {
+		result1 string
+		result2 string
+		result3 error
+	}
+	enqueueReturnsOnCall map[int]struct {
+		result1 string
+		result2 string
+		result3 error
+	}
+	GrabAvailableLockStub        func(out.AcquireParams) (map[string][]string, string, error)
 	grabAvailableLockMutex       sync.RWMutex
 	grabAvailableLockArgsForCall []struct {
+		arg1 out.AcquireParams
 	}
 	grabAvailableLockReturns struct {
-		result1 string
+		result1 map[string][]string
 		result2 string
 		result3 error
 	}
 	grabAvailableLockReturnsOnCall map[int]struct {
-		result1 string
+		result1 map[string][]string
 		result2 string
 		result3 error
 	}
+	HoldersStub        func(string) ([]out.Holder, error)
+	holdersMutex       sync.RWMutex
+	holdersArgsForCall []struct {
+		arg1 string
+	}
+	holdersReturns struct {
+		result1 []out.Holder
+		result2 error
+	}
+	holdersReturnsOnCall map[int]struct {
+		result1 []out.Holder
+		result2 error
+	}
+	LeaveQueueStub        func() (string, error)
+	leaveQueueMutex       sync.RWMutex
+	leaveQueueArgsForCall []struct {
+	}
+	leaveQueueReturns struct {
+		result1 string
+		result2 error
+	}
+	leaveQueueReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	PushedVersionStub        func(string) (string, error)
+	pushedVersionMutex       sync.RWMutex
+	pushedVersionArgsForCall []struct {
+		arg1 string
+	}
+	pushedVersionReturns struct {
+		result1 string
+		result2 error
+	}
+	pushedVersionReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	RefreshTicketStub        func() (string, error)
+	refreshTicketMutex       sync.RWMutex
+	refreshTicketArgsForCall []struct {
+	}
+	refreshTicketReturns struct {
+		result1 string
+		result2 error
+	}
+	refreshTicketReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
 	RemoveLockStub        func(string) (string, error)
 	removeLockMutex       sync.RWMutex
 	removeLockArgsForCall []struct {
@@ -101,9 +194,24 @@ type FakeLockHandler struct {
 		result1 string
 		result2 error
 	}
-	ResetLockStub        func() error
+	RenewLockStub        func(string, string) (string, error)
+	renewLockMutex       sync.RWMutex
+	renewLockArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	renewLockReturns struct {
+		result1 string
+		result2 error
+	}
+	renewLockReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	ResetLockStub        func(context.Context) error
 	resetLockMutex       sync.RWMutex
 	resetLockArgsForCall []struct {
+		arg1 context.Context
 	}
 	resetLockReturns struct {
 		result1 error
@@ -111,9 +219,22 @@ type FakeLockHandler struct {
 	resetLockReturnsOnCall map[int]struct {
 		result1 error
 	}
-	SetupStub        func() error
+	RollBackClaimsStub        func() (string, error)
+	rollBackClaimsMutex       sync.RWMutex
+	rollBackClaimsArgsForCall []struct {
+	}
+	rollBackClaimsReturns struct {
+		result1 string
+		result2 error
+	}
+	rollBackClaimsReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
+	SetupStub        func(context.Context) error
 	setupMutex       sync.RWMutex
 	setupArgsForCall []struct {
+		arg1 context.Context
 	}
 	setupReturns struct {
 		result1 error
@@ -121,10 +242,11 @@ type FakeLockHandler struct {
 	setupReturnsOnCall map[int]struct {
 		result1 error
 	}
-	UnclaimLockStub        func(string) (string, error)
+	UnclaimLockStub        func(string, string) (string, error)
 	unclaimLockMutex       sync.RWMutex
 	unclaimLockArgsForCall []struct {
 		arg1 string
+		arg2 string
 	}
 	unclaimLockReturns struct {
 		result1 string
@@ -148,6 +270,19 @@ type FakeLockHandler struct {
 		result1 string
 		result2 error
 	}
+	VerifyClaimStub        func(string, string, string) error
+	verifyClaimMutex       sync.RWMutex
+	verifyClaimArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}
+	verifyClaimReturns struct {
+		result1 error
+	}
+	verifyClaimReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -223,17 +358,18 @@ func (fake *FakeLockHandler) AddLockReturnsOnCall(i int, result1 string, result2
 	}{result1, result2}
 }
 
-func (fake *FakeLockHandler) BroadcastLockPool() (string, error) {
+func (fake *FakeLockHandler) BroadcastLockPool(arg1 context.Context) (string, error) {
 	fake.broadcastLockPoolMutex.Lock()
 	ret, specificReturn := fake.broadcastLockPoolReturnsOnCall[len(fake.broadcastLockPoolArgsForCall)]
 	fake.broadcastLockPoolArgsForCall = append(fake.broadcastLockPoolArgsForCall, struct {
-	}{})
+		arg1 context.Context
+	}{arg1})
 	stub := fake.BroadcastLockPoolStub
 	fakeReturns := fake.broadcastLockPoolReturns
-	fake.recordInvocation("BroadcastLockPool", []interface{}{})
+	fake.recordInvocation("BroadcastLockPool", []interface{}{arg1})
 	fake.broadcastLockPoolMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -247,12 +383,19 @@ func (fake *FakeLockHandler) BroadcastLockPoolCallCount() int {
 	return len(fake.broadcastLockPoolArgsForCall)
 }
 
-func (fake *FakeLockHandler) BroadcastLockPoolCalls(stub func() (string, error)) {
+func (fake *FakeLockHandler) BroadcastLockPoolCalls(stub func(context.Context) (string, error)) {
 	fake.broadcastLockPoolMutex.Lock()
 	defer fake.broadcastLockPoolMutex.Unlock()
 	fake.BroadcastLockPoolStub = stub
 }
 
+func (fake *FakeLockHandler) BroadcastLockPoolArgsForCall(i int) context.Context {
+	fake.broadcastLockPoolMutex.RLock()
+	defer fake.broadcastLockPoolMutex.RUnlock()
+	argsForCall := fake.broadcastLockPoolArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeLockHandler) BroadcastLockPoolReturns(result1 string, result2 error) {
 	fake.broadcastLockPoolMutex.Lock()
 	defer fake.broadcastLockPoolMutex.Unlock()
@@ -279,18 +422,19 @@ func (fake *FakeLockHandler) BroadcastLockPoolReturnsOnCall(i int, result1 strin
 	}{result1, result2}
 }
 
-func (fake *FakeLockHandler) CheckLock(arg1 string) (string, error) {
+func (fake *FakeLockHandler) CheckLock(arg1 string, arg2 out.ClaimMode) (string, error) {
 	fake.checkLockMutex.Lock()
 	ret, specificReturn := fake.checkLockReturnsOnCall[len(fake.checkLockArgsForCall)]
 	fake.checkLockArgsForCall = append(fake.checkLockArgsForCall, struct {
 		arg1 string
-	}{arg1})
+		arg2 out.ClaimMode
+	}{arg1, arg2})
 	stub := fake.CheckLockStub
 	fakeReturns := fake.checkLockReturns
-	fake.recordInvocation("CheckLock", []interface{}{arg1})
+	fake.recordInvocation("CheckLock", []interface{}{arg1, arg2})
 	fake.checkLockMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -304,17 +448,17 @@ func (fake *FakeLockHandler) CheckLockCallCount() int {
 	return len(fake.checkLockArgsForCall)
 }
 
-func (fake *FakeLockHandler) CheckLockCalls(stub func(string) (string, error)) {
+func (fake *FakeLockHandler) CheckLockCalls(stub func(string, out.ClaimMode) (string, error)) {
 	fake.checkLockMutex.Lock()
 	defer fake.checkLockMutex.Unlock()
 	fake.CheckLockStub = stub
 }
 
-func (fake *FakeLockHandler) CheckLockArgsForCall(i int) string {
+func (fake *FakeLockHandler) CheckLockArgsForCall(i int) (string, out.ClaimMode) {
 	fake.checkLockMutex.RLock()
 	defer fake.checkLockMutex.RUnlock()
 	argsForCall := fake.checkLockArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeLockHandler) CheckLockReturns(result1 string, result2 error) {
@@ -407,18 +551,19 @@ func (fake *FakeLockHandler) CheckUnclaimedLockReturnsOnCall(i int, result1 stri
 	}{result1, result2}
 }
 
-func (fake *FakeLockHandler) ClaimLock(arg1 string) (string, error) {
+func (fake *FakeLockHandler) ClaimLock(arg1 string, arg2 out.ClaimMode) (string, error) {
 	fake.claimLockMutex.Lock()
 	ret, specificReturn := fake.claimLockReturnsOnCall[len(fake.claimLockArgsForCall)]
 	fake.claimLockArgsForCall = append(fake.claimLockArgsForCall, struct {
 		arg1 string
-	}{arg1})
+		arg2 out.ClaimMode
+	}{arg1, arg2})
 	stub := fake.ClaimLockStub
 	fakeReturns := fake.claimLockReturns
-	fake.recordInvocation("ClaimLock", []interface{}{arg1})
+	fake.recordInvocation("ClaimLock", []interface{}{arg1, arg2})
 	fake.claimLockMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -432,17 +577,17 @@ func (fake *FakeLockHandler) ClaimLockCallCount() int {
 	return len(fake.claimLockArgsForCall)
 }
 
-func (fake *FakeLockHandler) ClaimLockCalls(stub func(string) (string, error)) {
+func (fake *FakeLockHandler) ClaimLockCalls(stub func(string, out.ClaimMode) (string, error)) {
 	fake.claimLockMutex.Lock()
 	defer fake.claimLockMutex.Unlock()
 	fake.ClaimLockStub = stub
 }
 
-func (fake *FakeLockHandler) ClaimLockArgsForCall(i int) string {
+func (fake *FakeLockHandler) ClaimLockArgsForCall(i int) (string, out.ClaimMode) {
 	fake.claimLockMutex.RLock()
 	defer fake.claimLockMutex.RUnlock()
 	argsForCall := fake.claimLockArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeLockHandler) ClaimLockReturns(result1 string, result2 error) {
@@ -471,17 +616,195 @@ func (fake *FakeLockHandler) ClaimLockReturnsOnCall(i int, result1 string, resul
 	}{result1, result2}
 }
 
-func (fake *FakeLockHandler) GrabAvailableLock() (string, string, error) {
+func (fake *FakeLockHandler) Cleanup() error {
+	fake.cleanupMutex.Lock()
+	ret, specificReturn := fake.cleanupReturnsOnCall[len(fake.cleanupArgsForCall)]
+	fake.cleanupArgsForCall = append(fake.cleanupArgsForCall, struct {
+	}{})
+	stub := fake.CleanupStub
+	fakeReturns := fake.cleanupReturns
+	fake.recordInvocation("Cleanup", []interface{}{})
+	fake.cleanupMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeLockHandler) CleanupCallCount() int {
+	fake.cleanupMutex.RLock()
+	defer fake.cleanupMutex.RUnlock()
+	return len(fake.cleanupArgsForCall)
+}
+
+func (fake *FakeLockHandler) CleanupCalls(stub func() error) {
+	fake.cleanupMutex.Lock()
+	defer fake.cleanupMutex.Unlock()
+	fake.CleanupStub = stub
+}
+
+func (fake *FakeLockHandler) CleanupReturns(result1 error) {
+	fake.cleanupMutex.Lock()
+	defer fake.cleanupMutex.Unlock()
+	fake.CleanupStub = nil
+	fake.cleanupReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLockHandler) CleanupReturnsOnCall(i int, result1 error) {
+	fake.cleanupMutex.Lock()
+	defer fake.cleanupMutex.Unlock()
+	fake.CleanupStub = nil
+	if fake.cleanupReturnsOnCall == nil {
+		fake.cleanupReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.cleanupReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLockHandler) CurrentVersion() (string, error) {
+	fake.currentVersionMutex.Lock()
+	ret, specificReturn := fake.currentVersionReturnsOnCall[len(fake.currentVersionArgsForCall)]
+	fake.currentVersionArgsForCall = append(fake.currentVersionArgsForCall, struct {
+	}{})
+	stub := fake.CurrentVersionStub
+	fakeReturns := fake.currentVersionReturns
+	fake.recordInvocation("CurrentVersion", []interface{}{})
+	fake.currentVersionMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) CurrentVersionCallCount() int {
+	fake.currentVersionMutex.RLock()
+	defer fake.currentVersionMutex.RUnlock()
+	return len(fake.currentVersionArgsForCall)
+}
+
+func (fake *FakeLockHandler) CurrentVersionCalls(stub func() (string, error)) {
+	fake.currentVersionMutex.Lock()
+	defer fake.currentVersionMutex.Unlock()
+	fake.CurrentVersionStub = stub
+}
+
+func (fake *FakeLockHandler) CurrentVersionReturns(result1 string, result2 error) {
+	fake.currentVersionMutex.Lock()
+	defer fake.currentVersionMutex.Unlock()
+	fake.CurrentVersionStub = nil
+	fake.currentVersionReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) CurrentVersionReturnsOnCall(i int, result1 string, result2 error) {
+	fake.currentVersionMutex.Lock()
+	defer fake.currentVersionMutex.Unlock()
+	fake.CurrentVersionStub = nil
+	if fake.currentVersionReturnsOnCall == nil {
+		fake.currentVersionReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.currentVersionReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) Enqueue(arg1 string, arg2 int) (string, string, error) {
+	fake.enqueueMutex.Lock()
+	ret, specificReturn := fake.enqueueReturnsOnCall[len(fake.enqueueArgsForCall)]
+	fake.enqueueArgsForCall = append(fake.enqueueArgsForCall, struct {
+		arg1 string
+		arg2 int
+	}{arg1, arg2})
+	stub := fake.EnqueueStub
+	fakeReturns := fake.enqueueReturns
+	fake.recordInvocation("Enqueue", []interface{}{arg1, arg2})
+	fake.enqueueMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2, ret.result3
+	}
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+}
+
+func (fake *FakeLockHandler) EnqueueCallCount() int {
+	fake.enqueueMutex.RLock()
+	defer fake.enqueueMutex.RUnlock()
+	return len(fake.enqueueArgsForCall)
+}
+
+func (fake *FakeLockHandler) EnqueueCalls(stub func(string, int) (string, string, error)) {
+	fake.enqueueMutex.Lock()
+	defer fake.enqueueMutex.Unlock()
+	fake.EnqueueStub = stub
+}
+
+func (fake *FakeLockHandler) EnqueueArgsForCall(i int) (string, int) {
+	fake.enqueueMutex.RLock()
+	defer fake.enqueueMutex.RUnlock()
+	argsForCall := fake.enqueueArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeLockHandler) EnqueueReturns(result1 string, result2 string, result3 error) {
+	fake.enqueueMutex.Lock()
+	defer fake.enqueueMutex.Unlock()
+	fake.EnqueueStub = nil
+	fake.enqueueReturns = struct {
+		result1 string
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeLockHandler) EnqueueReturnsOnCall(i int, result1 string, result2 string, result3 error) {
+	fake.enqueueMutex.Lock()
+	defer fake.enqueueMutex.Unlock()
+	fake.EnqueueStub = nil
+	if fake.enqueueReturnsOnCall == nil {
+		fake.enqueueReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 string
+			result3 error
+		})
+	}
+	fake.enqueueReturnsOnCall[i] = struct {
+		result1 string
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeLockHandler) GrabAvailableLock(arg1 out.AcquireParams) (map[string][]string, string, error) {
 	fake.grabAvailableLockMutex.Lock()
 	ret, specificReturn := fake.grabAvailableLockReturnsOnCall[len(fake.grabAvailableLockArgsForCall)]
 	fake.grabAvailableLockArgsForCall = append(fake.grabAvailableLockArgsForCall, struct {
-	}{})
+		arg1 out.AcquireParams
+	}{arg1})
 	stub := fake.GrabAvailableLockStub
 	fakeReturns := fake.grabAvailableLockReturns
-	fake.recordInvocation("GrabAvailableLock", []interface{}{})
+	fake.recordInvocation("GrabAvailableLock", []interface{}{arg1})
 	fake.grabAvailableLockMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2, ret.result3
@@ -495,41 +818,288 @@ func (fake *FakeLockHandler) GrabAvailableLockCallCount() int {
 	return len(fake.grabAvailableLockArgsForCall)
 }
 
-func (fake *FakeLockHandler) GrabAvailableLockCalls(stub func() (string, string, error)) {
+func (fake *FakeLockHandler) GrabAvailableLockCalls(stub func(out.AcquireParams) (map[string][]string, string, error)) {
 	fake.grabAvailableLockMutex.Lock()
 	defer fake.grabAvailableLockMutex.Unlock()
 	fake.GrabAvailableLockStub = stub
 }
 
-func (fake *FakeLockHandler) GrabAvailableLockReturns(result1 string, result2 string, result3 error) {
+func (fake *FakeLockHandler) GrabAvailableLockArgsForCall(i int) out.AcquireParams {
+	fake.grabAvailableLockMutex.RLock()
+	defer fake.grabAvailableLockMutex.RUnlock()
+	argsForCall := fake.grabAvailableLockArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLockHandler) GrabAvailableLockReturns(result1 map[string][]string, result2 string, result3 error) {
 	fake.grabAvailableLockMutex.Lock()
 	defer fake.grabAvailableLockMutex.Unlock()
 	fake.GrabAvailableLockStub = nil
 	fake.grabAvailableLockReturns = struct {
-		result1 string
+		result1 map[string][]string
 		result2 string
 		result3 error
 	}{result1, result2, result3}
 }
 
-func (fake *FakeLockHandler) GrabAvailableLockReturnsOnCall(i int, result1 string, result2 string, result3 error) {
+func (fake *FakeLockHandler) GrabAvailableLockReturnsOnCall(i int, result1 map[string][]string, result2 string, result3 error) {
 	fake.grabAvailableLockMutex.Lock()
 	defer fake.grabAvailableLockMutex.Unlock()
 	fake.GrabAvailableLockStub = nil
 	if fake.grabAvailableLockReturnsOnCall == nil {
 		fake.grabAvailableLockReturnsOnCall = make(map[int]struct {
-			result1 string
+			result1 map[string][]string
 			result2 string
 			result3 error
 		})
 	}
 	fake.grabAvailableLockReturnsOnCall[i] = struct {
-		result1 string
+		result1 map[string][]string
 		result2 string
 		result3 error
 	}{result1, result2, result3}
 }
 
+func (fake *FakeLockHandler) Holders(arg1 string) ([]out.Holder, error) {
+	fake.holdersMutex.Lock()
+	ret, specificReturn := fake.holdersReturnsOnCall[len(fake.holdersArgsForCall)]
+	fake.holdersArgsForCall = append(fake.holdersArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.HoldersStub
+	fakeReturns := fake.holdersReturns
+	fake.recordInvocation("Holders", []interface{}{arg1})
+	fake.holdersMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) HoldersCallCount() int {
+	fake.holdersMutex.RLock()
+	defer fake.holdersMutex.RUnlock()
+	return len(fake.holdersArgsForCall)
+}
+
+func (fake *FakeLockHandler) HoldersCalls(stub func(string) ([]out.Holder, error)) {
+	fake.holdersMutex.Lock()
+	defer fake.holdersMutex.Unlock()
+	fake.HoldersStub = stub
+}
+
+func (fake *FakeLockHandler) HoldersArgsForCall(i int) string {
+	fake.holdersMutex.RLock()
+	defer fake.holdersMutex.RUnlock()
+	argsForCall := fake.holdersArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLockHandler) HoldersReturns(result1 []out.Holder, result2 error) {
+	fake.holdersMutex.Lock()
+	defer fake.holdersMutex.Unlock()
+	fake.HoldersStub = nil
+	fake.holdersReturns = struct {
+		result1 []out.Holder
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) HoldersReturnsOnCall(i int, result1 []out.Holder, result2 error) {
+	fake.holdersMutex.Lock()
+	defer fake.holdersMutex.Unlock()
+	fake.HoldersStub = nil
+	if fake.holdersReturnsOnCall == nil {
+		fake.holdersReturnsOnCall = make(map[int]struct {
+			result1 []out.Holder
+			result2 error
+		})
+	}
+	fake.holdersReturnsOnCall[i] = struct {
+		result1 []out.Holder
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) LeaveQueue() (string, error) {
+	fake.leaveQueueMutex.Lock()
+	ret, specificReturn := fake.leaveQueueReturnsOnCall[len(fake.leaveQueueArgsForCall)]
+	fake.leaveQueueArgsForCall = append(fake.leaveQueueArgsForCall, struct {
+	}{})
+	stub := fake.LeaveQueueStub
+	fakeReturns := fake.leaveQueueReturns
+	fake.recordInvocation("LeaveQueue", []interface{}{})
+	fake.leaveQueueMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) LeaveQueueCallCount() int {
+	fake.leaveQueueMutex.RLock()
+	defer fake.leaveQueueMutex.RUnlock()
+	return len(fake.leaveQueueArgsForCall)
+}
+
+func (fake *FakeLockHandler) LeaveQueueCalls(stub func() (string, error)) {
+	fake.leaveQueueMutex.Lock()
+	defer fake.leaveQueueMutex.Unlock()
+	fake.LeaveQueueStub = stub
+}
+
+func (fake *FakeLockHandler) LeaveQueueReturns(result1 string, result2 error) {
+	fake.leaveQueueMutex.Lock()
+	defer fake.leaveQueueMutex.Unlock()
+	fake.LeaveQueueStub = nil
+	fake.leaveQueueReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) LeaveQueueReturnsOnCall(i int, result1 string, result2 error) {
+	fake.leaveQueueMutex.Lock()
+	defer fake.leaveQueueMutex.Unlock()
+	fake.LeaveQueueStub = nil
+	if fake.leaveQueueReturnsOnCall == nil {
+		fake.leaveQueueReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.leaveQueueReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) PushedVersion(arg1 string) (string, error) {
+	fake.pushedVersionMutex.Lock()
+	ret, specificReturn := fake.pushedVersionReturnsOnCall[len(fake.pushedVersionArgsForCall)]
+	fake.pushedVersionArgsForCall = append(fake.pushedVersionArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.PushedVersionStub
+	fakeReturns := fake.pushedVersionReturns
+	fake.recordInvocation("PushedVersion", []interface{}{arg1})
+	fake.pushedVersionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) PushedVersionCallCount() int {
+	fake.pushedVersionMutex.RLock()
+	defer fake.pushedVersionMutex.RUnlock()
+	return len(fake.pushedVersionArgsForCall)
+}
+
+func (fake *FakeLockHandler) PushedVersionCalls(stub func(string) (string, error)) {
+	fake.pushedVersionMutex.Lock()
+	defer fake.pushedVersionMutex.Unlock()
+	fake.PushedVersionStub = stub
+}
+
+func (fake *FakeLockHandler) PushedVersionArgsForCall(i int) string {
+	fake.pushedVersionMutex.RLock()
+	defer fake.pushedVersionMutex.RUnlock()
+	argsForCall := fake.pushedVersionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLockHandler) PushedVersionReturns(result1 string, result2 error) {
+	fake.pushedVersionMutex.Lock()
+	defer fake.pushedVersionMutex.Unlock()
+	fake.PushedVersionStub = nil
+	fake.pushedVersionReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) PushedVersionReturnsOnCall(i int, result1 string, result2 error) {
+	fake.pushedVersionMutex.Lock()
+	defer fake.pushedVersionMutex.Unlock()
+	fake.PushedVersionStub = nil
+	if fake.pushedVersionReturnsOnCall == nil {
+		fake.pushedVersionReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.pushedVersionReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) RefreshTicket() (string, error) {
+	fake.refreshTicketMutex.Lock()
+	ret, specificReturn := fake.refreshTicketReturnsOnCall[len(fake.refreshTicketArgsForCall)]
+	fake.refreshTicketArgsForCall = append(fake.refreshTicketArgsForCall, struct {
+	}{})
+	stub := fake.RefreshTicketStub
+	fakeReturns := fake.refreshTicketReturns
+	fake.recordInvocation("RefreshTicket", []interface{}{})
+	fake.refreshTicketMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) RefreshTicketCallCount() int {
+	fake.refreshTicketMutex.RLock()
+	defer fake.refreshTicketMutex.RUnlock()
+	return len(fake.refreshTicketArgsForCall)
+}
+
+func (fake *FakeLockHandler) RefreshTicketCalls(stub func() (string, error)) {
+	fake.refreshTicketMutex.Lock()
+	defer fake.refreshTicketMutex.Unlock()
+	fake.RefreshTicketStub = stub
+}
+
+func (fake *FakeLockHandler) RefreshTicketReturns(result1 string, result2 error) {
+	fake.refreshTicketMutex.Lock()
+	defer fake.refreshTicketMutex.Unlock()
+	fake.RefreshTicketStub = nil
+	fake.refreshTicketReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) RefreshTicketReturnsOnCall(i int, result1 string, result2 error) {
+	fake.refreshTicketMutex.Lock()
+	defer fake.refreshTicketMutex.Unlock()
+	fake.RefreshTicketStub = nil
+	if fake.refreshTicketReturnsOnCall == nil {
+		fake.refreshTicketReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.refreshTicketReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeLockHandler) RemoveLock(arg1 string) (string, error) {
 	fake.removeLockMutex.Lock()
 	ret, specificReturn := fake.removeLockReturnsOnCall[len(fake.removeLockArgsForCall)]
@@ -594,17 +1164,83 @@ func (fake *FakeLockHandler) RemoveLockReturnsOnCall(i int, result1 string, resu
 	}{result1, result2}
 }
 
-func (fake *FakeLockHandler) ResetLock() error {
+func (fake *FakeLockHandler) RenewLock(arg1 string, arg2 string) (string, error) {
+	fake.renewLockMutex.Lock()
+	ret, specificReturn := fake.renewLockReturnsOnCall[len(fake.renewLockArgsForCall)]
+	fake.renewLockArgsForCall = append(fake.renewLockArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.RenewLockStub
+	fakeReturns := fake.renewLockReturns
+	fake.recordInvocation("RenewLock", []interface{}{arg1, arg2})
+	fake.renewLockMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) RenewLockCallCount() int {
+	fake.renewLockMutex.RLock()
+	defer fake.renewLockMutex.RUnlock()
+	return len(fake.renewLockArgsForCall)
+}
+
+func (fake *FakeLockHandler) RenewLockCalls(stub func(string, string) (string, error)) {
+	fake.renewLockMutex.Lock()
+	defer fake.renewLockMutex.Unlock()
+	fake.RenewLockStub = stub
+}
+
+func (fake *FakeLockHandler) RenewLockArgsForCall(i int) (string, string) {
+	fake.renewLockMutex.RLock()
+	defer fake.renewLockMutex.RUnlock()
+	argsForCall := fake.renewLockArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeLockHandler) RenewLockReturns(result1 string, result2 error) {
+	fake.renewLockMutex.Lock()
+	defer fake.renewLockMutex.Unlock()
+	fake.RenewLockStub = nil
+	fake.renewLockReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) RenewLockReturnsOnCall(i int, result1 string, result2 error) {
+	fake.renewLockMutex.Lock()
+	defer fake.renewLockMutex.Unlock()
+	fake.RenewLockStub = nil
+	if fake.renewLockReturnsOnCall == nil {
+		fake.renewLockReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.renewLockReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) ResetLock(arg1 context.Context) error {
 	fake.resetLockMutex.Lock()
 	ret, specificReturn := fake.resetLockReturnsOnCall[len(fake.resetLockArgsForCall)]
 	fake.resetLockArgsForCall = append(fake.resetLockArgsForCall, struct {
-	}{})
+		arg1 context.Context
+	}{arg1})
 	stub := fake.ResetLockStub
 	fakeReturns := fake.resetLockReturns
-	fake.recordInvocation("ResetLock", []interface{}{})
+	fake.recordInvocation("ResetLock", []interface{}{arg1})
 	fake.resetLockMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -618,12 +1254,19 @@ func (fake *FakeLockHandler) ResetLockCallCount() int {
 	return len(fake.resetLockArgsForCall)
 }
 
-func (fake *FakeLockHandler) ResetLockCalls(stub func() error) {
+func (fake *FakeLockHandler) ResetLockCalls(stub func(context.Context) error) {
 	fake.resetLockMutex.Lock()
 	defer fake.resetLockMutex.Unlock()
 	fake.ResetLockStub = stub
 }
 
+func (fake *FakeLockHandler) ResetLockArgsForCall(i int) context.Context {
+	fake.resetLockMutex.RLock()
+	defer fake.resetLockMutex.RUnlock()
+	argsForCall := fake.resetLockArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeLockHandler) ResetLockReturns(result1 error) {
 	fake.resetLockMutex.Lock()
 	defer fake.resetLockMutex.Unlock()
@@ -647,17 +1290,74 @@ func (fake *FakeLockHandler) ResetLockReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeLockHandler) Setup() error {
+func (fake *FakeLockHandler) RollBackClaims() (string, error) {
+	fake.rollBackClaimsMutex.Lock()
+	ret, specificReturn := fake.rollBackClaimsReturnsOnCall[len(fake.rollBackClaimsArgsForCall)]
+	fake.rollBackClaimsArgsForCall = append(fake.rollBackClaimsArgsForCall, struct {
+	}{})
+	stub := fake.RollBackClaimsStub
+	fakeReturns := fake.rollBackClaimsReturns
+	fake.recordInvocation("RollBackClaims", []interface{}{})
+	fake.rollBackClaimsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeLockHandler) RollBackClaimsCallCount() int {
+	fake.rollBackClaimsMutex.RLock()
+	defer fake.rollBackClaimsMutex.RUnlock()
+	return len(fake.rollBackClaimsArgsForCall)
+}
+
+func (fake *FakeLockHandler) RollBackClaimsCalls(stub func() (string, error)) {
+	fake.rollBackClaimsMutex.Lock()
+	defer fake.rollBackClaimsMutex.Unlock()
+	fake.RollBackClaimsStub = stub
+}
+
+func (fake *FakeLockHandler) RollBackClaimsReturns(result1 string, result2 error) {
+	fake.rollBackClaimsMutex.Lock()
+	defer fake.rollBackClaimsMutex.Unlock()
+	fake.RollBackClaimsStub = nil
+	fake.rollBackClaimsReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) RollBackClaimsReturnsOnCall(i int, result1 string, result2 error) {
+	fake.rollBackClaimsMutex.Lock()
+	defer fake.rollBackClaimsMutex.Unlock()
+	fake.RollBackClaimsStub = nil
+	if fake.rollBackClaimsReturnsOnCall == nil {
+		fake.rollBackClaimsReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.rollBackClaimsReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeLockHandler) Setup(arg1 context.Context) error {
 	fake.setupMutex.Lock()
 	ret, specificReturn := fake.setupReturnsOnCall[len(fake.setupArgsForCall)]
 	fake.setupArgsForCall = append(fake.setupArgsForCall, struct {
-	}{})
+		arg1 context.Context
+	}{arg1})
 	stub := fake.SetupStub
 	fakeReturns := fake.setupReturns
-	fake.recordInvocation("Setup", []interface{}{})
+	fake.recordInvocation("Setup", []interface{}{arg1})
 	fake.setupMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
@@ -671,12 +1371,19 @@ func (fake *FakeLockHandler) SetupCallCount() int {
 	return len(fake.setupArgsForCall)
 }
 
-func (fake *FakeLockHandler) SetupCalls(stub func() error) {
+func (fake *FakeLockHandler) SetupCalls(stub func(context.Context) error) {
 	fake.setupMutex.Lock()
 	defer fake.setupMutex.Unlock()
 	fake.SetupStub = stub
 }
 
+func (fake *FakeLockHandler) SetupArgsForCall(i int) context.Context {
+	fake.setupMutex.RLock()
+	defer fake.setupMutex.RUnlock()
+	argsForCall := fake.setupArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeLockHandler) SetupReturns(result1 error) {
 	fake.setupMutex.Lock()
 	defer fake.setupMutex.Unlock()
@@ -700,18 +1407,19 @@ func (fake *FakeLockHandler) SetupReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeLockHandler) UnclaimLock(arg1 string) (string, error) {
+func (fake *FakeLockHandler) UnclaimLock(arg1 string, arg2 string) (string, error) {
 	fake.unclaimLockMutex.Lock()
 	ret, specificReturn := fake.unclaimLockReturnsOnCall[len(fake.unclaimLockArgsForCall)]
 	fake.unclaimLockArgsForCall = append(fake.unclaimLockArgsForCall, struct {
 		arg1 string
-	}{arg1})
+		arg2 string
+	}{arg1, arg2})
 	stub := fake.UnclaimLockStub
 	fakeReturns := fake.unclaimLockReturns
-	fake.recordInvocation("UnclaimLock", []interface{}{arg1})
+	fake.recordInvocation("UnclaimLock", []interface{}{arg1, arg2})
 	fake.unclaimLockMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -725,17 +1433,17 @@ func (fake *FakeLockHandler) UnclaimLockCallCount() int {
 	return len(fake.unclaimLockArgsForCall)
 }
 
-func (fake *FakeLockHandler) UnclaimLockCalls(stub func(string) (string, error)) {
+func (fake *FakeLockHandler) UnclaimLockCalls(stub func(string, string) (string, error)) {
 	fake.unclaimLockMutex.Lock()
 	defer fake.unclaimLockMutex.Unlock()
 	fake.UnclaimLockStub = stub
 }
 
-func (fake *FakeLockHandler) UnclaimLockArgsForCall(i int) string {
+func (fake *FakeLockHandler) UnclaimLockArgsForCall(i int) (string, string) {
 	fake.unclaimLockMutex.RLock()
 	defer fake.unclaimLockMutex.RUnlock()
 	argsForCall := fake.unclaimLockArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeLockHandler) UnclaimLockReturns(result1 string, result2 error) {
@@ -834,6 +1542,69 @@ func (fake *FakeLockHandler) UpdateLockReturnsOnCall(i int, result1 string, resu
 	}{result1, result2}
 }
 
+func (fake *FakeLockHandler) VerifyClaim(arg1 string, arg2 string, arg3 string) error {
+	fake.verifyClaimMutex.Lock()
+	ret, specificReturn := fake.verifyClaimReturnsOnCall[len(fake.verifyClaimArgsForCall)]
+	fake.verifyClaimArgsForCall = append(fake.verifyClaimArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.VerifyClaimStub
+	fakeReturns := fake.verifyClaimReturns
+	fake.recordInvocation("VerifyClaim", []interface{}{arg1, arg2, arg3})
+	fake.verifyClaimMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeLockHandler) VerifyClaimCallCount() int {
+	fake.verifyClaimMutex.RLock()
+	defer fake.verifyClaimMutex.RUnlock()
+	return len(fake.verifyClaimArgsForCall)
+}
+
+func (fake *FakeLockHandler) VerifyClaimCalls(stub func(string, string, string) error) {
+	fake.verifyClaimMutex.Lock()
+	defer fake.verifyClaimMutex.Unlock()
+	fake.VerifyClaimStub = stub
+}
+
+func (fake *FakeLockHandler) VerifyClaimArgsForCall(i int) (string, string, string) {
+	fake.verifyClaimMutex.RLock()
+	defer fake.verifyClaimMutex.RUnlock()
+	argsForCall := fake.verifyClaimArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeLockHandler) VerifyClaimReturns(result1 error) {
+	fake.verifyClaimMutex.Lock()
+	defer fake.verifyClaimMutex.Unlock()
+	fake.VerifyClaimStub = nil
+	fake.verifyClaimReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLockHandler) VerifyClaimReturnsOnCall(i int, result1 error) {
+	fake.verifyClaimMutex.Lock()
+	defer fake.verifyClaimMutex.Unlock()
+	fake.VerifyClaimStub = nil
+	if fake.verifyClaimReturnsOnCall == nil {
+		fake.verifyClaimReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.verifyClaimReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeLockHandler) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -847,18 +1618,38 @@ func (fake *FakeLockHandler) Invocations() map[string][][]interface{} {
 	defer fake.checkUnclaimedLockMutex.RUnlock()
 	fake.claimLockMutex.RLock()
 	defer fake.claimLockMutex.RUnlock()
+	fake.cleanupMutex.RLock()
+	defer fake.cleanupMutex.RUnlock()
+	fake.currentVersionMutex.RLock()
+	defer fake.currentVersionMutex.RUnlock()
+	fake.enqueueMutex.RLock()
+	defer fake.enqueueMutex.RUnlock()
 	fake.grabAvailableLockMutex.RLock()
 	defer fake.grabAvailableLockMutex.RUnlock()
+	fake.holdersMutex.RLock()
+	defer fake.holdersMutex.RUnlock()
+	fake.leaveQueueMutex.RLock()
+	defer fake.leaveQueueMutex.RUnlock()
+	fake.pushedVersionMutex.RLock()
+	defer fake.pushedVersionMutex.RUnlock()
+	fake.refreshTicketMutex.RLock()
+	defer fake.refreshTicketMutex.RUnlock()
 	fake.removeLockMutex.RLock()
 	defer fake.removeLockMutex.RUnlock()
+	fake.renewLockMutex.RLock()
+	defer fake.renewLockMutex.RUnlock()
 	fake.resetLockMutex.RLock()
 	defer fake.resetLockMutex.RUnlock()
+	fake.rollBackClaimsMutex.RLock()
+	defer fake.rollBackClaimsMutex.RUnlock()
 	fake.setupMutex.RLock()
 	defer fake.setupMutex.RUnlock()
 	fake.unclaimLockMutex.RLock()
 	defer fake.unclaimLockMutex.RUnlock()
 	fake.updateLockMutex.RLock()
 	defer fake.updateLockMutex.RUnlock()
+	fake.verifyClaimMutex.RLock()
+	defer fake.verifyClaimMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
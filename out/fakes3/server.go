@@ -0,0 +1,138 @@
+// Package fakes3 serves just enough of the S3 API, in-process, to test the
+// s3 backend: getting and putting objects in path-style buckets, with
+// conditional puts. Requests are not authenticated.
+package fakes3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+type Server struct {
+	URL string
+
+	server *httptest.Server
+
+	lock    sync.Mutex
+	objects map[string]object
+	puts    int
+}
+
+type object struct {
+	contents []byte
+	etag     string
+}
+
+func New() *Server {
+	fake := &Server{objects: map[string]object{}}
+
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	fake.URL = fake.server.URL
+
+	return fake
+}
+
+func (fake *Server) Close() {
+	fake.server.Close()
+}
+
+// Object returns the contents of the object at bucket/key.
+func (fake *Server) Object(bucket string, key string) ([]byte, bool) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	obj, found := fake.objects[bucket+"/"+key]
+	return obj.contents, found
+}
+
+// PutObject replaces the object at bucket/key, as someone else would.
+func (fake *Server) PutObject(bucket string, key string, contents []byte) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.objects[bucket+"/"+key] = newObject(contents)
+}
+
+// Puts returns how many objects were put by requests, whether or not their
+// conditions held.
+func (fake *Server) Puts() int {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return fake.puts
+}
+
+func newObject(contents []byte) object {
+	sum := md5.Sum(contents)
+	return object{contents: contents, etag: `"` + hex.EncodeToString(sum[:]) + `"`}
+}
+
+func (fake *Server) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(name, "/") {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "only objects are supported")
+		return
+	}
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	existing, found := fake.objects[name]
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !found {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+
+		w.Header().Set("ETag", existing.etag)
+		w.Header().Set("Content-Length", fmt.Sprint(len(existing.contents)))
+		w.WriteHeader(http.StatusOK)
+
+		if r.Method == http.MethodGet {
+			w.Write(existing.contents)
+		}
+
+	case http.MethodPut:
+		fake.puts++
+
+		contents, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!found || ifMatch != existing.etag) {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == "*" && found {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+
+		obj := newObject(contents)
+		fake.objects[name] = obj
+
+		w.Header().Set("ETag", obj.etag)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+}
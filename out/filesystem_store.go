@@ -0,0 +1,246 @@
+package out
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// filesystemStateDir is where a pool kept on the filesystem keeps the
+// history of its files, relative to the directory of the pool.
+const filesystemStateDir = ".pool-resource"
+
+// filesystemStore keeps the files of a pool in a directory laid out like
+// the repository of a pool kept in git, e.g. on a mount shared by the
+// workers. Saving takes an exclusive lock on the directory, and replaces each
+// file it changes by renaming a new one over it, so that loading, which
+// takes a shared lock, never sees half of a change.
+type filesystemStore struct {
+	path   string
+	loaded PoolState
+}
+
+func newFilesystemStore(source Source) PoolStore {
+	return &filesystemStore{path: source.Path}
+}
+
+func (store *filesystemStore) Load(ctx context.Context) (PoolState, error) {
+	lock, err := store.lock(ctx, syscall.LOCK_SH)
+	if err != nil {
+		return PoolState{}, err
+	}
+	defer lock.Close()
+
+	state, err := store.readState()
+	if err != nil {
+		return PoolState{}, err
+	}
+
+	files, err := readFiles(store.path, filesystemStateDir)
+	if err != nil {
+		return PoolState{}, err
+	}
+
+	// the directory is what the pool is like, even if someone changed it by
+	// hand, e.g. to add a lock
+	known := state.Files
+	state.Files = map[string]StoredFile{}
+
+	for path, contents := range files {
+		file := known[path]
+		file.Contents = contents
+		state.Files[path] = file
+	}
+
+	store.loaded = state.Clone()
+
+	return state, nil
+}
+
+func (store *filesystemStore) Save(ctx context.Context, state PoolState) (int64, error) {
+	lock, err := store.lock(ctx, syscall.LOCK_EX)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+
+	current, err := store.readState()
+	if err != nil {
+		return 0, err
+	}
+
+	if current.Revision != store.loaded.Revision {
+		return 0, ErrLockConflict
+	}
+
+	for path, file := range state.Files {
+		loaded, found := store.loaded.Files[path]
+		if found && loaded.Contents == file.Contents {
+			continue
+		}
+
+		err := store.writeFile(filepath.Join(store.path, path), []byte(file.Contents))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for path := range store.loaded.Files {
+		if _, found := state.Files[path]; found {
+			continue
+		}
+
+		err := store.removeFile(path)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// the contents of the files that are still there are in the directory
+	saved := state.Clone()
+	for path, file := range saved.Files {
+		file.Contents = ""
+		saved.Files[path] = file
+	}
+
+	contents, err := json.Marshal(saved)
+	if err != nil {
+		return 0, err
+	}
+
+	err = store.writeFile(store.statePath(), contents)
+	if err != nil {
+		return 0, err
+	}
+
+	store.loaded = state.Clone()
+
+	return state.Revision, nil
+}
+
+// lock takes a lock on the directory of the pool, either a shared lock or an
+// exclusive one depending on how.
+func (store *filesystemStore) lock(ctx context.Context, how int) (*os.File, error) {
+	_, err := os.Stat(store.path)
+	if err != nil {
+		return nil, fmt.Errorf("pool directory: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Join(store.path, filesystemStateDir), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return waitForLockFile(ctx, filepath.Join(store.path, filesystemStateDir, "lock"), how)
+}
+
+func (store *filesystemStore) statePath() string {
+	return filepath.Join(store.path, filesystemStateDir, "state.json")
+}
+
+// readState reads the history of the files, which is empty until the pool
+// is first changed.
+func (store *filesystemStore) readState() (PoolState, error) {
+	var state PoolState
+
+	contents, err := os.ReadFile(store.statePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(contents, &state)
+	if err != nil {
+		return state, fmt.Errorf("reading %s: %w", store.statePath(), err)
+	}
+
+	return state, nil
+}
+
+// writeFile replaces the file at path by renaming a new one over it. The new
+// file is written next to the state of the pool, which keeps it from being
+// taken for a file of the pool if writing it is cut short.
+func (store *filesystemStore) writeFile(path string, contents []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Join(store.path, filesystemStateDir), "new-file")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(contents)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// removeFile removes a file of the pool, along with the directories it
+// leaves empty, as a clone of a repository would.
+func (store *filesystemStore) removeFile(path string) error {
+	err := os.Remove(filepath.Join(store.path, path))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		err := os.Remove(filepath.Join(store.path, dir))
+		if err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// readFiles reads the contents of every file within root, by their paths
+// relative to it, other than those within skip.
+func readFiles(root string, skip string) (map[string]string, error) {
+	files := map[string]string{}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if relativePath == skip {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(relativePath)] = string(contents)
+		return nil
+	})
+
+	return files, err
+}
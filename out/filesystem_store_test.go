@@ -0,0 +1,163 @@
+package out_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Filesystem store", func() {
+	var (
+		poolDir string
+		source  out.Source
+	)
+
+	BeforeEach(func() {
+		var err error
+		poolDir, err = os.MkdirTemp("", "pool-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		for _, dir := range []string{"unclaimed", "claimed"} {
+			err := os.MkdirAll(filepath.Join(poolDir, "lock-pool", dir), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(poolDir, "lock-pool", dir, ".gitkeep"), nil, 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		err = os.WriteFile(filepath.Join(poolDir, "lock-pool", "unclaimed", "some-lock"), []byte("{}\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		source = out.Source{
+			Backend:    "filesystem",
+			Path:       poolDir,
+			Pool:       "lock-pool",
+			RetryDelay: 10 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(poolDir)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("loads the files in the directory, leaving out its own", func() {
+		store := out.NewPoolStore(source)
+
+		state, err := store.Load(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(state.Revision).Should(BeZero())
+		Ω(state.Contents()).Should(Equal(map[string]string{
+			"lock-pool/unclaimed/.gitkeep":  "",
+			"lock-pool/unclaimed/some-lock": "{}\n",
+			"lock-pool/claimed/.gitkeep":    "",
+		}))
+
+		Ω(filepath.Join(poolDir, ".pool-resource")).Should(BeADirectory())
+	})
+
+	It("saves the files, removing those that are gone and the directories they leave empty", func() {
+		store := out.NewPoolStore(source)
+
+		state, err := store.Load(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		files := state.Contents()
+		delete(files, "lock-pool/unclaimed/some-lock")
+		files["lock-pool/claimed/some-lock"] = "{}\n"
+		files["lock-pool/claims/some-lock/some-claim"] = `{"owner":"me"}`
+		state.Commit(files, "claiming: some-lock")
+
+		_, err = store.Save(context.Background(), state)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(filepath.Join(poolDir, "lock-pool", "unclaimed", "some-lock")).ShouldNot(BeAnExistingFile())
+		Ω(filepath.Join(poolDir, "lock-pool", "claimed", "some-lock")).Should(BeARegularFile())
+		Ω(filepath.Join(poolDir, "lock-pool", "claims", "some-lock", "some-claim")).Should(BeARegularFile())
+
+		files = state.Contents()
+		delete(files, "lock-pool/claims/some-lock/some-claim")
+		state.Commit(files, "releasing: some-lock")
+
+		_, err = store.Save(context.Background(), state)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(filepath.Join(poolDir, "lock-pool", "claims")).ShouldNot(BeAnExistingFile())
+
+		reloaded, err := out.NewPoolStore(source).Load(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(reloaded.Revision).Should(Equal(int64(2)))
+		Ω(reloaded.Log).Should(Equal(state.Log))
+		Ω(reloaded.Contents()).Should(Equal(state.Contents()))
+	})
+
+	It("keeps files added to the directory by hand", func() {
+		store := out.NewPoolStore(source)
+
+		state, err := store.Load(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.WriteFile(filepath.Join(poolDir, "lock-pool", "unclaimed", "some-other-lock"), []byte("{}\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		files := state.Contents()
+		files["lock-pool/claimed/some-lock"] = files["lock-pool/unclaimed/some-lock"]
+		delete(files, "lock-pool/unclaimed/some-lock")
+		state.Commit(files, "claiming: some-lock")
+
+		_, err = store.Save(context.Background(), state)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(filepath.Join(poolDir, "lock-pool", "unclaimed", "some-other-lock")).Should(BeARegularFile())
+
+		state, err = store.Load(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(state.Contents()).Should(HaveKey("lock-pool/unclaimed/some-other-lock"))
+	})
+
+	It("reports a conflict when someone else saved a change to any lock in the meantime, as the revision moved on", func() {
+		stores := []out.PoolStore{out.NewPoolStore(source), out.NewPoolStore(source)}
+
+		var states []out.PoolState
+		for _, store := range stores {
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			states = append(states, state)
+		}
+
+		files := states[0].Contents()
+		files["lock-pool/unclaimed/some-other-lock"] = "{}\n"
+		states[0].Commit(files, "adding some-other-lock")
+
+		_, err := stores[0].Save(context.Background(), states[0])
+		Ω(err).ShouldNot(HaveOccurred())
+
+		files = states[1].Contents()
+		files["lock-pool/claimed/some-lock"] = files["lock-pool/unclaimed/some-lock"]
+		delete(files, "lock-pool/unclaimed/some-lock")
+		states[1].Commit(files, "claiming: some-lock")
+
+		_, err = stores[1].Save(context.Background(), states[1])
+		Ω(err).Should(Equal(out.ErrLockConflict))
+	})
+
+	It("fails when the directory of the pool does not exist", func() {
+		source.Path = filepath.Join(poolDir, "bogus")
+
+		_, err := out.NewPoolStore(source).Load(context.Background())
+		Ω(err).Should(MatchError(ContainSubstring("pool directory")))
+	})
+
+	itIsAPoolStore(
+		func() out.PoolStore { return out.NewPoolStore(source) },
+		func() out.Source { return source },
+	)
+})
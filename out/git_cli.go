@@ -0,0 +1,264 @@
+package out
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const falsePushString = "Everything up-to-date"
+const pushRejectedString = "[rejected]"
+const pushRemoteRejectedString = "[remote rejected]"
+
+// gitCLI runs the git binary, which is configured by the scripts wrapping
+// the resource, e.g. with the private key of the source.
+type gitCLI struct {
+	source Source
+	dir    string
+}
+
+func newGitCLI(source Source) gitEngine {
+	return &gitCLI{source: source}
+}
+
+// Clone makes a shallow clone, which is deepened the first time the history
+// of the pool is needed.
+func (cli *gitCLI) Clone(ctx context.Context, dir string) error {
+	cli.dir = dir
+
+	args := []string{"clone", "--depth", "1", "--single-branch", "--branch", cli.source.Branch}
+	args = append(args, SparseCloneArgs(cli.source)...)
+	args = append(args, cli.source.URI, dir)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	err := cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	err = cli.sparseCheckout()
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.output("config", "user.name")
+	if err != nil {
+		// hardcode git user.name if not already set in git_config
+		err := cli.run("config", "user.name", "CI Pool Resource")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = cli.output("config", "user.email")
+	if err != nil {
+		// hardcode git user.email if not already set in git_config
+		err := cli.run("config", "user.email", "ci-pool@localhost")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cli *gitCLI) Open(dir string) error {
+	cli.dir = dir
+
+	uri, err := cli.output("config", "remote.origin.url")
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(uri) != cli.source.URI {
+		return fmt.Errorf("%s is not a clone of %s", dir, cli.source.URI)
+	}
+
+	// an earlier put may have used the clone for other pools
+	return cli.sparseCheckout()
+}
+
+// sparseCheckout only checks out the pool of the source in a sparse clone.
+func (cli *gitCLI) sparseCheckout() error {
+	if !cli.source.SparseClone {
+		return nil
+	}
+
+	return cli.run("sparse-checkout", "set", "--cone", cli.source.Pool)
+}
+
+func (cli *gitCLI) Include(dirs ...string) error {
+	if !cli.source.SparseClone {
+		return nil
+	}
+
+	return cli.run(append([]string{"sparse-checkout", "add"}, dirs...)...)
+}
+
+func (cli *gitCLI) Reset(ctx context.Context) error {
+	err := cli.runContext(ctx, "fetch", "origin", cli.source.Branch)
+	if err != nil {
+		return err
+	}
+
+	err = cli.run("reset", "--hard", "origin/"+cli.source.Branch)
+	if err != nil {
+		return err
+	}
+
+	// a reused clone may still have files left behind by an earlier put
+	return cli.run("clean", "-f", "-d", "-q")
+}
+
+// deepen fetches the history that a shallow clone left out.
+func (cli *gitCLI) deepen() error {
+	_, err := os.Stat(filepath.Join(cli.dir, ".git", "shallow"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return cli.run("fetch", "--unshallow", "origin", cli.source.Branch)
+}
+
+func (cli *gitCLI) Pull() error {
+	return cli.run("pull", "origin", cli.source.Branch)
+}
+
+func (cli *gitCLI) Add(path string) error {
+	return cli.run("add", path)
+}
+
+func (cli *gitCLI) Move(from string, to string) error {
+	return cli.run("mv", from, to)
+}
+
+func (cli *gitCLI) Remove(path string) error {
+	return cli.run("rm", path)
+}
+
+func (cli *gitCLI) RemoveIfPresent(path string) error {
+	return cli.run("rm", "-r", "-q", "--ignore-unmatch", path)
+}
+
+func (cli *gitCLI) Commit(message string) (string, error) {
+	err := cli.run("commit", "-m", message)
+	if err != nil {
+		return "", err
+	}
+
+	return cli.Head()
+}
+
+func (cli *gitCLI) Head() (string, error) {
+	ref, err := cli.output("rev-parse", "HEAD")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ref)
+		return "", err
+	}
+
+	return strings.TrimSpace(ref), nil
+}
+
+func (cli *gitCLI) ChangedSince(ref string, path string) (bool, error) {
+	err := cli.deepen()
+	if err != nil {
+		return false, err
+	}
+
+	output, err := cli.output("log", "--oneline", ref+"..HEAD", "--", path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output)
+		return false, err
+	}
+
+	return strings.TrimSpace(output) != "", nil
+}
+
+func (cli *gitCLI) FilesAt(ref string, dir string) ([]string, error) {
+	err := cli.deepen()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := cli.output("ls-tree", "--name-only", ref, dir+"/")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output)
+		return nil, err
+	}
+
+	return strings.Fields(output), nil
+}
+
+func (cli *gitCLI) AddedFiles(dirs ...string) ([]string, error) {
+	err := cli.deepen()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := cli.output(append([]string{"log", "--no-renames", "--diff-filter=A", "--format=", "--name-only", "--"}, dirs...)...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output)
+		return nil, err
+	}
+
+	return strings.Fields(output), nil
+}
+
+func (cli *gitCLI) Push(ctx context.Context) (string, error) {
+	contents, err := cli.outputContext(ctx, "push", "origin", "HEAD:"+cli.source.Branch)
+
+	// if we push and everything is up to date then someone else has made
+	// a commit in the same second acquiring the same lock
+	//
+	// we need to stop and try again
+	if strings.Contains(contents, falsePushString) {
+		return contents, ErrLockConflict
+	}
+
+	if strings.Contains(contents, pushRejectedString) {
+		return contents, ErrLockConflict
+	}
+
+	if strings.Contains(contents, pushRemoteRejectedString) {
+		return contents, ErrLockConflict
+	}
+
+	return contents, err
+}
+
+// Pushed returns ref, as commits are pushed as they are.
+func (cli *gitCLI) Pushed(ref string) (string, error) {
+	return ref, nil
+}
+
+// run runs a git command, and shows its output if it fails.
+func (cli *gitCLI) run(args ...string) error {
+	return cli.runContext(context.Background(), args...)
+}
+
+func (cli *gitCLI) runContext(ctx context.Context, args ...string) error {
+	output, err := cli.outputContext(ctx, args...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, output)
+		return err
+	}
+
+	return nil
+}
+
+func (cli *gitCLI) output(args ...string) (string, error) {
+	return cli.outputContext(context.Background(), args...)
+}
+
+func (cli *gitCLI) outputContext(ctx context.Context, args ...string) (string, error) {
+	arguments := append([]string{"-C", cli.dir}, args...)
+	cmd := exec.CommandContext(ctx, "git", arguments...)
+	s, err := cmd.CombinedOutput()
+	return string(s), err
+}
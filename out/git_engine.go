@@ -0,0 +1,88 @@
+package out
+
+import (
+	"context"
+	"fmt"
+)
+
+// gitEngine is how a GitLockHandler works with its clone of the repository.
+// Paths are either relative to the root of the clone, or absolute paths
+// within it. Cloning, fetching and pushing give up once their ctx is done.
+type gitEngine interface {
+	// Clone clones the branch of the source into dir, which must be empty.
+	Clone(ctx context.Context, dir string) error
+
+	// Open uses an existing clone of the source in dir.
+	Open(dir string) error
+
+	// Include makes sure the dirs are checked out, which a sparse clone only
+	// does for the pool of the source to begin with.
+	Include(dirs ...string) error
+
+	// Reset throws away any local changes and moves to the latest commit of
+	// the branch.
+	Reset(ctx context.Context) error
+	Pull() error
+
+	Add(path string) error
+	Move(from string, to string) error
+	Remove(path string) error
+	RemoveIfPresent(path string) error
+	Commit(message string) (ref string, err error)
+	Head() (ref string, err error)
+
+	// ChangedSince is true if a commit after ref changed the path.
+	ChangedSince(ref string, path string) (bool, error)
+
+	// FilesAt lists the paths of the files directly within dir at ref.
+	FilesAt(ref string, dir string) ([]string, error)
+
+	// AddedFiles lists the files added within any of the dirs by each
+	// commit, most recent first.
+	AddedFiles(dirs ...string) ([]string, error)
+
+	// Push pushes the commits made in the clone to the branch, and returns
+	// ErrLockConflict if someone else pushed to it in the meantime.
+	Push(ctx context.Context) (output string, err error)
+
+	// Pushed returns the ref a commit made at ref was pushed as, which is
+	// the same one but for stores that save changes on top of those others
+	// saved in the meantime.
+	Pushed(ref string) (string, error)
+}
+
+var gitEngines = map[string]func(Source) gitEngine{
+	"git":    newGitCLI,
+	"go-git": newGoGit,
+}
+
+// ValidGitEngine is true for the git engines a source can be configured
+// with, where the git binary is used if none is configured.
+func ValidGitEngine(name string) bool {
+	_, found := gitEngines[name]
+	return name == "" || found
+}
+
+func newGitEngine(source Source) gitEngine {
+	newEngine, found := gitEngines[source.GitEngine]
+	if !found {
+		newEngine = newGitCLI
+	}
+
+	return newEngine(source)
+}
+
+// NonFastForwardError is returned when pushing would overwrite commits that
+// someone else pushed to the branch in the meantime, i.e. when they changed
+// the pool at the same time.
+type NonFastForwardError struct {
+	Branch string
+}
+
+func (err NonFastForwardError) Error() string {
+	return fmt.Sprintf("non-fast-forward push to %s", err.Branch)
+}
+
+func (err NonFastForwardError) Is(target error) bool {
+	return target == ErrLockConflict
+}
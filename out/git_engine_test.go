@@ -0,0 +1,123 @@
+package out_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Git engines", func() {
+	var bareGitRepo string
+
+	BeforeEach(func() {
+		bareGitRepo = createBareGitRepo()
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(bareGitRepo)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	for _, engine := range []string{"git", "go-git"} {
+		Context("with the "+engine+" engine", func() {
+			var handlers []*out.GitLockHandler
+
+			BeforeEach(func() {
+				handlers = nil
+
+				for range 2 {
+					handler := out.NewGitLockHandler(out.Source{
+						URI:       bareGitRepo,
+						Branch:    "master",
+						Pool:      "lock-pool",
+						GitEngine: engine,
+					})
+					handler.CacheDir = ""
+
+					err := handler.Setup(context.Background())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					handlers = append(handlers, handler)
+				}
+			})
+
+			AfterEach(func() {
+				for _, handler := range handlers {
+					err := handler.Cleanup()
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+			})
+
+			It("claims a lock and pushes the claim", func() {
+				ref, err := handlers[0].ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = handlers[0].BroadcastLockPool(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				head, err := exec.Command("git", "--git-dir", bareGitRepo, "rev-parse", "master").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(head)).Should(HavePrefix(ref))
+
+				claimed, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "--name-only", "master", "lock-pool/claimed/").Output()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(claimed)).Should(ContainSubstring(filepath.Join("lock-pool", "claimed", "some-lock")))
+			})
+
+			It("reports a conflict when someone else pushed a claim first", func() {
+				for _, handler := range handlers {
+					_, err := handler.ClaimLock("some-lock", "")
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				_, err := handlers[0].BroadcastLockPool(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = handlers[1].BroadcastLockPool(context.Background())
+				Ω(err).Should(MatchError(out.ErrLockConflict))
+
+				if engine == "go-git" {
+					var nonFastForward out.NonFastForwardError
+					Ω(errors.As(err, &nonFastForward)).Should(BeTrue())
+				}
+
+				err = handlers[1].ResetLock(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = handlers[1].ClaimLock("some-lock", "")
+				Ω(err).Should(Equal(out.ErrNoLocksAvailable))
+			})
+
+			It("returns a push that fails for another reason as it is, rather than as a conflict", func() {
+				_, err := handlers[0].ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.Rename(bareGitRepo, bareGitRepo+"-gone")
+				Ω(err).ShouldNot(HaveOccurred())
+				defer os.Rename(bareGitRepo+"-gone", bareGitRepo)
+
+				_, err = handlers[0].BroadcastLockPool(context.Background())
+				Ω(err).Should(HaveOccurred())
+				Ω(err).ShouldNot(MatchError(out.ErrLockConflict))
+			})
+		})
+	}
+
+	It("tells a non-fast-forward push apart from other failures", func() {
+		err := error(out.NonFastForwardError{Branch: "master"})
+
+		Ω(err).Should(MatchError(out.ErrLockConflict))
+		Ω(err.Error()).Should(Equal("non-fast-forward push to master"))
+
+		var nonFastForward out.NonFastForwardError
+		Ω(errors.As(err, &nonFastForward)).Should(BeTrue())
+		Ω(nonFastForward.Branch).Should(Equal("master"))
+	})
+})
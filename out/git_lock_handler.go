@@ -1,130 +1,352 @@
 package out
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 var ErrNoLocksAvailable = errors.New("no locks to claim")
 var ErrLockConflict = errors.New("pool state out of date")
 var ErrLockActive = errors.New("lock found")
+var ErrLockLost = errors.New("lock is no longer claimed by this claim")
+var ErrNoLease = errors.New("lock has no lease to renew")
+var ErrNotYourTurn = errors.New("others are ahead in the queue")
+var ErrTicketLost = errors.New("queue ticket is no longer in the queue")
+
+// NotYourTurnError is ErrNotYourTurn along with how many builds are waiting
+// ahead in the queue.
+type NotYourTurnError struct {
+	Ahead int
+}
+
+func (err NotYourTurnError) Error() string {
+	return fmt.Sprintf("%s (%d ahead)", ErrNotYourTurn, err.Ahead)
+}
+
+func (err NotYourTurnError) Is(target error) bool {
+	return target == ErrNotYourTurn
+}
 
 var _ LockHandler = (*GitLockHandler)(nil)
 
 type GitLockHandler struct {
-	Source Source
+	Source   Source
+	Strategy SelectionStrategy
+
+	// CacheDir keeps a clone of each repository around for later handlers in
+	// the same put to reuse. Every handler clones the repository afresh if it
+	// is empty.
+	CacheDir string
 
+	repo      gitEngine
 	dir       string
+	cache     *os.File
 	checkOnly bool
+	ticket    string
+
+	// shared with the handlers for other pools of the same clone
+	claims *claimLog
+}
+
+// claimLog keeps track of the claim records a handler has staged since the
+// clone was last reset, and of those it has pushed, or may have pushed, so
+// that they can be rolled back.
+type claimLog struct {
+	staged []claimRef
+	pushed []claimRef
 }
 
-const falsePushString = "Everything up-to-date"
-const pushRejectedString = "[rejected]"
-const pushRemoteRejectedString = "[remote rejected]"
+type claimRef struct {
+	pool string
+	lock string
+	id   string
+}
 
 func NewGitLockHandler(source Source) *GitLockHandler {
+	strategy, found := SelectionStrategyNamed(source.SelectionStrategy)
+	if !found {
+		strategy = RandomSelection{}
+	}
+
 	return &GitLockHandler{
-		Source: source,
+		Source:   source,
+		Strategy: strategy,
+		CacheDir: filepath.Join(os.TempDir(), "pool-resource-repo-cache"),
+		repo:     newGitEngine(source),
+		claims:   &claimLog{},
 	}
 }
 
-func (glh *GitLockHandler) ClaimLock(lockName string) (string, error) {
-	_, err := os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
+// NewStoreLockHandler keeps the pool in a store other than a git repository,
+// which it works with as if it were a clone of one.
+func NewStoreLockHandler(source Source, store PoolStore) *GitLockHandler {
+	handler := NewGitLockHandler(source)
+	handler.CacheDir = ""
+	handler.repo = newStoreEngine(store, source.Pool)
+
+	return handler
+}
+
+// ClaimLock claims a lock exclusively, or alongside its other holders in
+// shared mode.
+func (glh *GitLockHandler) ClaimLock(lockName string, mode ClaimMode) (string, error) {
+	err := glh.takeTurn(lockName, 0)
 	if err != nil {
-		return "", ErrNoLocksAvailable
+		return "", err
+	}
+
+	if mode == SharedMode {
+		capacity, err := glh.capacity(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		// locks with room for several holders are shared by them anyway
+		if capacity == 1 {
+			return glh.claimShared(lockName)
+		}
+	}
+
+	if mode == ExclusiveMode {
+		capacity, err := glh.capacity(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		if capacity > 1 {
+			return glh.claimExclusively(lockName)
+		}
 	}
 
-	output, err := glh.git("mv", filepath.Join(glh.Source.Pool, "unclaimed", lockName), filepath.Join(glh.Source.Pool, "claimed", lockName))
+	_, err = os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
+	if err == nil {
+		return glh.claimUnclaimedLock(lockName)
+	}
+
+	free, records, err := glh.freeSlot(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	commitMessage := fmt.Sprintf("claiming: %s\n%s", lockName, glh.buildUrl())
-	output, err = glh.git("commit", "-m", commitMessage)
+	if free {
+		return glh.claimFreeSlot(lockName, records)
+	}
+
+	capacity, err := glh.capacity(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	if capacity > 1 {
+		return "", ErrNoLocksAvailable
+	}
+
+	records, err = glh.readClaimRecords(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
 		return "", err
 	}
 
-	return ref, nil
+	if leaseExpired(records, time.Now()) {
+		return glh.reclaimExpiredLock(lockName, records)
+	}
+
+	return "", ErrNoLocksAvailable
 }
 
 func (glh *GitLockHandler) RemoveLock(lockName string) (string, error) {
 	pool := filepath.Join(glh.dir, glh.Source.Pool)
 
-	output, err := glh.git("rm", filepath.Join(pool, "claimed", lockName))
+	err := glh.repo.Remove(filepath.Join(pool, "claimed", lockName))
+	if err != nil {
+		return "", err
+	}
+
+	err = glh.removeClaimRecords(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	output, err = glh.git("commit", "-m", fmt.Sprintf("removing: %s\n%s", lockName, glh.buildUrl()))
+	err = glh.unmarkShared(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	err = glh.repo.RemoveIfPresent(CapacityPath(glh.Source.Pool, lockName))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
 		return "", err
 	}
 
-	return ref, nil
+	return glh.commit(fmt.Sprintf("removing: %s\n%s", lockName, glh.buildUrl()))
 }
 
-func (glh *GitLockHandler) UnclaimLock(lockName string) (string, error) {
+// UnclaimLock releases a lock, or only the given claim on it if the lock can
+// have several holders at once.
+func (glh *GitLockHandler) UnclaimLock(lockName string, claim string) (string, error) {
+	several, err := glh.heldBySeveral(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	if several && claim != "" {
+		return glh.releaseSlot(lockName, claim)
+	}
+
 	pool := filepath.Join(glh.dir, glh.Source.Pool)
 
-	output, err := glh.git("mv", filepath.Join(pool, "claimed", lockName), filepath.Join(pool, "unclaimed", lockName))
+	err = glh.repo.Move(filepath.Join(pool, "claimed", lockName), filepath.Join(pool, "unclaimed", lockName))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	output, err = glh.git("commit", "-m", fmt.Sprintf("unclaiming: %s\n%s", lockName, glh.buildUrl()))
+	err = glh.removeClaimRecords(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	err = glh.unmarkShared(lockName)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
 		return "", err
 	}
 
-	return ref, nil
+	return glh.commit(fmt.Sprintf("unclaiming: %s\n%s", lockName, glh.buildUrl()))
 }
 
-func (glh *GitLockHandler) ResetLock() error {
-	output, err := glh.git("fetch", "origin", glh.Source.Branch)
+func (glh *GitLockHandler) VerifyClaim(lockName string, ref string, claim string) error {
+	ref = strings.TrimSpace(ref)
+	claimedPath := filepath.Join(glh.Source.Pool, "claimed", lockName)
+
+	_, err := os.Stat(filepath.Join(glh.dir, claimedPath))
+	if err != nil {
+		return ErrLockLost
+	}
+
+	several, err := glh.heldBySeveral(lockName)
+	if err != nil {
+		return err
+	}
+
+	// the holders of a lock with room for several, or of a shared lock, come
+	// and go while it stays claimed, so only our own claim matters
+	if several && claim != "" {
+		_, err := os.Stat(filepath.Join(glh.dir, glh.claimRecordsDir(lockName), claim))
+		if err != nil {
+			return ErrLockLost
+		}
+
+		return nil
+	}
+
+	changed, err := glh.repo.ChangedSince(ref, claimedPath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return err
 	}
 
-	output, err = glh.git("reset", "--hard", "origin/"+glh.Source.Branch)
+	if changed {
+		return ErrLockLost
+	}
+
+	// an expired lease may have been reclaimed without moving the lock, in
+	// which case the claim records we had at ref are gone
+	recordPaths, err := glh.repo.FilesAt(ref, glh.claimRecordsDir(lockName))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return err
 	}
 
+	for _, recordPath := range recordPaths {
+		_, err := os.Stat(filepath.Join(glh.dir, recordPath))
+		if err != nil {
+			return ErrLockLost
+		}
+	}
+
 	return nil
 }
 
+// RenewLock pushes back the expiry of the leases on a lock, or only of the
+// given claim if the lock can have several holders at once.
+func (glh *GitLockHandler) RenewLock(lockName string, claim string) (string, error) {
+	records, err := glh.readClaimRecords(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	several, err := glh.heldBySeveral(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	var leased []ClaimRecord
+	for _, record := range records {
+		if several && claim != "" && record.ID != claim {
+			continue
+		}
+
+		if !record.ExpiresAt.IsZero() {
+			leased = append(leased, record)
+		}
+	}
+
+	if len(leased) == 0 {
+		return "", ErrNoLease
+	}
+
+	expiresAt := time.Now().Add(glh.Source.LeaseDuration).UTC()
+
+	for _, record := range leased {
+		record.ExpiresAt = expiresAt
+
+		err = glh.writeClaimRecord(lockName, record)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	commitMessage := fmt.Sprintf("renewing: %s (lease expires at %s)\n%s", lockName, expiresAt.Format(time.RFC3339), glh.buildUrl())
+	return glh.commit(commitMessage)
+}
+
+func (glh *GitLockHandler) ResetLock(ctx context.Context) error {
+	glh.claims.staged = nil
+
+	return glh.repo.Reset(ctx)
+}
+
+// RollBackClaims releases each claim pushed by the handler that is still on
+// the lock, in a commit of its own.
+func (glh *GitLockHandler) RollBackClaims() (string, error) {
+	rolledBack := false
+
+	for _, claim := range glh.claims.pushed {
+		handler := glh.inPool(claim.pool)
+
+		_, err := os.Stat(filepath.Join(glh.dir, handler.claimRecordsDir(claim.lock), claim.id))
+		if err != nil {
+			continue
+		}
+
+		_, err = handler.UnclaimLock(claim.lock, claim.id)
+		if err != nil {
+			return "", err
+		}
+
+		rolledBack = true
+	}
+
+	// there is nothing to push if none of the claims made it
+	glh.checkOnly = !rolledBack
+
+	return glh.repo.Head()
+}
+
 func (glh *GitLockHandler) AddLock(lock string, contents []byte, initiallyClaimed bool) (string, error) {
 	var claimedness string
 	if initiallyClaimed {
@@ -141,26 +363,19 @@ func (glh *GitLockHandler) AddLock(lock string, contents []byte, initiallyClaime
 		return "", err
 	}
 
-	output, err := glh.git("add", lockPath)
+	err = glh.repo.Add(lockPath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	commitMessage := fmt.Sprintf("adding %s: %s\n%s", claimedness, lock, glh.buildUrl())
-	output, err = glh.git("commit", lockPath, "-m", commitMessage)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
-		return "", err
-	}
-
-	ref, err := glh.git("rev-parse", "HEAD")
-	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
-		return "", err
+	if initiallyClaimed {
+		err = glh.recordClaim(lock)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	return string(ref), nil
+	return glh.commit(fmt.Sprintf("adding %s: %s\n%s", claimedness, lock, glh.buildUrl()))
 }
 
 func (glh *GitLockHandler) UpdateLock(lockName string, contents []byte) (string, error) {
@@ -189,189 +404,1203 @@ func (glh *GitLockHandler) UpdateLock(lockName string, contents []byte) (string,
 		return "", err
 	}
 
-	output, err := glh.git("add", lockPath)
+	err = glh.repo.Add(lockPath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	commitMessage := fmt.Sprintf("%s: %s\n%s", operation, lockName, glh.buildUrl())
-	output, err = glh.git("commit", lockPath, "-m", commitMessage)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
-		return "", err
+	return glh.commit(fmt.Sprintf("%s: %s\n%s", operation, lockName, glh.buildUrl()))
+}
+
+// CheckLock waits while the lock is claimed, or in shared mode only while it
+// is claimed exclusively.
+func (glh *GitLockHandler) CheckLock(lockName string, mode ClaimMode) (string, error) {
+	glh.checkOnly = true
+
+	// Wait if claimed
+	_, err := os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, "claimed", lockName))
+	if err == nil {
+		several, err := glh.heldBySeveral(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		if mode != SharedMode || !several {
+			return "", ErrLockActive
+		}
+
+		records, err := glh.readClaimRecords(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		if heldExclusively(records, time.Now()) {
+			return "", ErrLockActive
+		}
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	err = glh.repo.Pull()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
 		return "", err
 	}
 
-	return ref, nil
+	return glh.repo.Head()
 }
 
-func (glh *GitLockHandler) CheckLock(lockName string) (string, error) {
+// CurrentVersion is the version of the pool as it is, for steps that end up
+// leaving it alone.
+func (glh *GitLockHandler) CurrentVersion() (string, error) {
 	glh.checkOnly = true
 
-	// Wait if claimed
-	_, err := os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, "claimed", lockName))
+	return glh.repo.Head()
+}
+
+func (glh *GitLockHandler) CheckUnclaimedLock(lockName string) (string, error) {
+	glh.checkOnly = true
+
+	// Wait if unclaimed
+	_, err := os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
 	if err == nil {
 		return "", ErrLockActive
 	}
 
-	output, err := glh.git("pull", "origin", glh.Source.Branch)
+	err = glh.repo.Pull()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	return glh.repo.Head()
+}
+
+// Setup clones the repository the first time it is called, and keeps using
+// the clone afterwards, as ResetLock brings it up to date anyway. A clone
+// cached by an earlier handler is reused unless another one is using it, in
+// which case the repository is cloned to a temporary directory instead.
+func (glh *GitLockHandler) Setup(ctx context.Context) error {
+	if glh.dir != "" {
+		return nil
+	}
+
+	dir, err := glh.useCachedClone(ctx)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
-		return "", err
+		return err
+	}
+
+	if dir != "" {
+		glh.dir = dir
+		return nil
+	}
+
+	dir, err = os.MkdirTemp("", "pool-resource")
+	if err != nil {
+		return err
+	}
+
+	err = glh.repo.Clone(ctx, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
 	}
 
-	return string(ref), nil
+	glh.dir = dir
+	return nil
 }
 
-func (glh *GitLockHandler) CheckUnclaimedLock(lockName string) (string, error) {
-	glh.checkOnly = true
+// useCachedClone returns the directory of the cached clone of the
+// repository, cloning it there if need be. It returns an empty directory if
+// there is no cache, or if another handler is using it.
+func (glh *GitLockHandler) useCachedClone(ctx context.Context) (string, error) {
+	if glh.CacheDir == "" {
+		return "", nil
+	}
 
-	// Wait if unclaimed
-	_, err := os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
-	if err == nil {
-		return "", ErrLockActive
+	err := os.MkdirAll(glh.CacheDir, 0755)
+	if err != nil {
+		return "", err
 	}
 
-	output, err := glh.git("pull", "origin", glh.Source.Branch)
+	// the same repository is cached separately for each engine, and for
+	// sparse clones, as they are not cloned the same way
+	key := sha256.Sum256(fmt.Appendf(nil, "%s\n%s\n%s\n%t", glh.Source.URI, glh.Source.Branch, glh.Source.GitEngine, glh.Source.SparseClone))
+	dir := filepath.Join(glh.CacheDir, hex.EncodeToString(key[:8]))
+
+	cache, err := lockFile(dir + ".lock")
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
 		return "", err
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	if cache == nil {
+		return "", nil
+	}
+
+	err = glh.repo.Open(dir)
+	if err == nil {
+		glh.cache = cache
+		return dir, nil
+	}
+
+	// start over if the clone is missing, or was left unusable by a put that
+	// was interrupted
+	err = os.RemoveAll(dir)
+	if err == nil {
+		err = glh.repo.Clone(ctx, dir)
+	}
+
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
+		os.RemoveAll(dir)
+		cache.Close()
 		return "", err
 	}
 
-	return string(ref), nil
+	glh.cache = cache
+	return dir, nil
 }
 
-func (glh *GitLockHandler) Setup() error {
-	var err error
+// Cleanup removes the clone made by Setup unless it is cached, and lets
+// other puts use the cached clone again.
+func (glh *GitLockHandler) Cleanup() error {
+	if glh.dir == "" {
+		return nil
+	}
 
-	glh.dir, err = os.MkdirTemp("", "pool-resource")
-	if err != nil {
+	dir := glh.dir
+	glh.dir = ""
+
+	if glh.cache != nil {
+		err := glh.cache.Close()
+		glh.cache = nil
 		return err
 	}
 
-	cmd := exec.Command("git", "clone", "--single-branch", "--branch", glh.Source.Branch, glh.Source.URI, glh.dir)
-	err = cmd.Run()
+	return os.RemoveAll(dir)
+}
+
+func (glh *GitLockHandler) GrabAvailableLock(acquire AcquireParams) (map[string][]string, string, error) {
+	pools := acquire.Pools
+	if len(pools) == 0 {
+		pools = []string{glh.Source.Pool}
+	}
+
+	count := max(acquire.Count, 1)
+	locks := map[string][]string{}
+
+	err := glh.repo.Include(pools...)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	_, err = glh.git("config", "user.name")
+	err = glh.takeTurn("", acquire.Priority)
 	if err != nil {
-		// hardcode git user.name if not already set in git_config
-		output, err := glh.git("config", "user.name", "CI Pool Resource")
+		return nil, "", err
+	}
+
+	var (
+		claimings   []string
+		reclaimings []string
+	)
+
+	// every pool is staged into the same commit, so that either all of the
+	// locks are claimed or none of them are
+	for _, pool := range pools {
+		names, expiredAt, err := glh.inPool(pool).stageAvailableLocks(count, acquire.Match)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, output)
-			return err
+			return nil, "", err
+		}
+
+		for _, name := range names {
+			label := name
+			if len(pools) > 1 {
+				label = pool + "/" + name
+			}
+
+			claimings = append(claimings, label)
+
+			if at, isExpired := expiredAt[name]; isExpired {
+				reclaimings = append(reclaimings, fmt.Sprintf("reclaiming: %s (lease expired at %s)", label, at.Format(time.RFC3339)))
+			}
 		}
+
+		locks[pool] = names
 	}
 
-	_, err = glh.git("config", "user.email")
-	if err != nil {
-		// hardcode git user.email if not already set in git_config
-		output, err := glh.git("config", "user.email", "ci-pool@localhost")
-		if err != nil {
-			fmt.Fprintln(os.Stderr, output)
-			return err
+	var commitMessage string
+	if len(claimings) == 1 && len(reclaimings) == 1 {
+		commitMessage = fmt.Sprintf("%s\n%s", reclaimings[0], glh.buildUrl())
+	} else {
+		commitMessage = fmt.Sprintf("claiming: %s\n", strings.Join(claimings, ", "))
+		for _, reclaiming := range reclaimings {
+			commitMessage += reclaiming + "\n"
 		}
+		commitMessage += glh.buildUrl()
 	}
 
-	return nil
+	ref, err := glh.commit(commitMessage)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return locks, ref, nil
 }
 
-func (glh *GitLockHandler) GrabAvailableLock() (string, string, error) {
-	var files []os.DirEntry
+// stageAvailableLocks stages claiming count locks matching the selector from
+// the pool without committing them, preferring unclaimed locks over ones
+// whose lease has expired. It returns the names of the locks, and when the
+// lease expired for those that were reclaimed.
+func (glh *GitLockHandler) stageAvailableLocks(count int, selector Selector) ([]string, map[string]time.Time, error) {
+	var available []string
 
 	allFiles, err := os.ReadDir(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed"))
 	if err != nil {
-		return "", "", err
+		return nil, nil, err
 	}
 
 	for _, file := range allFiles {
 		fileName := filepath.Base(file.Name())
-		if !strings.HasPrefix(fileName, ".") {
-			files = append(files, file)
+		if strings.HasPrefix(fileName, ".") {
+			continue
+		}
+
+		matches, err := glh.lockMatches("unclaimed", fileName, selector)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if matches {
+			available = append(available, fileName)
 		}
 	}
 
-	if len(files) == 0 {
-		return "", "", ErrNoLocksAvailable
+	// locks with room for several holders are still available while claimed
+	freeSlots, err := glh.locksWithFreeSlots()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	index := rand.Int() % len(files)
-	name := filepath.Base(files[index].Name())
+	for name := range freeSlots {
+		matches, err := glh.lockMatches("claimed", name, selector)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	output, err := glh.git("mv", filepath.Join(glh.Source.Pool, "unclaimed", name), filepath.Join(glh.Source.Pool, "claimed", name))
-	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
-		return "", "", err
+		if matches {
+			available = append(available, name)
+		}
+	}
+
+	// only take over locks whose lease has expired once nothing else is free
+	var expiredLocks map[string][]ClaimRecord
+	var expired []string
+
+	if len(available) < count {
+		expiredLocks, err = glh.expiredLocks()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for name := range expiredLocks {
+			matches, err := glh.lockMatches("claimed", name, selector)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if matches {
+				expired = append(expired, name)
+			}
+		}
+	}
+
+	if len(available)+len(expired) < count {
+		return nil, nil, ErrNoLocksAvailable
 	}
 
-	commitMessage := fmt.Sprintf("claiming: %s\n%s", name, glh.buildUrl())
-	output, err = glh.git("commit", "-m", commitMessage)
+	available, err = glh.Strategy.Order(available, glh.claimHistory)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
-		return "", "", err
+		return nil, nil, err
 	}
 
-	ref, err := glh.git("rev-parse", "HEAD")
+	expired, err = glh.Strategy.Order(expired, glh.claimHistory)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, ref)
-		return "", "", err
+		return nil, nil, err
+	}
+
+	names := append(available, expired...)[:count]
+	expiredAt := map[string]time.Time{}
+
+	for _, name := range names {
+		records, isExpired := expiredLocks[name]
+		claims, hasFreeSlot := freeSlots[name]
+		if isExpired {
+			expiredAt[name], err = glh.replaceExpiredClaim(name, records)
+		} else if hasFreeSlot {
+			err = glh.stageFreeSlot(name, claims)
+		} else {
+			err = glh.moveToClaimed(name)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return name, string(ref), nil
+	return names, expiredAt, nil
 }
 
-func (glh *GitLockHandler) BroadcastLockPool() (string, error) {
-	// validate if we're doing check only
-	if glh.checkOnly {
-		return "", nil
+func (glh *GitLockHandler) lockMatches(claimedness string, lockName string, selector Selector) (bool, error) {
+	if len(selector) == 0 {
+		return true, nil
+	}
+
+	contents, err := os.ReadFile(filepath.Join(glh.dir, glh.Source.Pool, claimedness, lockName))
+	if err != nil {
+		return false, err
 	}
 
-	contents, err := glh.git("push", "origin", "HEAD:"+glh.Source.Branch)
+	return selector.Matches(contents), nil
+}
+
+// Enqueue joins the queue of the pool with a new ticket, which the following
+// claims of this handler use to wait for their turn.
+func (glh *GitLockHandler) Enqueue(lockName string, priority int) (string, string, error) {
+	ticket := NewQueueTicket(time.Now(), glh.Source.FairQueueTimeout, lockName, priority, OwnerFromEnv())
+
+	err := glh.writeTicket(ticket)
+	if err != nil {
+		return "", "", err
+	}
 
-	// if we push and everything is up to date then someone else has made
-	// a commit in the same second acquiring the same lock
-	//
-	// we need to stop and try again
-	if strings.Contains(contents, falsePushString) {
-		return contents, ErrLockConflict
+	wants := "any lock"
+	if lockName != "" {
+		wants = lockName
 	}
 
-	if strings.Contains(contents, pushRejectedString) {
-		return contents, ErrLockConflict
+	if priority != 0 {
+		wants = fmt.Sprintf("%s, with priority %d", wants, priority)
 	}
 
-	if strings.Contains(contents, pushRemoteRejectedString) {
-		return contents, ErrLockConflict
+	ref, err := glh.commit(fmt.Sprintf("enqueuing: %s (waiting for %s)\n%s", ticket.ID, wants, glh.buildUrl()))
+	if err != nil {
+		return "", "", err
+	}
+
+	glh.ticket = ticket.ID
+
+	return ticket.ID, ref, nil
+}
+
+// RefreshTicket keeps the ticket of this handler from going stale while it
+// waits for its turn.
+func (glh *GitLockHandler) RefreshTicket() (string, error) {
+	tickets, err := glh.readQueue()
+	if err != nil {
+		return "", err
+	}
+
+	index := slices.IndexFunc(tickets, func(ticket QueueTicket) bool {
+		return ticket.ID == glh.ticket
+	})
+
+	if glh.ticket == "" || index == -1 {
+		return "", ErrTicketLost
+	}
+
+	ticket := tickets[index]
+	ticket.ExpiresAt = time.Now().Add(glh.Source.FairQueueTimeout).UTC()
+
+	err = glh.writeTicket(ticket)
+	if err != nil {
+		return "", err
+	}
+
+	return glh.commit(fmt.Sprintf("refreshing: %s (expires at %s)\n%s", ticket.ID, ticket.ExpiresAt.Format(time.RFC3339), glh.buildUrl()))
+}
+
+// LeaveQueue removes the ticket of this handler from the queue, when it gives
+// up waiting for its turn.
+func (glh *GitLockHandler) LeaveQueue() (string, error) {
+	tickets, err := glh.readQueue()
+	if err != nil {
+		return "", err
+	}
+
+	// there is nothing to push if the ticket is gone already
+	if glh.ticket == "" || !slices.ContainsFunc(tickets, func(ticket QueueTicket) bool { return ticket.ID == glh.ticket }) {
+		glh.checkOnly = true
+		return glh.repo.Head()
+	}
+
+	err = glh.removeTicket(glh.ticket)
+	if err != nil {
+		return "", err
+	}
+
+	return glh.commit(fmt.Sprintf("dequeuing: %s (gave up waiting)\n%s", glh.ticket, glh.buildUrl()))
+}
+
+// takeTurn makes sure nobody is waiting ahead of this handler in a pool with a
+// fair queue for the lock it wants, or for any lock if wants is empty, and
+// stages leaving the queue along with the claim. Without a ticket, only those
+// waiting with at least the given priority are ahead. Stale tickets are
+// ignored, and removed along the way.
+func (glh *GitLockHandler) takeTurn(wants string, priority int) error {
+	if !glh.Source.FairQueue {
+		return nil
+	}
+
+	tickets, err := glh.readQueue()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	var waiting []QueueTicket
+	for _, ticket := range tickets {
+		if ticket.ID != glh.ticket && ticket.Stale(now) {
+			err := glh.removeTicket(ticket.ID)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		waiting = append(waiting, ticket)
+	}
+
+	ours := -1
+	if glh.ticket != "" {
+		ours = slices.IndexFunc(waiting, func(ticket QueueTicket) bool { return ticket.ID == glh.ticket })
+		if ours == -1 {
+			return ErrTicketLost
+		}
+
+		waiting = waiting[:ours]
+	}
+
+	ahead := 0
+	for _, ticket := range waiting {
+		if ours == -1 && ticket.Priority < priority {
+			continue
+		}
+
+		inTheWay, err := glh.inTheWay(ticket, wants)
+		if err != nil {
+			return err
+		}
+
+		if inTheWay {
+			ahead++
+		}
+	}
+
+	if ahead > 0 {
+		return NotYourTurnError{Ahead: ahead}
+	}
+
+	if ours == -1 {
+		return nil
+	}
+
+	return glh.removeTicket(glh.ticket)
+}
+
+// inTheWay is true if the lock the ticket waits for may be the one that we
+// want, or any lock if wants is empty. A build waiting for a specific lock
+// that is still held does not keep others from the locks that are free.
+func (glh *GitLockHandler) inTheWay(ticket QueueTicket, wants string) (bool, error) {
+	if ticket.Lock == "" || ticket.Lock == wants {
+		return true, nil
+	}
+
+	if wants != "" {
+		return false, nil
+	}
+
+	return glh.claimable(ticket.Lock)
+}
+
+// claimable is true when the lock can be claimed straight away, as it is
+// unclaimed, has room for another holder, or its lease has expired.
+func (glh *GitLockHandler) claimable(lockName string) (bool, error) {
+	_, err := os.Stat(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
+	if err == nil {
+		return true, nil
+	}
+
+	free, _, err := glh.freeSlot(lockName)
+	if err != nil || free {
+		return free, err
+	}
+
+	capacity, err := glh.capacity(lockName)
+	if err != nil || capacity > 1 {
+		return false, err
+	}
+
+	records, err := glh.readClaimRecords(lockName)
+	if err != nil {
+		return false, err
+	}
+
+	return leaseExpired(records, time.Now()), nil
+}
+
+func (glh *GitLockHandler) queueDir() string {
+	return filepath.Join(glh.Source.Pool, "waiting")
+}
+
+func (glh *GitLockHandler) readQueue() ([]QueueTicket, error) {
+	dir := filepath.Join(glh.dir, glh.queueDir())
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tickets []QueueTicket
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var ticket QueueTicket
+		err = json.Unmarshal(contents, &ticket)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue ticket %s: %w", entry.Name(), err)
+		}
+		ticket.ID = entry.Name()
+
+		tickets = append(tickets, ticket)
+	}
+
+	SortQueue(tickets)
+
+	return tickets, nil
+}
+
+func (glh *GitLockHandler) writeTicket(ticket QueueTicket) error {
+	dir := filepath.Join(glh.dir, glh.queueDir())
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	ticketPath := filepath.Join(dir, ticket.ID)
+
+	err = os.WriteFile(ticketPath, contents, 0644)
+	if err != nil {
+		return err
+	}
+
+	return glh.repo.Add(ticketPath)
+}
+
+func (glh *GitLockHandler) removeTicket(id string) error {
+	return glh.repo.RemoveIfPresent(filepath.Join(glh.queueDir(), id))
+}
+
+// claimHistory lists the locks of the pool by when they were last claimed,
+// most recent first, going by the commits that moved them to claimed or
+// recorded a claim on them.
+func (glh *GitLockHandler) claimHistory() ([]string, error) {
+	claimedDir := filepath.Join(glh.Source.Pool, "claimed")
+	claimsDir := filepath.Join(glh.Source.Pool, "claims")
+
+	addedFiles, err := glh.repo.AddedFiles(claimedDir, claimsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []string
+	for _, path := range addedFiles {
+		var lockName string
+
+		if rest, found := strings.CutPrefix(path, claimedDir+"/"); found {
+			lockName = rest
+		} else if rest, found := strings.CutPrefix(path, claimsDir+"/"); found {
+			lockName, _, _ = strings.Cut(rest, "/")
+		}
+
+		if lockName == "" || strings.HasPrefix(lockName, ".") || slices.Contains(history, lockName) {
+			continue
+		}
+
+		history = append(history, lockName)
+	}
+
+	return history, nil
+}
+
+// inPool returns a handler for another pool in the same clone of the
+// repository.
+func (glh *GitLockHandler) inPool(pool string) *GitLockHandler {
+	poolHandler := *glh
+	poolHandler.Source.Pool = pool
+	return &poolHandler
+}
+
+func (glh *GitLockHandler) claimUnclaimedLock(lockName string) (string, error) {
+	err := glh.moveToClaimed(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	return glh.commit(fmt.Sprintf("claiming: %s\n%s", lockName, glh.buildUrl()))
+}
+
+func (glh *GitLockHandler) reclaimExpiredLock(lockName string, records []ClaimRecord) (string, error) {
+	expiredAt, err := glh.replaceExpiredClaim(lockName, records)
+	if err != nil {
+		return "", err
+	}
+
+	commitMessage := fmt.Sprintf("reclaiming: %s (lease expired at %s)\n%s", lockName, expiredAt.Format(time.RFC3339), glh.buildUrl())
+	return glh.commit(commitMessage)
+}
+
+// moveToClaimed stages claiming an unclaimed lock without committing it.
+func (glh *GitLockHandler) moveToClaimed(lockName string) error {
+	err := glh.repo.Move(filepath.Join(glh.Source.Pool, "unclaimed", lockName), filepath.Join(glh.Source.Pool, "claimed", lockName))
+	if err != nil {
+		return err
+	}
+
+	return glh.recordClaim(lockName)
+}
+
+// replaceExpiredClaim stages taking over a lock whose lease has expired
+// without committing it, and returns when the lease expired.
+func (glh *GitLockHandler) replaceExpiredClaim(lockName string, records []ClaimRecord) (time.Time, error) {
+	err := glh.removeClaimRecords(lockName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = glh.unmarkShared(lockName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = glh.recordClaim(lockName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var expiredAt time.Time
+	for _, record := range records {
+		if record.ExpiresAt.After(expiredAt) {
+			expiredAt = record.ExpiresAt
+		}
+	}
+
+	return expiredAt, nil
+}
+
+// capacity returns how many holders a lock of the pool can have at once.
+func (glh *GitLockHandler) capacity(lockName string) (int, error) {
+	return ReadCapacity(glh.dir, glh.Source.Pool, lockName)
+}
+
+// freeSlot is true when a claimed lock with room for several holders can
+// take another one, not counting claims whose lease has expired. It also
+// returns the claims on the lock.
+func (glh *GitLockHandler) freeSlot(lockName string) (bool, []ClaimRecord, error) {
+	_, err := os.Stat(filepath.Join(glh.dir, glh.Source.Pool, "claimed", lockName))
+	if err != nil {
+		return false, nil, nil
+	}
+
+	capacity, err := glh.capacity(lockName)
+	if err != nil || capacity == 1 {
+		return false, nil, err
+	}
+
+	records, err := glh.readClaimRecords(lockName)
+	if err != nil {
+		return false, nil, err
+	}
+
+	now := time.Now()
+
+	return liveClaims(records, now) < capacity && !heldExclusively(records, now), records, nil
+}
+
+// locksWithFreeSlots returns the claimed locks of the pool that can take
+// another holder, along with the claims on them.
+func (glh *GitLockHandler) locksWithFreeSlots() (map[string][]ClaimRecord, error) {
+	allFiles, err := os.ReadDir(filepath.Join(glh.dir, glh.Source.Pool, "claimed"))
+	if err != nil {
+		return nil, err
+	}
+
+	freeSlots := map[string][]ClaimRecord{}
+
+	for _, file := range allFiles {
+		fileName := filepath.Base(file.Name())
+		if strings.HasPrefix(fileName, ".") {
+			continue
+		}
+
+		free, records, err := glh.freeSlot(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		if free {
+			freeSlots[fileName] = records
+		}
+	}
+
+	return freeSlots, nil
+}
+
+func (glh *GitLockHandler) claimFreeSlot(lockName string, records []ClaimRecord) (string, error) {
+	err := glh.stageFreeSlot(lockName, records)
+	if err != nil {
+		return "", err
+	}
+
+	return glh.commit(fmt.Sprintf("claiming: %s\n%s", lockName, glh.buildUrl()))
+}
+
+// stageFreeSlot stages claiming a slot of a lock that is already claimed by
+// others without committing it, clearing out claims whose lease has expired
+// along the way.
+func (glh *GitLockHandler) stageFreeSlot(lockName string, records []ClaimRecord) error {
+	now := time.Now()
+
+	for _, record := range records {
+		if !record.Expired(now) {
+			continue
+		}
+
+		err := glh.removeClaimRecord(lockName, record.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return glh.recordClaim(lockName)
+}
+
+// releaseSlot releases a single claim on a lock with room for several
+// holders, or held in shared mode, and only unclaims the lock once nobody
+// else holds it.
+func (glh *GitLockHandler) releaseSlot(lockName string, claim string) (string, error) {
+	records, err := glh.readClaimRecords(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	capacity, err := glh.capacity(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	stillHeld := 0
+
+	for _, record := range records {
+		if record.ID != claim && !record.Expired(now) {
+			stillHeld++
+			continue
+		}
+
+		err := glh.removeClaimRecord(lockName, record.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if stillHeld > 0 && capacity > 1 {
+		return glh.commit(fmt.Sprintf("unclaiming: %s (still held by %d of %d)\n%s", lockName, stillHeld, capacity, glh.buildUrl()))
+	}
+
+	if stillHeld > 0 {
+		return glh.commit(fmt.Sprintf("unclaiming: %s (still shared by %d)\n%s", lockName, stillHeld, glh.buildUrl()))
+	}
+
+	err = glh.repo.Move(filepath.Join(glh.Source.Pool, "claimed", lockName), filepath.Join(glh.Source.Pool, "unclaimed", lockName))
+	if err != nil {
+		return "", err
+	}
+
+	err = glh.unmarkShared(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	return glh.commit(fmt.Sprintf("unclaiming: %s\n%s", lockName, glh.buildUrl()))
+}
+
+// claimExclusively claims a lock with room for several holders as its only
+// holder, once the claims of everyone else have been released or their
+// lease has expired, and keeps others from taking a slot of it meanwhile.
+func (glh *GitLockHandler) claimExclusively(lockName string) (string, error) {
+	_, err := os.Stat(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
+	if err == nil {
+		err = glh.repo.Move(filepath.Join(glh.Source.Pool, "unclaimed", lockName), filepath.Join(glh.Source.Pool, "claimed", lockName))
+		if err != nil {
+			return "", err
+		}
+	} else {
+		_, err = os.Stat(filepath.Join(glh.dir, glh.Source.Pool, "claimed", lockName))
+		if err != nil {
+			return "", ErrNoLocksAvailable
+		}
+
+		records, err := glh.readClaimRecords(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		if liveClaims(records, time.Now()) > 0 {
+			return "", ErrNoLocksAvailable
+		}
+
+		err = glh.removeClaimRecords(lockName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	record := NewClaimRecord(time.Now(), glh.Source.LeaseDuration, OwnerFromEnv())
+	record.Exclusive = true
+
+	err = glh.stageClaimRecord(lockName, record)
+	if err != nil {
+		return "", err
+	}
+
+	return glh.commit(fmt.Sprintf("claiming: %s (exclusive)\n%s", lockName, glh.buildUrl()))
+}
+
+// claimShared claims a lock in shared mode, alongside its other shared
+// holders if it already has some. A lock claimed exclusively is only taken
+// over once its lease has expired.
+func (glh *GitLockHandler) claimShared(lockName string) (string, error) {
+	_, err := os.Stat(filepath.Join(glh.dir, glh.Source.Pool, "unclaimed", lockName))
+	if err == nil {
+		err = glh.moveToClaimed(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		err = glh.markShared(lockName)
+		if err != nil {
+			return "", err
+		}
+
+		return glh.commit(fmt.Sprintf("claiming: %s (shared)\n%s", lockName, glh.buildUrl()))
+	}
+
+	shared, err := IsShared(glh.dir, glh.Source.Pool, lockName)
+	if err != nil {
+		return "", err
+	}
+
+	records, err := glh.readClaimRecords(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	if shared {
+		err = glh.stageFreeSlot(lockName, records)
+		if err != nil {
+			return "", err
+		}
+
+		return glh.commit(fmt.Sprintf("claiming: %s (shared)\n%s", lockName, glh.buildUrl()))
+	}
+
+	if !leaseExpired(records, time.Now()) {
+		return "", ErrNoLocksAvailable
+	}
+
+	expiredAt, err := glh.replaceExpiredClaim(lockName, records)
+	if err != nil {
+		return "", err
+	}
+
+	err = glh.markShared(lockName)
+	if err != nil {
+		return "", err
+	}
+
+	commitMessage := fmt.Sprintf("reclaiming: %s (shared, lease expired at %s)\n%s", lockName, expiredAt.Format(time.RFC3339), glh.buildUrl())
+	return glh.commit(commitMessage)
+}
+
+// heldBySeveral is true if releasing or renewing a claim on the lock leaves
+// its other holders alone.
+func (glh *GitLockHandler) heldBySeveral(lockName string) (bool, error) {
+	return HeldBySeveral(glh.dir, glh.Source.Pool, lockName)
+}
+
+// markShared stages marking a claimed lock as held in shared mode.
+func (glh *GitLockHandler) markShared(lockName string) error {
+	sharedPath := filepath.Join(glh.dir, SharedPath(glh.Source.Pool, lockName))
+
+	err := os.MkdirAll(filepath.Dir(sharedPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(sharedPath, nil, 0644)
+	if err != nil {
+		return err
+	}
+
+	return glh.repo.Add(sharedPath)
+}
+
+func (glh *GitLockHandler) unmarkShared(lockName string) error {
+	return glh.repo.RemoveIfPresent(SharedPath(glh.Source.Pool, lockName))
+}
+
+// recordClaim stores who claimed the lock, and until when if the pool is
+// configured with a lease duration.
+func (glh *GitLockHandler) recordClaim(lockName string) error {
+	return glh.stageClaimRecord(lockName, NewClaimRecord(time.Now(), glh.Source.LeaseDuration, OwnerFromEnv()))
+}
+
+// stageClaimRecord stages the record of a claim of this handler, which it
+// rolls back if the step is aborted.
+func (glh *GitLockHandler) stageClaimRecord(lockName string, record ClaimRecord) error {
+	err := glh.writeClaimRecord(lockName, record)
+	if err != nil {
+		return err
+	}
+
+	glh.claims.staged = append(glh.claims.staged, claimRef{pool: glh.Source.Pool, lock: lockName, id: record.ID})
+	return nil
+}
+
+// Holders lists the claimed locks of a pool, with a holder for each of the
+// claims on them.
+func (glh *GitLockHandler) Holders(pool string) ([]Holder, error) {
+	inPool := glh.inPool(pool)
+
+	err := glh.repo.Include(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	allFiles, err := os.ReadDir(filepath.Join(glh.dir, pool, "claimed"))
+	if err != nil {
+		return nil, err
+	}
+
+	var holders []Holder
+	for _, file := range allFiles {
+		fileName := filepath.Base(file.Name())
+		if strings.HasPrefix(fileName, ".") {
+			continue
+		}
+
+		records, err := inPool.readClaimRecords(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) == 0 {
+			holders = append(holders, Holder{Pool: pool, Lock: fileName})
+			continue
+		}
+
+		for _, record := range records {
+			holders = append(holders, Holder{Pool: pool, Lock: fileName, Owner: record.Owner})
+		}
+	}
+
+	return holders, nil
+}
+
+func (glh *GitLockHandler) expiredLocks() (map[string][]ClaimRecord, error) {
+	allFiles, err := os.ReadDir(filepath.Join(glh.dir, glh.Source.Pool, "claimed"))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiredLocks := map[string][]ClaimRecord{}
+
+	for _, file := range allFiles {
+		fileName := filepath.Base(file.Name())
+		if strings.HasPrefix(fileName, ".") {
+			continue
+		}
+
+		// locks with room for several holders free up a claim at a time
+		capacity, err := glh.capacity(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		if capacity > 1 {
+			continue
+		}
+
+		records, err := glh.readClaimRecords(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		if leaseExpired(records, now) {
+			expiredLocks[fileName] = records
+		}
+	}
+
+	return expiredLocks, nil
+}
+
+func (glh *GitLockHandler) claimRecordsDir(lockName string) string {
+	return filepath.Join(glh.Source.Pool, "claims", lockName)
+}
+
+func (glh *GitLockHandler) readClaimRecords(lockName string) ([]ClaimRecord, error) {
+	dir := filepath.Join(glh.dir, glh.claimRecordsDir(lockName))
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []ClaimRecord
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var record ClaimRecord
+		err = json.Unmarshal(contents, &record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid claim record %s for lock %s: %w", entry.Name(), lockName, err)
+		}
+		record.ID = entry.Name()
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (glh *GitLockHandler) writeClaimRecord(lockName string, record ClaimRecord) error {
+	dir := filepath.Join(glh.dir, glh.claimRecordsDir(lockName))
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	recordPath := filepath.Join(dir, record.ID)
+
+	err = os.WriteFile(recordPath, contents, 0644)
+	if err != nil {
+		return err
+	}
+
+	return glh.repo.Add(recordPath)
+}
+
+func (glh *GitLockHandler) removeClaimRecord(lockName string, id string) error {
+	return glh.repo.RemoveIfPresent(filepath.Join(glh.claimRecordsDir(lockName), id))
+}
+
+func (glh *GitLockHandler) removeClaimRecords(lockName string) error {
+	return glh.repo.RemoveIfPresent(glh.claimRecordsDir(lockName))
+}
+
+func (glh *GitLockHandler) commit(message string) (string, error) {
+	return glh.repo.Commit(message)
+}
+
+// liveClaims counts the claims whose lease has not expired.
+func liveClaims(records []ClaimRecord, now time.Time) int {
+	live := 0
+	for _, record := range records {
+		if !record.Expired(now) {
+			live++
+		}
+	}
+
+	return live
+}
+
+// heldExclusively is true when one of the claims whose lease has not expired
+// is exclusive.
+func heldExclusively(records []ClaimRecord, now time.Time) bool {
+	for _, record := range records {
+		if record.Exclusive && !record.Expired(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// leaseExpired is true when a lock has claim records and every one of them
+// has outlived its lease.
+func leaseExpired(records []ClaimRecord, now time.Time) bool {
+	if len(records) == 0 {
+		return false
+	}
+
+	for _, record := range records {
+		if !record.Expired(now) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (glh *GitLockHandler) BroadcastLockPool(ctx context.Context) (string, error) {
+	// validate if we're doing check only
+	if glh.checkOnly {
+		return "", nil
+	}
+
+	output, err := glh.repo.Push(ctx)
+
+	// a push that was cut short may still have gone through
+	if err == nil || ctx.Err() != nil {
+		glh.claims.pushed = append(glh.claims.pushed, glh.claims.staged...)
+		glh.claims.staged = nil
 	}
 
-	return contents, err
+	return output, err
 }
 
-func (glh *GitLockHandler) git(args ...string) (string, error) {
-	arguments := append([]string{"-C", glh.dir}, args...)
-	cmd := exec.Command("git", arguments...)
-	s, err := cmd.CombinedOutput()
-	return string(s), err
+func (glh *GitLockHandler) PushedVersion(version string) (string, error) {
+	return glh.repo.Pushed(version)
 }
 
 func (glh *GitLockHandler) buildUrl() string {
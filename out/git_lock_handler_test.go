@@ -0,0 +1,365 @@
+package out_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("GitLockHandler", func() {
+	var (
+		bareGitRepo string
+		cacheDir    string
+		tempDir     string
+		source      out.Source
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		bareGitRepo = createBareGitRepo()
+
+		cacheDir, err = os.MkdirTemp("", "repo-cache")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		// keeps track of the clones made outside of the cache
+		tempDir, err = os.MkdirTemp("", "temp-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+		GinkgoT().Setenv("TMPDIR", tempDir)
+
+		source = out.Source{
+			URI:    "file://" + bareGitRepo,
+			Branch: "master",
+			Pool:   "lock-pool",
+		}
+	})
+
+	AfterEach(func() {
+		for _, dir := range []string{bareGitRepo, cacheDir, tempDir} {
+			err := os.RemoveAll(dir)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	})
+
+	newHandler := func() *out.GitLockHandler {
+		handler := out.NewGitLockHandler(source)
+		handler.CacheDir = cacheDir
+
+		err := handler.Setup(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = handler.ResetLock(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return handler
+	}
+
+	cachedClones := func() []string {
+		clones, err := filepath.Glob(filepath.Join(cacheDir, "*", ".git"))
+		Ω(err).ShouldNot(HaveOccurred())
+		return clones
+	}
+
+	for _, engine := range []string{"git", "go-git"} {
+		Context("with the "+engine+" engine", func() {
+			BeforeEach(func() {
+				source.GitEngine = engine
+			})
+
+			It("reuses the cached clone in later handlers sharing the cache dir", func() {
+				handler := newHandler()
+
+				_, err := handler.ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = handler.BroadcastLockPool(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = handler.Cleanup()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(cachedClones()).Should(HaveLen(1))
+
+				marker := filepath.Join(cachedClones()[0], "reused")
+				err = os.WriteFile(marker, nil, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				handler = newHandler()
+				defer handler.Cleanup()
+
+				Ω(marker).Should(BeAnExistingFile())
+
+				_, err = handler.ClaimLock("some-lock", "")
+				Ω(err).Should(Equal(out.ErrNoLocksAvailable))
+			})
+
+			It("clones to a temporary directory while another handler uses the cache, and removes it again", func() {
+				handler := newHandler()
+				defer handler.Cleanup()
+
+				other := newHandler()
+
+				temporaryClones, err := os.ReadDir(tempDir)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(temporaryClones).Should(HaveLen(1))
+
+				err = other.Cleanup()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				temporaryClones, err = os.ReadDir(tempDir)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(temporaryClones).Should(BeEmpty())
+
+				Ω(cachedClones()).Should(HaveLen(1))
+			})
+
+			It("clones the repository again if the cached clone is unusable", func() {
+				handler := newHandler()
+
+				err := handler.Cleanup()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.RemoveAll(cachedClones()[0])
+				Ω(err).ShouldNot(HaveOccurred())
+
+				handler = newHandler()
+				defer handler.Cleanup()
+
+				Ω(cachedClones()).Should(HaveLen(1))
+
+				_, err = handler.ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	}
+
+	Describe("rolling back claims", func() {
+		claimedOnMaster := func() string {
+			claimed, err := exec.Command("git", "--git-dir", bareGitRepo, "ls-tree", "-r", "--name-only", "master", "lock-pool/claimed/").Output()
+			Ω(err).ShouldNot(HaveOccurred())
+			return string(claimed)
+		}
+
+		It("releases a claim that was pushed", func() {
+			handler := newHandler()
+			defer handler.Cleanup()
+
+			_, err := handler.ClaimLock("some-lock", "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = handler.BroadcastLockPool(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(claimedOnMaster()).Should(ContainSubstring("some-lock"))
+
+			err = handler.ResetLock(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = handler.RollBackClaims()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = handler.BroadcastLockPool(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(claimedOnMaster()).ShouldNot(ContainSubstring("some-lock"))
+		})
+
+		It("leaves alone a claim that never made it", func() {
+			handler := newHandler()
+			defer handler.Cleanup()
+
+			other := newHandler()
+			defer other.Cleanup()
+
+			for _, h := range []*out.GitLockHandler{other, handler} {
+				_, err := h.ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			_, err := other.BroadcastLockPool(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = handler.BroadcastLockPool(context.Background())
+			Ω(err).Should(MatchError(out.ErrLockConflict))
+
+			err = handler.ResetLock(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			head, err := handler.RollBackClaims()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = handler.BroadcastLockPool(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			master, err := exec.Command("git", "--git-dir", bareGitRepo, "rev-parse", "master").Output()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(strings.TrimSpace(string(master))).Should(Equal(head))
+
+			Ω(claimedOnMaster()).Should(ContainSubstring("some-lock"))
+		})
+	})
+
+	Describe("taking turns in a fair queue", func() {
+		var waiter *out.GitLockHandler
+
+		push := func(handler *out.GitLockHandler) {
+			_, err := handler.BroadcastLockPool(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			source.FairQueue = true
+			source.FairQueueTimeout = time.Minute
+
+			handler := newHandler()
+			defer handler.Cleanup()
+
+			_, err := handler.AddLock("some-other-lock", []byte("{}"), false)
+			Ω(err).ShouldNot(HaveOccurred())
+			push(handler)
+		})
+
+		AfterEach(func() {
+			waiter.Cleanup()
+		})
+
+		Context("when the build ahead waits for a specific lock that is held", func() {
+			BeforeEach(func() {
+				holder := newHandler()
+				defer holder.Cleanup()
+
+				_, err := holder.ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+				push(holder)
+
+				waiter = newHandler()
+
+				_, err = waiter.ClaimLock("some-lock", "")
+				Ω(err).Should(Equal(out.ErrNoLocksAvailable))
+
+				err = waiter.ResetLock(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, err = waiter.Enqueue("some-lock", 0)
+				Ω(err).ShouldNot(HaveOccurred())
+				push(waiter)
+			})
+
+			It("lets others acquire the locks that are free", func() {
+				acquirer := newHandler()
+				defer acquirer.Cleanup()
+
+				locks, _, err := acquirer.GrabAvailableLock(out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(locks).Should(Equal(map[string][]string{"lock-pool": {"some-other-lock"}}))
+			})
+
+			It("has others after the same lock wait behind it", func() {
+				claimer := newHandler()
+				defer claimer.Cleanup()
+
+				_, err := claimer.ClaimLock("some-lock", "")
+				Ω(err).Should(MatchError(out.NotYourTurnError{Ahead: 1}))
+			})
+		})
+
+		Context("when the build ahead waits for a specific lock that is free", func() {
+			BeforeEach(func() {
+				waiter = newHandler()
+
+				_, _, err := waiter.Enqueue("some-lock", 0)
+				Ω(err).ShouldNot(HaveOccurred())
+				push(waiter)
+			})
+
+			It("has others after any lock wait behind it, as they may take it", func() {
+				acquirer := newHandler()
+				defer acquirer.Cleanup()
+
+				_, _, err := acquirer.GrabAvailableLock(out.AcquireParams{Enabled: true})
+				Ω(err).Should(MatchError(out.ErrNotYourTurn))
+			})
+
+			It("lets others claim a different lock", func() {
+				claimer := newHandler()
+				defer claimer.Cleanup()
+
+				_, err := claimer.ClaimLock("some-other-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when the ticket of the build went stale and was removed by others", func() {
+			BeforeEach(func() {
+				source.FairQueueTimeout = time.Millisecond
+
+				waiter = newHandler()
+
+				_, _, err := waiter.Enqueue("some-lock", 0)
+				Ω(err).ShouldNot(HaveOccurred())
+				push(waiter)
+
+				time.Sleep(10 * time.Millisecond)
+
+				claimer := newHandler()
+				defer claimer.Cleanup()
+
+				_, err = claimer.ClaimLock("some-other-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+				push(claimer)
+			})
+
+			It("leaves the queue without pushing anything", func() {
+				err := waiter.ResetLock(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = waiter.LeaveQueue()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = waiter.BroadcastLockPool(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	It("fetches the history left out of a shallow clone once it is needed", func() {
+		handler := newHandler()
+
+		ref, err := handler.ClaimLock("some-lock", "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = handler.BroadcastLockPool(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = handler.AddLock("another-lock", []byte("{}"), false)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = handler.BroadcastLockPool(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = handler.Cleanup()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.RemoveAll(cacheDir)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handler = newHandler()
+		defer handler.Cleanup()
+
+		shallow := filepath.Join(cachedClones()[0], "shallow")
+		Ω(shallow).Should(BeAnExistingFile())
+
+		err = handler.VerifyClaim("some-lock", ref, "")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(shallow).ShouldNot(BeAnExistingFile())
+	})
+})
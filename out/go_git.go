@@ -0,0 +1,647 @@
+package out
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// goGit works with the repository in process using go-git, and tells a push
+// that lost a race with someone else's apart from other failures by
+// comparing the histories rather than by parsing the output of git.
+type goGit struct {
+	source Source
+	dir    string
+
+	repo   *git.Repository
+	auth   transport.AuthMethod
+	author object.Signature
+}
+
+func newGoGit(source Source) gitEngine {
+	return &goGit{source: source}
+}
+
+// Clone makes a full clone, as go-git cannot deepen a shallow one once the
+// history turns out to be needed.
+func (gg *goGit) Clone(ctx context.Context, dir string) error {
+	var err error
+
+	gg.dir = dir
+
+	gg.auth, err = gg.authMethod()
+	if err != nil {
+		return err
+	}
+
+	gg.repo, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:             gg.source.URI,
+		Auth:            gg.auth,
+		ReferenceName:   gg.branch(),
+		SingleBranch:    true,
+		InsecureSkipTLS: gg.source.SkipSSLVerification,
+	})
+	if err != nil {
+		return fmt.Errorf("cloning %s: %w", gg.source.URI, err)
+	}
+
+	gg.useIdentity()
+
+	return nil
+}
+
+func (gg *goGit) Open(dir string) error {
+	var err error
+
+	gg.dir = dir
+
+	gg.auth, err = gg.authMethod()
+	if err != nil {
+		return err
+	}
+
+	gg.repo, err = git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+
+	remote, err := gg.repo.Remote("origin")
+	if err != nil {
+		return err
+	}
+
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != gg.source.URI {
+		return fmt.Errorf("%s is not a clone of %s", dir, gg.source.URI)
+	}
+
+	gg.useIdentity()
+
+	return nil
+}
+
+// Include has nothing to do, as go-git always makes a full clone.
+func (gg *goGit) Include(dirs ...string) error {
+	return nil
+}
+
+// useIdentity commits as the configured identity if there is one, like the
+// git binary does.
+func (gg *goGit) useIdentity() {
+	gg.author = object.Signature{Name: "CI Pool Resource", Email: "ci-pool@localhost"}
+
+	cfg, err := gg.repo.ConfigScoped(config.GlobalScope)
+	if err == nil && cfg.User.Name != "" {
+		gg.author.Name = cfg.User.Name
+	}
+	if err == nil && cfg.User.Email != "" {
+		gg.author.Email = cfg.User.Email
+	}
+}
+
+// authMethod uses the private key of the source for SSH URIs, and its
+// username and password for HTTP(S) URIs. Just like the scripts that
+// configure the git binary, it does not check host keys.
+func (gg *goGit) authMethod() (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(gg.source.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		if gg.source.PrivateKey == "" {
+			return nil, nil
+		}
+
+		user := gg.source.PrivateKeyUser
+		if user == "" {
+			user = endpoint.User
+		}
+		if user == "" {
+			user = "git"
+		}
+
+		keys, err := ssh.NewPublicKeys(user, []byte(gg.source.PrivateKey), gg.source.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key: %w", err)
+		}
+		keys.HostKeyCallback = gossh.InsecureIgnoreHostKey()
+
+		return keys, nil
+	case "http", "https":
+		if gg.source.Username == "" || gg.source.Password == "" {
+			return nil, nil
+		}
+
+		return &http.BasicAuth{Username: gg.source.Username, Password: gg.source.Password}, nil
+	}
+
+	return nil, nil
+}
+
+func (gg *goGit) Reset(ctx context.Context) error {
+	err := gg.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	remote, err := gg.repo.Reference(gg.remoteBranch(), true)
+	if err != nil {
+		return err
+	}
+
+	worktree, err := gg.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	err = worktree.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.HardReset})
+	if err != nil {
+		return err
+	}
+
+	// unlike the git binary, a hard reset leaves behind files that were
+	// added but never committed
+	return worktree.Clean(&git.CleanOptions{Dir: true})
+}
+
+// Pull catches up with the branch. Nothing is ever committed without
+// pushing it in between, so there is nothing to merge.
+func (gg *goGit) Pull() error {
+	return gg.Reset(context.Background())
+}
+
+func (gg *goGit) Add(path string) error {
+	worktree, err := gg.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	relativePath, err := gg.relative(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = worktree.Add(relativePath)
+	return err
+}
+
+func (gg *goGit) Move(from string, to string) error {
+	worktree, err := gg.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	relativeFrom, err := gg.relative(from)
+	if err != nil {
+		return err
+	}
+
+	relativeTo, err := gg.relative(to)
+	if err != nil {
+		return err
+	}
+
+	_, err = worktree.Move(relativeFrom, relativeTo)
+	return err
+}
+
+func (gg *goGit) Remove(path string) error {
+	worktree, err := gg.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	relativePath, err := gg.relative(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = worktree.Remove(relativePath)
+	return err
+}
+
+func (gg *goGit) RemoveIfPresent(path string) error {
+	worktree, err := gg.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	relativePath, err := gg.relative(path)
+	if err != nil {
+		return err
+	}
+
+	index, err := gg.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	var tracked []string
+	for _, entry := range index.Entries {
+		if entry.Name == relativePath || strings.HasPrefix(entry.Name, relativePath+"/") {
+			tracked = append(tracked, entry.Name)
+		}
+	}
+
+	for _, name := range tracked {
+		_, err := worktree.Remove(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (gg *goGit) Commit(message string) (string, error) {
+	worktree, err := gg.repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	author := gg.author
+	author.When = time.Now()
+
+	hash, err := worktree.Commit(message, &git.CommitOptions{Author: &author})
+	if err != nil {
+		return "", err
+	}
+
+	return hash.String(), nil
+}
+
+func (gg *goGit) Head() (string, error) {
+	head, err := gg.repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return head.Hash().String(), nil
+}
+
+func (gg *goGit) ChangedSince(ref string, path string) (bool, error) {
+	since, err := gg.commitAt(ref)
+	if err != nil {
+		return false, err
+	}
+
+	head, err := gg.commitAt("HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	before := map[plumbing.Hash]bool{}
+	err = object.NewCommitPreorderIter(since, nil, nil).ForEach(func(commit *object.Commit) error {
+		before[commit.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	err = object.NewCommitPreorderIter(head, before, nil).ForEach(func(commit *object.Commit) error {
+		touched, err := changesPath(commit, filepath.ToSlash(path))
+		if err != nil {
+			return err
+		}
+
+		if touched {
+			changed = true
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return changed, nil
+}
+
+func (gg *goGit) FilesAt(ref string, dir string) ([]string, error) {
+	commit, err := gg.commitAt(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := subtree(commit, filepath.ToSlash(dir))
+	if err != nil || tree == nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range tree.Entries {
+		files = append(files, path.Join(filepath.ToSlash(dir), entry.Name))
+	}
+
+	return files, nil
+}
+
+func (gg *goGit) AddedFiles(dirs ...string) ([]string, error) {
+	head, err := gg.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := gg.repo.Log(&git.LogOptions{From: head.Hash(), Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	err = commits.ForEach(func(commit *object.Commit) error {
+		// like git log, don't list the changes merged by a merge commit
+		if commit.NumParents() > 1 {
+			return nil
+		}
+
+		var parent *object.Commit
+		if commit.NumParents() == 1 {
+			parent, err = commit.Parent(0)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, dir := range dirs {
+			dir = filepath.ToSlash(dir)
+
+			files, err := addedWithin(parent, commit, dir)
+			if err != nil {
+				return err
+			}
+
+			added = append(added, files...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+func (gg *goGit) Push(ctx context.Context) (string, error) {
+	// go-git turns down a push that would not fast-forward the branch with
+	// an error of no type of its own, so that is checked for up front
+	overtaken, err := gg.overtaken(ctx)
+	if err != nil {
+		return err.Error(), err
+	}
+
+	if overtaken {
+		return "", NonFastForwardError{Branch: gg.source.Branch}
+	}
+
+	refSpec := config.RefSpec(fmt.Sprintf("%s:%s", gg.branch(), gg.branch()))
+
+	err = gg.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName:      "origin",
+		RefSpecs:        []config.RefSpec{refSpec},
+		Auth:            gg.auth,
+		InsecureSkipTLS: gg.source.SkipSSLVerification,
+	})
+
+	// someone else pushed the very same commit, claiming the same lock in
+	// the same second
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err.Error(), ErrLockConflict
+	}
+
+	if errors.Is(err, git.ErrForceNeeded) {
+		return err.Error(), NonFastForwardError{Branch: gg.source.Branch}
+	}
+
+	if err != nil {
+		return err.Error(), err
+	}
+
+	return "", nil
+}
+
+// Pushed returns ref, as commits are pushed as they are.
+func (gg *goGit) Pushed(ref string) (string, error) {
+	return ref, nil
+}
+
+// overtaken is true if the branch, as the remote lists it, has moved on to
+// a commit that ours are not based on.
+func (gg *goGit) overtaken(ctx context.Context) (bool, error) {
+	remote, err := gg.repo.Remote("origin")
+	if err != nil {
+		return false, err
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth:            gg.auth,
+		InsecureSkipTLS: gg.source.SkipSSLVerification,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	index := slices.IndexFunc(refs, func(ref *plumbing.Reference) bool {
+		return ref.Name() == gg.branch()
+	})
+	if index == -1 {
+		return false, nil
+	}
+
+	head, err := gg.commitAt("HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	if refs[index].Hash() == head.Hash {
+		return false, nil
+	}
+
+	// a commit we do not even have is one ours are not based on
+	branch, err := gg.repo.CommitObject(refs[index].Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	isAncestor, err := branch.IsAncestor(head)
+	if err != nil {
+		return false, err
+	}
+
+	return !isAncestor, nil
+}
+
+func (gg *goGit) fetch(ctx context.Context) error {
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", gg.branch(), gg.remoteBranch()))
+
+	err := gg.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName:      "origin",
+		RefSpecs:        []config.RefSpec{refSpec},
+		Auth:            gg.auth,
+		Force:           true,
+		InsecureSkipTLS: gg.source.SkipSSLVerification,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+
+	return err
+}
+
+func (gg *goGit) commitAt(ref string) (*object.Commit, error) {
+	hash, err := gg.repo.ResolveRevision(plumbing.Revision(strings.TrimSpace(ref)))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+
+	return gg.repo.CommitObject(*hash)
+}
+
+func (gg *goGit) relative(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(filepath.Clean(path)), nil
+	}
+
+	relativePath, err := filepath.Rel(gg.dir, path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(relativePath), nil
+}
+
+func (gg *goGit) branch() plumbing.ReferenceName {
+	return plumbing.NewBranchReferenceName(gg.source.Branch)
+}
+
+func (gg *goGit) remoteBranch() plumbing.ReferenceName {
+	return plumbing.NewRemoteReferenceName("origin", gg.source.Branch)
+}
+
+// changesPath is true if a commit changed the file at path, compared to each
+// of its parents.
+func changesPath(commit *object.Commit, path string) (bool, error) {
+	hash, err := entryHash(commit, path)
+	if err != nil {
+		return false, err
+	}
+
+	if commit.NumParents() == 0 {
+		return !hash.IsZero(), nil
+	}
+
+	changed := true
+	err = commit.Parents().ForEach(func(parent *object.Commit) error {
+		parentHash, err := entryHash(parent, path)
+		if err != nil {
+			return err
+		}
+
+		if parentHash == hash {
+			changed = false
+		}
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// entryHash is the hash of the file at path in a commit, or the zero hash
+// if there is no such file.
+func entryHash(commit *object.Commit, path string) (plumbing.Hash, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	entry, err := tree.FindEntry(path)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return entry.Hash, nil
+}
+
+// subtree is the tree of dir in a commit, or nil if there is no such
+// directory.
+func subtree(commit *object.Commit, dir string) (*object.Tree, error) {
+	if commit == nil {
+		return nil, nil
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	dirTree, err := tree.Tree(dir)
+	if errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, nil
+	}
+
+	return dirTree, err
+}
+
+// addedWithin lists the files a commit added within dir, compared to its
+// parent, which is nil for the first commit.
+func addedWithin(parent *object.Commit, commit *object.Commit, dir string) ([]string, error) {
+	before, err := subtree(parent, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := subtree(commit, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if before == nil && after == nil {
+		return nil, nil
+	}
+
+	changes, err := object.DiffTree(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		if action == merkletrie.Insert {
+			added = append(added, path.Join(dir, change.To.Name))
+		}
+	}
+
+	return added, nil
+}
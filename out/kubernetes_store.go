@@ -0,0 +1,237 @@
+package out
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultKubernetesConfigMap = "pool-resource"
+
+	// kubernetesStateKey is the key of the config map that holds the state,
+	// as the keys of a config map cannot be the paths of the files of a pool.
+	kubernetesStateKey = "state.json"
+
+	// kubernetesStateLimit is how large the state may get, leaving room for
+	// the rest of the config map below the 1 MiB the API server accepts.
+	kubernetesStateLimit = 900 * 1024
+)
+
+// KubernetesSource configures where the kubernetes backend keeps the pool.
+type KubernetesSource struct {
+	Namespace string `json:"namespace,omitempty"`
+	ConfigMap string `json:"config_map,omitempty" mapstructure:"config_map"`
+
+	// the service account of the worker is used if no kubeconfig is given
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+}
+
+func (k KubernetesSource) validate() []string {
+	var errorMessages []string
+
+	if k.Namespace == "" {
+		errorMessages = append(errorMessages, "invalid payload (missing kubernetes.namespace)")
+	}
+
+	if k.Context != "" && k.Kubeconfig == "" {
+		errorMessages = append(errorMessages, "invalid payload (kubernetes.context requires a kubernetes.kubeconfig)")
+	}
+
+	return errorMessages
+}
+
+// kubernetesStore keeps the whole state of the pool in a config map. Saving
+// updates the config map as it was loaded, by its resourceVersion, which the
+// API server refuses with a 409 Conflict if someone else updated it since.
+type kubernetesStore struct {
+	source    KubernetesSource
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	// the config map last loaded or saved, or nil if there was none
+	configMap *corev1.ConfigMap
+}
+
+func newKubernetesStore(source Source) PoolStore {
+	return NewKubernetesStore(nil, source.Kubernetes)
+}
+
+// NewKubernetesStore keeps the pool in a config map with the given client,
+// e.g. a fake clientset, or with one configured by the source if it is nil.
+func NewKubernetesStore(client kubernetes.Interface, source KubernetesSource) PoolStore {
+	name := source.ConfigMap
+	if name == "" {
+		name = defaultKubernetesConfigMap
+	}
+
+	return &kubernetesStore{
+		source:    source,
+		client:    client,
+		namespace: source.Namespace,
+		name:      name,
+	}
+}
+
+func (store *kubernetesStore) Load(ctx context.Context) (PoolState, error) {
+	var state PoolState
+
+	client, err := store.connect()
+	if err != nil {
+		return state, err
+	}
+
+	configMap, err := client.CoreV1().ConfigMaps(store.namespace).Get(ctx, store.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// the pool is empty until it is first changed
+		store.configMap = nil
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("loading config map %s/%s: %w", store.namespace, store.name, err)
+	}
+
+	if contents, found := configMap.Data[kubernetesStateKey]; found {
+		err = json.Unmarshal([]byte(contents), &state)
+		if err != nil {
+			return state, fmt.Errorf("reading config map %s/%s: %w", store.namespace, store.name, err)
+		}
+	}
+
+	store.configMap = configMap
+
+	return state, nil
+}
+
+func (store *kubernetesStore) Save(ctx context.Context, state PoolState) (int64, error) {
+	client, err := store.connect()
+	if err != nil {
+		return 0, err
+	}
+
+	contents, err := fitConfigMap(state)
+	if err != nil {
+		return 0, fmt.Errorf("saving config map %s/%s: %w", store.namespace, store.name, err)
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(store.namespace)
+
+	var saved *corev1.ConfigMap
+	if store.configMap == nil {
+		saved, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: store.name, Namespace: store.namespace},
+			Data:       map[string]string{kubernetesStateKey: string(contents)},
+		}, metav1.CreateOptions{})
+	} else {
+		// the config map keeps the resourceVersion it was loaded with
+		configMap := store.configMap.DeepCopy()
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[kubernetesStateKey] = string(contents)
+
+		saved, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		return 0, ErrLockConflict
+	}
+	if err != nil {
+		return 0, fmt.Errorf("saving config map %s/%s: %w", store.namespace, store.name, err)
+	}
+
+	store.configMap = saved
+
+	return state.Revision, nil
+}
+
+// fitConfigMap marshals the state, forgetting as much of its history as it
+// takes to fit a config map: first the contents of removed files, then the
+// oldest changes, along with the files they removed.
+func fitConfigMap(state PoolState) ([]byte, error) {
+	contents, err := json.Marshal(state)
+	if err != nil || len(contents) <= kubernetesStateLimit {
+		return contents, err
+	}
+
+	state = state.Clone()
+
+	for path, file := range state.Removed {
+		file.Contents = ""
+		state.Removed[path] = file
+	}
+
+	for {
+		contents, err = json.Marshal(state)
+		if err != nil || len(contents) <= kubernetesStateLimit {
+			return contents, err
+		}
+
+		if len(state.Log) == 0 {
+			return nil, fmt.Errorf("the files of the pool take up %d bytes, more than the %d bytes a config map can hold", len(contents), kubernetesStateLimit)
+		}
+
+		state.Log = state.Log[(len(state.Log)+3)/4:]
+
+		first := state.FirstRevision()
+		for path, file := range state.Removed {
+			if file.Removed <= first {
+				delete(state.Removed, path)
+			}
+		}
+	}
+}
+
+// connect creates the client the first time it is needed, as loading the
+// configuration may fail.
+func (store *kubernetesStore) connect() (kubernetes.Interface, error) {
+	if store.client != nil {
+		return store.client, nil
+	}
+
+	var config *rest.Config
+	var err error
+
+	if store.source.Kubeconfig == "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		config, err = kubeconfigRESTConfig(store.source.Kubeconfig, store.source.Context)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuring kubernetes client: %w", err)
+	}
+
+	store.client, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("configuring kubernetes client: %w", err)
+	}
+
+	return store.client, nil
+}
+
+func kubeconfigRESTConfig(kubeconfig string, contextName string) (*rest.Config, error) {
+	clientConfig, err := clientcmd.NewClientConfigFromBytes([]byte(kubeconfig))
+	if err != nil {
+		return nil, err
+	}
+
+	if contextName == "" {
+		return clientConfig.ClientConfig()
+	}
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return clientcmd.NewNonInteractiveClientConfig(rawConfig, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+}
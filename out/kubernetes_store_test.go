@@ -0,0 +1,231 @@
+package out_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+// checkResourceVersions has the fake clientset set the resourceVersion of
+// config maps, and refuse updates to them that are not of the latest one, as
+// the API server does.
+func checkResourceVersions(clientset *fake.Clientset) {
+	var latest int
+
+	clientset.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		configMap := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap)
+
+		latest++
+		configMap.ResourceVersion = strconv.Itoa(latest)
+
+		return false, nil, nil
+	})
+
+	clientset.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		configMap := action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap)
+
+		current, err := clientset.Tracker().Get(action.GetResource(), configMap.Namespace, configMap.Name)
+		if err != nil {
+			return true, nil, err
+		}
+
+		if current.(*corev1.ConfigMap).ResourceVersion != configMap.ResourceVersion {
+			return true, nil, apierrors.NewConflict(action.GetResource().GroupResource(), configMap.Name, nil)
+		}
+
+		latest++
+		configMap.ResourceVersion = strconv.Itoa(latest)
+
+		return false, nil, nil
+	})
+}
+
+var _ = Describe("Kubernetes store", func() {
+	var (
+		clientset *fake.Clientset
+		source    out.Source
+	)
+
+	BeforeEach(func() {
+		clientset = fake.NewClientset()
+		checkResourceVersions(clientset)
+
+		source = out.Source{
+			Backend: "kubernetes",
+			Kubernetes: out.KubernetesSource{
+				Namespace: "some-namespace",
+				ConfigMap: "some-pools",
+			},
+			Pool:       "lock-pool",
+			RetryDelay: 10 * time.Millisecond,
+		}
+	})
+
+	newStore := func() out.PoolStore {
+		return out.NewKubernetesStore(clientset, source.Kubernetes)
+	}
+
+	claimSomeLock := func(state *out.PoolState) {
+		files := state.Contents()
+		files["lock-pool/claimed/some-lock"] = "{}\n"
+		delete(files, "lock-pool/unclaimed/some-lock")
+		state.Commit(files, "claiming: some-lock")
+	}
+
+	savedState := func() out.PoolState {
+		configMap, err := clientset.CoreV1().ConfigMaps("some-namespace").Get(context.Background(), "some-pools", metav1.GetOptions{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var state out.PoolState
+		err = json.Unmarshal([]byte(configMap.Data["state.json"]), &state)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return state
+	}
+
+	Context("when there is no config map yet", func() {
+		It("loads an empty pool, and creates the config map on saving", func() {
+			store := newStore()
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.Revision).Should(BeZero())
+			Ω(state.Files).Should(BeEmpty())
+
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(savedState().Contents()).Should(Equal(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}))
+		})
+
+		It("reports a conflict if someone else created it in the meantime", func() {
+			stores := []out.PoolStore{newStore(), newStore()}
+
+			var states []out.PoolState
+			for _, store := range stores {
+				state, err := store.Load(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+				states = append(states, state)
+			}
+
+			_, err := stores[0].Save(context.Background(), states[0])
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = stores[1].Save(context.Background(), states[1])
+			Ω(err).Should(Equal(out.ErrLockConflict))
+		})
+	})
+
+	Context("when the pool is in a config map", func() {
+		BeforeEach(func() {
+			var state out.PoolState
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			contents, err := json.Marshal(state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = clientset.CoreV1().ConfigMaps("some-namespace").Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-pools", Namespace: "some-namespace"},
+				Data:       map[string]string{"state.json": string(contents)},
+			}, metav1.CreateOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("reports a conflict when the config map was updated since it was loaded, as its resourceVersion no longer matches", func() {
+			store := newStore()
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			claimSomeLock(&state)
+
+			configMap, err := clientset.CoreV1().ConfigMaps("some-namespace").Get(context.Background(), "some-pools", metav1.GetOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			configMap.Labels = map[string]string{"touched": "true"}
+			_, err = clientset.CoreV1().ConfigMaps("some-namespace").Update(context.Background(), configMap, metav1.UpdateOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).Should(Equal(out.ErrLockConflict))
+
+			Ω(savedState().Revision).Should(Equal(int64(1)))
+		})
+
+		It("fails when the config map cannot be loaded", func() {
+			clientset.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(action.GetResource().GroupResource(), "some-pools", nil)
+			})
+
+			_, err := newStore().Load(context.Background())
+			Ω(err).Should(MatchError(ContainSubstring("loading config map some-namespace/some-pools")))
+		})
+
+		itIsAPoolStore(newStore, func() out.Source { return source })
+	})
+
+	Context("when the history of the pool outgrows a config map", func() {
+		var state out.PoolState
+
+		BeforeEach(func() {
+			state = out.PoolState{}
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			metadata := strings.Repeat("x", 4096)
+			for i := range 300 {
+				files := state.Contents()
+				files[fmt.Sprintf("lock-pool/unclaimed/lock-%d", i)] = metadata
+				state.Commit(files, "adding a lock")
+
+				delete(files, fmt.Sprintf("lock-pool/unclaimed/lock-%d", i))
+				state.Commit(files, "removing a lock")
+			}
+		})
+
+		It("forgets as much of it as it takes to fit", func() {
+			_, err := newStore().Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			configMap, err := clientset.CoreV1().ConfigMaps("some-namespace").Get(context.Background(), "some-pools", metav1.GetOptions{})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(len(configMap.Data["state.json"])).Should(BeNumerically("<", 1024*1024))
+
+			Ω(savedState().Revision).Should(Equal(state.Revision))
+			Ω(savedState().Contents()).Should(Equal(state.Contents()))
+		})
+
+		It("fails clearly when the files of the pool alone do not fit", func() {
+			files := state.Contents()
+			files["lock-pool/unclaimed/huge-lock"] = strings.Repeat("x", 1024*1024)
+			state.Commit(files, "adding huge-lock")
+
+			_, err := newStore().Save(context.Background(), state)
+			Ω(err).Should(MatchError(ContainSubstring("more than the 921600 bytes a config map can hold")))
+		})
+	})
+
+	It("fails when given a kubeconfig that is not one", func() {
+		source.Kubernetes.Kubeconfig = "bogus"
+
+		_, err := out.NewPoolStore(source).Load(context.Background())
+		Ω(err).Should(MatchError(ContainSubstring("configuring kubernetes client")))
+	})
+})
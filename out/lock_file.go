@@ -0,0 +1,64 @@
+package out
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+const lockFilePollInterval = 10 * time.Millisecond
+
+// lockFile takes an exclusive lock on the file at path, which is released
+// once the returned file is closed, or the process exits. It returns nil if
+// someone else holds the lock.
+func lockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		file.Close()
+		return nil, nil
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// waitForLockFile takes a lock on the file at path, either a shared lock or
+// an exclusive one depending on how, waiting for as long as someone else
+// holds a conflicting lock, unless ctx is done first. The lock is released
+// once the returned file is closed.
+func waitForLockFile(ctx context.Context, path string, how int) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err = syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			break
+		}
+
+		err = sleep(ctx, lockFilePollInterval)
+		if err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -1,6 +1,7 @@
 package out
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,9 +15,18 @@ type LockPool struct {
 	Source Source
 	Output io.Writer
 
+	// Timeout limits how long acquiring, claiming, updating and checking a
+	// lock wait for it. They wait for as long as it takes if it is zero.
+	Timeout time.Duration
+
 	LockHandler LockHandler
 	dir         string
 	checkOnly   bool
+	deadline    time.Time
+
+	// refreshBy is when the ticket of a build waiting in the fair queue is
+	// due to be refreshed, which no wait between retries goes past
+	refreshBy time.Time
 }
 
 func NewLockPool(source Source, output io.Writer) LockPool {
@@ -24,7 +34,12 @@ func NewLockPool(source Source, output io.Writer) LockPool {
 		Source: source,
 		Output: output,
 	}
-	lockPool.LockHandler = NewGitLockHandler(source)
+
+	if store := NewPoolStore(source); store != nil {
+		lockPool.LockHandler = NewStoreLockHandler(source, store)
+	} else {
+		lockPool.LockHandler = NewGitLockHandler(source)
+	}
 
 	return lockPool
 }
@@ -33,76 +48,441 @@ func NewLockPool(source Source, output io.Writer) LockPool {
 
 //counterfeiter:generate -o ./fakes . LockHandler
 type LockHandler interface {
-	GrabAvailableLock() (lock string, version string, err error)
-	UnclaimLock(lock string) (version string, err error)
+	GrabAvailableLock(acquire AcquireParams) (locks map[string][]string, version string, err error)
+	UnclaimLock(lock string, claim string) (version string, err error)
 	AddLock(lock string, contents []byte, initiallyClaimed bool) (version string, err error)
 	RemoveLock(lock string) (version string, err error)
-	ClaimLock(lock string) (version string, err error)
+	ClaimLock(lock string, mode ClaimMode) (version string, err error)
 	UpdateLock(lock string, contents []byte) (version string, err error)
-	CheckLock(lock string) (version string, err error)
+	CheckLock(lock string, mode ClaimMode) (version string, err error)
 	CheckUnclaimedLock(lock string) (version string, err error)
+	VerifyClaim(lock string, ref string, claim string) error
+	RenewLock(lock string, claim string) (version string, err error)
+	Enqueue(lock string, priority int) (ticket string, version string, err error)
+	RefreshTicket() (version string, err error)
+	LeaveQueue() (version string, err error)
+	Holders(pool string) ([]Holder, error)
+	CurrentVersion() (version string, err error)
+
+	// RollBackClaims releases the claims that were pushed, or may have been
+	// pushed, by a step that was aborted since.
+	RollBackClaims() (version string, err error)
+
+	// Setup, ResetLock and BroadcastLockPool talk to wherever the pool is
+	// kept, and give up once ctx is done.
+	Setup(ctx context.Context) error
+	BroadcastLockPool(ctx context.Context) (string, error)
+
+	// PushedVersion returns the version a change made at the given version
+	// was broadcast as, which differs from it for stores that save changes
+	// on top of those made by others in the meantime.
+	PushedVersion(version string) (string, error)
+	ResetLock(ctx context.Context) error
+	Cleanup() error
+}
+
+// cleanupTimeout is how long cleaning up after a step, such as rolling back
+// its claims, may take once the step has been aborted.
+const cleanupTimeout = 10 * time.Second
 
-	Setup() error
-	BroadcastLockPool() (string, error)
-	ResetLock() error
+// Close cleans up after the lock handler, e.g. the clone of the repository
+// it made.
+func (lp *LockPool) Close() error {
+	return lp.LockHandler.Cleanup()
 }
 
-func (lp *LockPool) ClaimLock(lock string) (Version, error) {
+func (lp *LockPool) ClaimLock(ctx context.Context, lock string, mode ClaimMode) (Version, error) {
 	var ref string
 
 	fmt.Fprintf(lp.Output, "claiming lock on: %s\n", lp.Source.Pool)
+	if mode == SharedMode {
+		fmt.Fprintf(lp.Output, "in shared mode\n")
+	}
 	fmt.Fprintf(lp.Output, "waiting for lock\n")
 
-	err := lp.performRobustAction(func() (bool, error) {
+	lp.startClock()
+
+	err := lp.waitForLock(ctx, lock, 0, lp.Source.Pool, func() error {
 		var err error
+		ref, err = lp.LockHandler.ClaimLock(lock, mode)
+		return err
+	})
 
-		ref, err = lp.LockHandler.ClaimLock(lock)
+	if ctx.Err() != nil {
+		lp.rollBack(ctx)
+		return Version{}, context.Cause(ctx)
+	}
 
-		if err == ErrNoLocksAvailable {
-			fmt.Fprint(lp.Output, ".")
-			return true, nil
+	if errors.Is(err, ErrTimedOut) {
+		return Version{}, lp.timedOut(ctx, []string{lp.Source.Pool}, lock)
+	}
+
+	if err != nil {
+		return Version{}, err
+	}
+
+	fmt.Fprintf(lp.Output, "\nclaimed!\n")
+
+	return lp.pushedVersion(ref)
+}
+
+func (lp *LockPool) AcquireLock(ctx context.Context) (string, Version, error) {
+	locks, version, err := lp.AcquireLocks(ctx, AcquireParams{Enabled: true})
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	return locks[lp.Source.Pool][0], version, nil
+}
+
+// AcquireLocks acquires locks as configured by the acquire param: a single
+// lock from the pool by default, or several locks from one or more pools of
+// the same repository all at once.
+func (lp *LockPool) AcquireLocks(ctx context.Context, acquire AcquireParams) (map[string][]string, Version, error) {
+	var (
+		locks map[string][]string
+		ref   string
+	)
+
+	if len(acquire.Pools) == 0 {
+		acquire.Pools = []string{lp.Source.Pool}
+	}
+
+	if acquire.Count < 1 {
+		acquire.Count = 1
+	}
+
+	pools, count := acquire.Pools, acquire.Count
+	poolNames := strings.Join(pools, ", ")
+
+	if count == 1 && len(pools) == 1 {
+		fmt.Fprintf(lp.Output, "acquiring lock on: %s\n", poolNames)
+		fmt.Fprintf(lp.Output, "waiting for lock\n")
+	} else if len(pools) == 1 {
+		fmt.Fprintf(lp.Output, "acquiring %d locks on: %s\n", count, poolNames)
+		fmt.Fprintf(lp.Output, "waiting for locks\n")
+	} else {
+		fmt.Fprintf(lp.Output, "acquiring %d lock(s) on each of: %s\n", count, poolNames)
+		fmt.Fprintf(lp.Output, "waiting for locks\n")
+	}
+
+	if len(acquire.Match) > 0 {
+		fmt.Fprintf(lp.Output, "only locks matching: %s\n", acquire.Match)
+	}
+
+	if acquire.Priority != 0 {
+		fmt.Fprintf(lp.Output, "with priority: %d\n", acquire.Priority)
+	}
+
+	lp.startClock()
+
+	err := lp.waitForLock(ctx, "", acquire.Priority, poolNames, func() error {
+		var err error
+		locks, ref, err = lp.LockHandler.GrabAvailableLock(acquire)
+		return err
+	})
+
+	if ctx.Err() != nil {
+		lp.rollBack(ctx)
+		return nil, Version{}, context.Cause(ctx)
+	}
+
+	if errors.Is(err, ErrTimedOut) {
+		return nil, Version{}, lp.timedOut(ctx, pools, "")
+	}
+
+	if err != nil {
+		return nil, Version{}, err
+	}
+
+	fmt.Fprintf(lp.Output, "\nacquired!\n")
+
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return nil, Version{}, err
+	}
+
+	return locks, version, nil
+}
+
+// TryAcquireLocks is AcquireLocks without the waiting. If the locks are not
+// available, or others are waiting for them in a fair queue, it acquires
+// nothing and returns the current version of the pool instead.
+func (lp *LockPool) TryAcquireLocks(ctx context.Context, acquire AcquireParams) (map[string][]string, Version, bool, error) {
+	var (
+		locks    map[string][]string
+		ref      string
+		acquired bool
+	)
+
+	if len(acquire.Pools) == 0 {
+		acquire.Pools = []string{lp.Source.Pool}
+	}
+
+	poolNames := strings.Join(acquire.Pools, ", ")
+
+	fmt.Fprintf(lp.Output, "trying to acquire lock(s) on: %s\n", poolNames)
+
+	err := lp.performRobustAction(ctx, func() (bool, error) {
+		var err error
+		locks, ref, err = lp.LockHandler.GrabAvailableLock(acquire)
+
+		if err == ErrNoLocksAvailable || errors.Is(err, ErrNotYourTurn) {
+			acquired = false
+			ref, err = lp.LockHandler.CurrentVersion()
+			return false, err
 		}
 
 		if err != nil {
-			fmt.Fprintf(lp.Output, "\nfailed to acquire lock on pool: %s! (err: %s) retrying...\n", lp.Source.Pool, err)
-			return true, nil
+			fmt.Fprintf(lp.Output, "\nfailed to acquire lock on pool: %s! (err: %s) retrying...\n", poolNames, err)
+			return true, err
 		}
 
+		acquired = true
 		return false, nil
 	})
 
+	if ctx.Err() != nil {
+		lp.rollBack(ctx)
+		return nil, Version{}, false, context.Cause(ctx)
+	}
+
 	if err != nil {
-		return Version{}, err
+		return nil, Version{}, false, err
 	}
 
-	fmt.Fprintf(lp.Output, "\nclaimed!\n")
+	if acquired {
+		fmt.Fprintf(lp.Output, "acquired!\n")
+	} else {
+		locks = nil
+		fmt.Fprintf(lp.Output, "no locks available, moving on\n")
+	}
 
-	return Version{
-		Ref: strings.TrimSpace(ref),
-	}, err
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return nil, Version{}, false, err
+	}
+
+	return locks, version, acquired, nil
 }
 
-func (lp *LockPool) AcquireLock() (string, Version, error) {
-	var (
-		lock string
-		ref  string
-	)
+var errJoinQueue = errors.New("others are waiting for a lock")
 
-	fmt.Fprintf(lp.Output, "acquiring lock on: %s\n", lp.Source.Pool)
-	fmt.Fprintf(lp.Output, "waiting for lock\n")
+// waitForLock retries claim until it succeeds. In a pool with a fair queue,
+// builds that cannot claim straight away join the queue, and wait for their
+// turn rather than racing everyone else for every lock that is released.
+// Builds with a higher priority are served first.
+func (lp *LockPool) waitForLock(ctx context.Context, wants string, priority int, poolNames string, claim func() error) error {
+	err := lp.performRobustAction(ctx, func() (bool, error) {
+		err := claim()
 
-	err := lp.performRobustAction(func() (bool, error) {
-		var err error
-		lock, ref, err = lp.LockHandler.GrabAvailableLock()
+		if err == ErrNoLocksAvailable || errors.Is(err, ErrNotYourTurn) {
+			if lp.Source.FairQueue {
+				return false, errJoinQueue
+			}
 
-		if err == ErrNoLocksAvailable {
 			fmt.Fprint(lp.Output, ".")
 			return true, nil
 		}
 
 		if err != nil {
-			fmt.Fprintf(lp.Output, "\nfailed to acquire lock on pool: %s! (err: %s) retrying...\n", lp.Source.Pool, err)
-			return true, nil
+			fmt.Fprintf(lp.Output, "\nfailed to acquire lock on pool: %s! (err: %s) retrying...\n", poolNames, err)
+			return true, err
+		}
+
+		return false, nil
+	})
+
+	if !errors.Is(err, errJoinQueue) {
+		return err
+	}
+
+	return lp.waitInQueue(ctx, wants, priority, poolNames, claim)
+}
+
+func (lp *LockPool) waitInQueue(ctx context.Context, wants string, priority int, poolNames string, claim func() error) error {
+	var (
+		joined      bool
+		refreshedAt time.Time
+		ahead       = -1
+	)
+
+	defer func() { lp.refreshBy = time.Time{} }()
+
+	for {
+		var (
+			claimed bool
+			ticket  string
+		)
+
+		err := lp.performRobustAction(ctx, func() (bool, error) {
+			var err error
+
+			refreshDue := lp.Source.FairQueueTimeout > 0 && time.Since(refreshedAt) >= lp.Source.FairQueueTimeout/2
+
+			if joined && !refreshDue {
+				err = claim()
+
+				if err == nil {
+					claimed = true
+					return false, nil
+				}
+
+				if err == ErrNoLocksAvailable || errors.Is(err, ErrNotYourTurn) {
+					ahead = lp.showPlaceInQueue(err, ahead)
+					return true, nil
+				}
+
+				if err == ErrTicketLost {
+					fmt.Fprintf(lp.Output, "\nour ticket went stale and was removed from the queue! joining it again...\n")
+					joined = false
+					return true, nil
+				}
+
+				fmt.Fprintf(lp.Output, "\nfailed to acquire lock on pool: %s! (err: %s) retrying...\n", poolNames, err)
+				return true, err
+			}
+
+			if !joined {
+				ticket, _, err = lp.LockHandler.Enqueue(wants, priority)
+
+				if err != nil {
+					fmt.Fprintf(lp.Output, "\nfailed to join the queue of pool: %s! (err: %s) retrying...\n", lp.Source.Pool, err)
+					return true, err
+				}
+
+				return false, nil
+			}
+
+			_, err = lp.LockHandler.RefreshTicket()
+
+			if err == ErrTicketLost {
+				fmt.Fprintf(lp.Output, "\nour ticket went stale and was removed from the queue! joining it again...\n")
+				joined = false
+				return true, nil
+			}
+
+			if err != nil {
+				fmt.Fprintf(lp.Output, "\nfailed to refresh our ticket in the queue of pool: %s! (err: %s) retrying...\n", lp.Source.Pool, err)
+				return true, err
+			}
+
+			return false, nil
+		})
+
+		if (errors.Is(err, ErrTimedOut) || ctx.Err() != nil) && joined {
+			lp.leaveQueue(ctx)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if claimed {
+			return nil
+		}
+
+		if !joined {
+			fmt.Fprintf(lp.Output, "\nwaiting in the queue of pool: %s with ticket: %s\n", lp.Source.Pool, ticket)
+		}
+
+		joined = true
+		refreshedAt = time.Now()
+
+		if lp.Source.FairQueueTimeout > 0 {
+			lp.refreshBy = refreshedAt.Add(lp.Source.FairQueueTimeout / 2)
+		}
+	}
+}
+
+// showPlaceInQueue prints a dot for every attempt to claim while waiting in
+// the queue, starting a new line whenever the number of builds ahead changes.
+func (lp *LockPool) showPlaceInQueue(err error, shownAhead int) int {
+	ahead := 0
+
+	var notYourTurn NotYourTurnError
+	if errors.As(err, &notYourTurn) {
+		ahead = notYourTurn.Ahead
+	}
+
+	if ahead != shownAhead {
+		if ahead == 0 {
+			fmt.Fprintf(lp.Output, "\nfirst in the queue, waiting for a lock")
+		} else {
+			fmt.Fprintf(lp.Output, "\n%d ahead in the queue", ahead)
+		}
+	}
+
+	fmt.Fprint(lp.Output, ".")
+
+	return ahead
+}
+
+func (lp *LockPool) ReleaseLock(ctx context.Context, inDir string, force bool) (string, Version, error) {
+	var (
+		lockNames []string
+		claimRefs []string
+		claims    []string
+	)
+
+	for _, lockDir := range fetchedLockDirs(inDir) {
+		nameFileContents, err := os.ReadFile(filepath.Join(lockDir, "name"))
+		if err != nil {
+			return "", Version{}, err
+		}
+		lockName := strings.TrimSpace(string(nameFileContents))
+
+		var claimRef string
+		if !force {
+			refFileContents, err := os.ReadFile(filepath.Join(lockDir, "ref"))
+			if err != nil && !os.IsNotExist(err) {
+				return "", Version{}, fmt.Errorf("could not read the ref file of your lock: %s", err)
+			}
+
+			claimRef = strings.TrimSpace(string(refFileContents))
+			if claimRef == "" {
+				fmt.Fprintf(lp.Output, "no ref file found for lock: %s, releasing it without checking who holds it\n", lockName)
+			}
+		}
+
+		claim, err := readClaimFile(lockDir)
+		if err != nil {
+			return "", Version{}, err
+		}
+
+		fmt.Fprintf(lp.Output, "releasing lock: %s on pool: %s\n", lockName, lp.Source.Pool)
+
+		lockNames = append(lockNames, lockName)
+		claimRefs = append(claimRefs, claimRef)
+		claims = append(claims, claim)
+	}
+
+	var ref string
+	err := lp.performRobustAction(ctx, func() (bool, error) {
+		// locks acquired together are released together in a single push
+		for i, lockName := range lockNames {
+			var err error
+
+			if claimRefs[i] != "" {
+				err = lp.LockHandler.VerifyClaim(lockName, claimRefs[i], claims[i])
+
+				if err == ErrLockLost {
+					fmt.Fprintf(lp.Output, "\nthe lock: %s has been released or claimed by someone else since %s! set force_release to release it anyway\n", lockName, claimRefs[i])
+					return false, err
+				}
+
+				if err != nil {
+					fmt.Fprintf(lp.Output, "\nfailed to verify the claim on the lock: %s! (err: %s)\n", lockName, err)
+					return false, err
+				}
+			}
+
+			ref, err = lp.LockHandler.UnclaimLock(lockName, claims[i])
+
+			if err != nil {
+				fmt.Fprintf(lp.Output, "\nfailed to unclaim the lock: %s! (err: %s)\n", lockName, err)
+				return false, err
+			}
 		}
 
 		return false, nil
@@ -112,30 +492,118 @@ func (lp *LockPool) AcquireLock() (string, Version, error) {
 		return "", Version{}, err
 	}
 
-	fmt.Fprintf(lp.Output, "\nacquired!\n")
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return "", Version{}, err
+	}
 
-	return lock, Version{
-		Ref: strings.TrimSpace(ref),
-	}, nil
+	return strings.Join(lockNames, ","), version, nil
 }
 
-func (lp *LockPool) ReleaseLock(inDir string) (string, Version, error) {
-	nameFileContents, err := os.ReadFile(filepath.Join(inDir, "name"))
+// fetchedLockDirs returns the directories holding the name of each lock
+// fetched into inDir. When several locks were acquired at once, each of
+// them is fetched into its own subdirectory.
+func fetchedLockDirs(inDir string) []string {
+	_, err := os.Stat(filepath.Join(inDir, "name"))
+	if !os.IsNotExist(err) {
+		return []string{inDir}
+	}
+
+	entries, err := os.ReadDir(inDir)
 	if err != nil {
-		return "", Version{}, err
+		return []string{inDir}
 	}
-	lockName := strings.TrimSpace(string(nameFileContents))
 
-	fmt.Fprintf(lp.Output, "releasing lock: %s on pool: %s\n", lockName, lp.Source.Pool)
+	var lockDirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
 
-	var ref string
-	err = lp.performRobustAction(func() (bool, error) {
-		var err error
-		ref, err = lp.LockHandler.UnclaimLock(lockName)
+		_, err := os.Stat(filepath.Join(inDir, entry.Name(), "name"))
+		if err == nil {
+			lockDirs = append(lockDirs, filepath.Join(inDir, entry.Name()))
+		}
+	}
+
+	if len(lockDirs) == 0 {
+		return []string{inDir}
+	}
+
+	return lockDirs
+}
 
+// readClaimFile returns the id of the claim a lock was fetched with, which
+// tells apart the holders of a lock with room for several of them. Locks
+// fetched before claims were recorded have none.
+func readClaimFile(lockDir string) (string, error) {
+	contents, err := os.ReadFile(filepath.Join(lockDir, "claim"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("could not read the claim file of your lock: %s", err)
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+func (lp *LockPool) RenewLock(ctx context.Context, inDir string) (string, Version, error) {
+	var (
+		lockNames []string
+		claimRefs []string
+		claims    []string
+	)
+
+	for _, lockDir := range fetchedLockDirs(inDir) {
+		nameFileContents, err := os.ReadFile(filepath.Join(lockDir, "name"))
 		if err != nil {
-			fmt.Fprintf(lp.Output, "\nfailed to unclaim the lock: %s! (err: %s)\n", lockName, err)
-			return false, err
+			return "", Version{}, fmt.Errorf("could not read the name file of your lock: %s", err)
+		}
+		lockName := strings.TrimSpace(string(nameFileContents))
+
+		refFileContents, err := os.ReadFile(filepath.Join(lockDir, "ref"))
+		if err != nil {
+			return "", Version{}, fmt.Errorf("could not read the ref file of your lock: %s", err)
+		}
+
+		claim, err := readClaimFile(lockDir)
+		if err != nil {
+			return "", Version{}, err
+		}
+
+		fmt.Fprintf(lp.Output, "renewing lock: %s on pool: %s\n", lockName, lp.Source.Pool)
+
+		lockNames = append(lockNames, lockName)
+		claimRefs = append(claimRefs, strings.TrimSpace(string(refFileContents)))
+		claims = append(claims, claim)
+	}
+
+	var ref string
+
+	err := lp.performRobustAction(ctx, func() (bool, error) {
+		// locks acquired together are renewed together in a single push
+		for i, lockName := range lockNames {
+			err := lp.LockHandler.VerifyClaim(lockName, claimRefs[i], claims[i])
+
+			if err == ErrLockLost {
+				fmt.Fprintf(lp.Output, "\nthe lock: %s has been released or claimed by someone else since %s!\n", lockName, claimRefs[i])
+				return false, err
+			}
+
+			if err != nil {
+				fmt.Fprintf(lp.Output, "\nfailed to verify the claim on the lock: %s! (err: %s)\n", lockName, err)
+				return false, err
+			}
+
+			ref, err = lp.LockHandler.RenewLock(lockName, claims[i])
+
+			if err == ErrNoLease {
+				fmt.Fprintf(lp.Output, "\nthe lock: %s was not claimed with a lease!\n", lockName)
+				return false, err
+			}
+
+			if err != nil {
+				fmt.Fprintf(lp.Output, "\nfailed to renew the lock: %s! (err: %s) retrying...\n", lockName, err)
+				return true, err
+			}
 		}
 
 		return false, nil
@@ -145,20 +613,25 @@ func (lp *LockPool) ReleaseLock(inDir string) (string, Version, error) {
 		return "", Version{}, err
 	}
 
-	return lockName, Version{
-		Ref: strings.TrimSpace(ref),
-	}, nil
+	fmt.Fprintf(lp.Output, "\nrenewed!\n")
+
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	return strings.Join(lockNames, ","), version, nil
 }
 
-func (lp *LockPool) AddClaimedLock(inDir string) (string, Version, error) {
-	return lp.addLock(inDir, true)
+func (lp *LockPool) AddClaimedLock(ctx context.Context, inDir string) (string, Version, error) {
+	return lp.addLock(ctx, inDir, true)
 }
 
-func (lp *LockPool) AddUnclaimedLock(inDir string) (string, Version, error) {
-	return lp.addLock(inDir, false)
+func (lp *LockPool) AddUnclaimedLock(ctx context.Context, inDir string) (string, Version, error) {
+	return lp.addLock(ctx, inDir, false)
 }
 
-func (lp *LockPool) addLock(inDir string, initiallyClaimed bool) (string, Version, error) {
+func (lp *LockPool) addLock(ctx context.Context, inDir string, initiallyClaimed bool) (string, Version, error) {
 	nameFileContents, err := os.ReadFile(filepath.Join(inDir, "name"))
 	if err != nil {
 		return "", Version{}, fmt.Errorf("could not read the name file of your lock: %s", err)
@@ -178,13 +651,13 @@ func (lp *LockPool) addLock(inDir string, initiallyClaimed bool) (string, Versio
 
 	var ref string
 
-	err = lp.performRobustAction(func() (bool, error) {
+	err = lp.performRobustAction(ctx, func() (bool, error) {
 		var err error
 		ref, err = lp.LockHandler.AddLock(lockName, lockContents, initiallyClaimed)
 
 		if err != nil {
 			fmt.Fprintf(lp.Output, "failed to add the lock: %s! (err: %s) retrying...\n", lockName, err)
-			return true, nil
+			return true, err
 		}
 
 		return false, nil
@@ -194,12 +667,15 @@ func (lp *LockPool) addLock(inDir string, initiallyClaimed bool) (string, Versio
 		return "", Version{}, err
 	}
 
-	return lockName, Version{
-		Ref: strings.TrimSpace(ref),
-	}, nil
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	return lockName, version, nil
 }
 
-func (lp *LockPool) RemoveLock(inDir string) (string, Version, error) {
+func (lp *LockPool) RemoveLock(ctx context.Context, inDir string) (string, Version, error) {
 	nameFileContents, err := os.ReadFile(filepath.Join(inDir, "name"))
 	if err != nil {
 		return "", Version{}, err
@@ -211,7 +687,7 @@ func (lp *LockPool) RemoveLock(inDir string) (string, Version, error) {
 
 	var ref string
 
-	err = lp.performRobustAction(func() (bool, error) {
+	err = lp.performRobustAction(ctx, func() (bool, error) {
 		var err error
 		ref, err = lp.LockHandler.RemoveLock(lockName)
 
@@ -227,12 +703,15 @@ func (lp *LockPool) RemoveLock(inDir string) (string, Version, error) {
 		return "", Version{}, err
 	}
 
-	return lockName, Version{
-		Ref: strings.TrimSpace(ref),
-	}, nil
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	return lockName, version, nil
 }
 
-func (lp *LockPool) UpdateLock(inDir string) (string, Version, error) {
+func (lp *LockPool) UpdateLock(ctx context.Context, inDir string) (string, Version, error) {
 	nameFileContents, err := os.ReadFile(filepath.Join(inDir, "name"))
 	if err != nil {
 		return "", Version{}, fmt.Errorf("could not read the name file of your lock: %s", err)
@@ -249,7 +728,9 @@ func (lp *LockPool) UpdateLock(inDir string) (string, Version, error) {
 
 	var ref string
 
-	err = lp.performRobustAction(func() (bool, error) {
+	lp.startClock()
+
+	err = lp.performRobustAction(ctx, func() (bool, error) {
 		var err error
 		ref, err = lp.LockHandler.UpdateLock(lockName, lockContents)
 
@@ -260,24 +741,33 @@ func (lp *LockPool) UpdateLock(inDir string) (string, Version, error) {
 
 		if err != nil {
 			fmt.Fprintf(lp.Output, "failed to update the lock: %s! (err: %s) retrying...\n", lockName, err)
-			return true, nil
+			return true, err
 		}
 
 		return false, nil
 	})
 
+	if errors.Is(err, ErrTimedOut) {
+		return "", Version{}, lp.timedOut(ctx, []string{lp.Source.Pool}, lockName)
+	}
+
 	if err != nil {
 		return "", Version{}, err
 	}
 
 	fmt.Fprintf(lp.Output, "\nupdated!\n")
 
-	return lockName, Version{
-		Ref: strings.TrimSpace(ref),
-	}, nil
+	version, err := lp.pushedVersion(ref)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	return lockName, version, nil
 }
 
-func (lp *LockPool) CheckLock(inDir string) (string, Version, error) {
+// CheckLock waits until the lock is unclaimed, or in shared mode until it
+// has no exclusive holder.
+func (lp *LockPool) CheckLock(ctx context.Context, inDir string, mode ClaimMode) (string, Version, error) {
 	nameFileContents, err := os.ReadFile(filepath.Join(inDir, "name"))
 	if err != nil {
 		return "", Version{}, fmt.Errorf("could not read the file name of your lock: %s", err)
@@ -285,13 +775,19 @@ func (lp *LockPool) CheckLock(inDir string) (string, Version, error) {
 	lockName := strings.TrimSpace(string(nameFileContents))
 
 	fmt.Fprintf(lp.Output, "checking lock: %s in pool: %s\n", lockName, lp.Source.Pool)
-	fmt.Fprintf(lp.Output, "waiting for lock to become unclaimed\n")
+	if mode == SharedMode {
+		fmt.Fprintf(lp.Output, "waiting for lock to have no exclusive holder\n")
+	} else {
+		fmt.Fprintf(lp.Output, "waiting for lock to become unclaimed\n")
+	}
 
 	var ref string
 
-	err = lp.performRobustAction(func() (bool, error) {
+	lp.startClock()
+
+	err = lp.performRobustAction(ctx, func() (bool, error) {
 		var err error
-		ref, err = lp.LockHandler.CheckLock(lockName)
+		ref, err = lp.LockHandler.CheckLock(lockName, mode)
 
 		if err == ErrLockActive {
 			fmt.Fprint(lp.Output, ".")
@@ -300,11 +796,15 @@ func (lp *LockPool) CheckLock(inDir string) (string, Version, error) {
 
 		if err != nil {
 			fmt.Fprintf(lp.Output, "failed to check the lock: %s! (err: %s) retrying...\n", lockName, err)
-			return true, nil
+			return true, err
 		}
 		return false, nil
 	})
 
+	if errors.Is(err, ErrTimedOut) {
+		return "", Version{}, lp.timedOut(ctx, []string{lp.Source.Pool}, lockName)
+	}
+
 	if err != nil {
 		return "", Version{}, err
 	}
@@ -314,7 +814,7 @@ func (lp *LockPool) CheckLock(inDir string) (string, Version, error) {
 	}, nil
 }
 
-func (lp *LockPool) CheckUnclaimedLock(inDir string) (string, Version, error) {
+func (lp *LockPool) CheckUnclaimedLock(ctx context.Context, inDir string) (string, Version, error) {
 	nameFileContents, err := os.ReadFile(filepath.Join(inDir, "name"))
 	if err != nil {
 		return "", Version{}, fmt.Errorf("could not read the file name of your lock: %s", err)
@@ -326,7 +826,9 @@ func (lp *LockPool) CheckUnclaimedLock(inDir string) (string, Version, error) {
 
 	var ref string
 
-	err = lp.performRobustAction(func() (bool, error) {
+	lp.startClock()
+
+	err = lp.performRobustAction(ctx, func() (bool, error) {
 		var err error
 		ref, err = lp.LockHandler.CheckUnclaimedLock(lockName)
 
@@ -337,11 +839,15 @@ func (lp *LockPool) CheckUnclaimedLock(inDir string) (string, Version, error) {
 
 		if err != nil {
 			fmt.Fprintf(lp.Output, "failed to check the lock: %s! (err: %s) retrying...\n", lockName, err)
-			return true, nil
+			return true, err
 		}
 		return false, nil
 	})
 
+	if errors.Is(err, ErrTimedOut) {
+		return "", Version{}, lp.timedOut(ctx, []string{lp.Source.Pool}, lockName)
+	}
+
 	if err != nil {
 		return "", Version{}, err
 	}
@@ -351,49 +857,209 @@ func (lp *LockPool) CheckUnclaimedLock(inDir string) (string, Version, error) {
 	}, nil
 }
 
-func (lp *LockPool) performRobustAction(action func() (bool, error)) error {
-	err := lp.LockHandler.Setup()
+// startClock starts the timeout of an operation that waits for a lock.
+func (lp *LockPool) startClock() {
+	if lp.Timeout > 0 {
+		lp.deadline = time.Now().Add(lp.Timeout)
+	}
+}
+
+func (lp *LockPool) pastDeadline() bool {
+	return !lp.deadline.IsZero() && time.Now().After(lp.deadline)
+}
+
+// timedOut describes who holds the locks of the given pools after waiting
+// for them timed out, or only who holds lock if it is given.
+func (lp *LockPool) timedOut(ctx context.Context, pools []string, lock string) error {
+	timeoutErr := TimeoutError{Timeout: lp.Timeout}
+
+	err := lp.LockHandler.ResetLock(ctx)
+	if err != nil {
+		return timeoutErr
+	}
+
+	for _, pool := range pools {
+		holders, err := lp.LockHandler.Holders(pool)
+		if err != nil {
+			return timeoutErr
+		}
+
+		for _, holder := range holders {
+			if lock == "" || holder.Lock == lock {
+				timeoutErr.Holders = append(timeoutErr.Holders, holder)
+			}
+		}
+	}
+
+	return timeoutErr
+}
+
+// leaveQueue makes way for the builds behind us after giving up waiting in
+// the queue, or being aborted, rather than having them wait for our ticket to
+// go stale.
+func (lp *LockPool) leaveQueue(ctx context.Context) {
+	lp.deadline = time.Time{}
+	lp.refreshBy = time.Time{}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	err := lp.performRobustAction(ctx, func() (bool, error) {
+		_, err := lp.LockHandler.LeaveQueue()
+		return false, err
+	})
+
+	if err != nil {
+		fmt.Fprintf(lp.Output, "\nfailed to leave the queue of pool: %s! (err: %s)\n", lp.Source.Pool, err)
+	}
+}
+
+// rollBack releases any claim pushed by a step that was aborted, which would
+// otherwise be left behind by a build that is never going to release it.
+func (lp *LockPool) rollBack(ctx context.Context) {
+	lp.deadline = time.Time{}
+
+	fmt.Fprintf(lp.Output, "\naborted! (%s) rolling back...\n", context.Cause(ctx))
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	err := lp.performRobustAction(ctx, func() (bool, error) {
+		_, err := lp.LockHandler.RollBackClaims()
+		return false, err
+	})
+
+	if err != nil {
+		fmt.Fprintf(lp.Output, "\nfailed to roll back the claims on pool: %s! (err: %s)\n", lp.Source.Pool, err)
+	}
+}
+
+// sleep waits for d, unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
+
+// wait waits for d between retries, but no longer than until our ticket in
+// the fair queue is due to be refreshed, so that a long backoff does not let
+// it go stale.
+func (lp *LockPool) wait(ctx context.Context, d time.Duration) error {
+	if !lp.refreshBy.IsZero() {
+		d = min(d, time.Until(lp.refreshBy))
+	}
+
+	return sleep(ctx, d)
+}
+
+// pushedVersion returns the version a change made at ref was broadcast as.
+func (lp *LockPool) pushedVersion(ref string) (Version, error) {
+	pushed, err := lp.LockHandler.PushedVersion(strings.TrimSpace(ref))
+	if err != nil {
+		return Version{}, err
+	}
+
+	return Version{Ref: pushed}, nil
+}
+
+func (lp *LockPool) performRobustAction(ctx context.Context, action func() (bool, error)) error {
+	err := lp.LockHandler.Setup(ctx)
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
 	if err != nil {
 		return fmt.Errorf("setup: %w", err)
 	}
 
-	unexpectedErrorRetry := 0
-	for unexpectedErrorRetry < 5 {
-		err = lp.LockHandler.ResetLock()
+	backoff := lp.Source.RetryBackoff.WithDefaults(lp.Source.RetryDelay)
+
+	var noLocksRetry, conflictRetry, unexpectedErrorRetry int
+	for unexpectedErrorRetry < backoff.MaxUnexpectedErrors {
+		err = lp.LockHandler.ResetLock(ctx)
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 		if err != nil {
 			return fmt.Errorf("reset lock: %w", err)
 		}
 
 		retry, err := action()
 
+		// an action that failed but is worth trying again backs off, and
+		// counts towards giving up, like any other unexpected error
+		if err != nil && retry {
+			unexpectedErrorRetry++
+
+			err = lp.wait(ctx, backoff.UnexpectedError.Delay(unexpectedErrorRetry))
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		if err != nil {
 			return fmt.Errorf("action: %w", err)
 		}
 
 		if retry {
-			time.Sleep(lp.Source.RetryDelay)
+			if lp.pastDeadline() {
+				return ErrTimedOut
+			}
+
+			noLocksRetry++
+			err = lp.wait(ctx, backoff.NoLocks.Delay(noLocksRetry))
+			if err != nil {
+				return err
+			}
+
 			continue
 		}
 
-		gitOutput, err := lp.LockHandler.BroadcastLockPool()
+		gitOutput, err := lp.LockHandler.BroadcastLockPool(ctx)
+
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		if errors.Is(err, ErrLockConflict) {
+			if lp.pastDeadline() {
+				return ErrTimedOut
+			}
 
-		if err == ErrLockConflict {
 			fmt.Fprint(lp.Output, ".")
-			time.Sleep(lp.Source.RetryDelay)
+
+			conflictRetry++
+			err = lp.wait(ctx, backoff.Conflict.Delay(conflictRetry))
+			if err != nil {
+				return err
+			}
+
 			continue
 		}
 
 		if err != nil {
 			unexpectedErrorRetry++
 			fmt.Fprintf(lp.Output, "\nfailed to broadcast the change to lock state!\nerr: %s\ngit-err: %s\nretrying...\n", err, gitOutput)
-			time.Sleep(lp.Source.RetryDelay)
+
+			err = lp.wait(ctx, backoff.UnexpectedError.Delay(unexpectedErrorRetry))
+			if err != nil {
+				return err
+			}
+
 			continue
 		}
 
 		break
 	}
 
-	if unexpectedErrorRetry == 5 {
+	if unexpectedErrorRetry == backoff.MaxUnexpectedErrors {
 		return errors.New("too-many-unexpected-errors")
 	}
 
@@ -1,6 +1,7 @@
 package out_test
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -18,6 +19,7 @@ var _ = Describe("Lock Pool", func() {
 	var lockPool out.LockPool
 	var fakeLockHandler *fakes.FakeLockHandler
 	var output *gbytes.Buffer
+	var ctx context.Context
 
 	ValidateSharedBehaviorDuringBroadcastFailures := func(operationUnderTest func() error, additionalValidation func(int)) {
 
@@ -31,7 +33,7 @@ var _ = Describe("Lock Pool", func() {
 				BeforeEach(func() {
 					called := false
 
-					fakeLockHandler.BroadcastLockPoolStub = func() (string, error) {
+					fakeLockHandler.BroadcastLockPoolStub = func(context.Context) (string, error) {
 						// succeed on second call
 						if !called {
 							called = true
@@ -71,7 +73,7 @@ var _ = Describe("Lock Pool", func() {
 				BeforeEach(func() {
 					called := false
 
-					fakeLockHandler.BroadcastLockPoolStub = func() (string, error) {
+					fakeLockHandler.BroadcastLockPoolStub = func(context.Context) (string, error) {
 						// succeed on second call
 						if !called {
 							called = true
@@ -96,7 +98,12 @@ var _ = Describe("Lock Pool", func() {
 	}
 
 	BeforeEach(func() {
+		ctx = context.Background()
+
 		fakeLockHandler = new(fakes.FakeLockHandler)
+		fakeLockHandler.PushedVersionStub = func(version string) (string, error) {
+			return version, nil
+		}
 
 		output = gbytes.NewBuffer()
 
@@ -129,7 +136,7 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when a name file doesn't exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.RemoveLock(lockDir)
+				_, _, err := lockPool.RemoveLock(ctx, lockDir)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -146,14 +153,14 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.RemoveLock(lockDir)
+					_, _, err := lockPool.RemoveLock(ctx, lockDir)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
 
 			Context("when setup succeeds", func() {
 				It("tries to reset the lock state", func() {
-					_, _, err := lockPool.RemoveLock(lockDir)
+					_, _, err := lockPool.RemoveLock(ctx, lockDir)
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(1))
@@ -165,14 +172,14 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("returns an error", func() {
-						_, _, err := lockPool.RemoveLock(lockDir)
+						_, _, err := lockPool.RemoveLock(ctx, lockDir)
 						Ω(err).Should(HaveOccurred())
 					})
 				})
 
 				Context("when resetting the lock state succeeds", func() {
 					It("tries to remove the lock it found in the name file", func() {
-						_, _, err := lockPool.RemoveLock(lockDir)
+						_, _, err := lockPool.RemoveLock(ctx, lockDir)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.RemoveLockCallCount()).Should(Equal(1))
@@ -186,7 +193,7 @@ var _ = Describe("Lock Pool", func() {
 						})
 
 						It("returns an error", func() {
-							_, _, err := lockPool.RemoveLock(lockDir)
+							_, _, err := lockPool.RemoveLock(ctx, lockDir)
 							Ω(err).Should(HaveOccurred())
 							Ω(fakeLockHandler.RemoveLockCallCount()).Should(Equal(1))
 						})
@@ -198,7 +205,7 @@ var _ = Describe("Lock Pool", func() {
 						})
 
 						It("tries to broadcast to the lock pool", func() {
-							_, _, err := lockPool.RemoveLock(lockDir)
+							_, _, err := lockPool.RemoveLock(ctx, lockDir)
 							Ω(err).ShouldNot(HaveOccurred())
 
 							Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -206,7 +213,7 @@ var _ = Describe("Lock Pool", func() {
 
 						ValidateSharedBehaviorDuringBroadcastFailures(
 							func() error {
-								_, _, err := lockPool.RemoveLock(lockDir)
+								_, _, err := lockPool.RemoveLock(ctx, lockDir)
 								return err
 							}, func(expectedNumberOfInteractions int) {
 								Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -215,7 +222,7 @@ var _ = Describe("Lock Pool", func() {
 
 						Context("when broadcasting succeeds", func() {
 							It("returns the lockname, and a version", func() {
-								lockName, version, err := lockPool.RemoveLock(lockDir)
+								lockName, version, err := lockPool.RemoveLock(ctx, lockDir)
 
 								Ω(err).ShouldNot(HaveOccurred())
 								Ω(lockName).Should(Equal("some-remove-lock"))
@@ -231,13 +238,17 @@ var _ = Describe("Lock Pool", func() {
 	})
 
 	Context("Acquiring a lock", func() {
+		BeforeEach(func() {
+			fakeLockHandler.GrabAvailableLockReturns(map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+		})
+
 		Context("when setup fails", func() {
 			BeforeEach(func() {
 				fakeLockHandler.SetupReturns(errors.New("some-error"))
 			})
 
 			It("returns an error", func() {
-				_, _, err := lockPool.AcquireLock()
+				_, _, err := lockPool.AcquireLock(ctx)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -250,48 +261,49 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.AcquireLock()
+					_, _, err := lockPool.AcquireLock(ctx)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
 
 			Context("when resetting the lock succeeds", func() {
 				It("tries to acquire an available lock", func() {
-					_, _, err := lockPool.AcquireLock()
+					_, _, err := lockPool.AcquireLock(ctx)
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(1))
+					Ω(fakeLockHandler.GrabAvailableLockArgsForCall(0)).Should(Equal(out.AcquireParams{
+						Enabled: true,
+						Count:   1,
+						Pools:   []string{"my-pool"},
+					}))
 				})
 
 				Context("when grabbing an available lock fails", func() {
 					BeforeEach(func() {
 						called := false
 
-						fakeLockHandler.GrabAvailableLockStub = func() (string, string, error) {
+						fakeLockHandler.GrabAvailableLockStub = func(out.AcquireParams) (map[string][]string, string, error) {
 							// succeed on second call
 							if !called {
 								called = true
-								return "", "", errors.New("disaster")
+								return nil, "", errors.New("disaster")
 							} else {
-								return "", "", nil
+								return map[string][]string{"my-pool": {"some-lock"}}, "", nil
 							}
 						}
 					})
 
 					It("retries", func() {
-						_, _, err := lockPool.AcquireLock()
+						_, _, err := lockPool.AcquireLock(ctx)
 						Ω(err).ShouldNot(HaveOccurred())
 						Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(2))
 					})
 				})
 
 				Context("when grabbing an available lock succeeds", func() {
-					BeforeEach(func() {
-						fakeLockHandler.GrabAvailableLockReturns("some-lock", "some-ref", nil)
-					})
-
 					It("tries to broadcast to the lock pool", func() {
-						_, _, err := lockPool.AcquireLock()
+						_, _, err := lockPool.AcquireLock(ctx)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -299,7 +311,7 @@ var _ = Describe("Lock Pool", func() {
 
 					ValidateSharedBehaviorDuringBroadcastFailures(
 						func() error {
-							_, _, err := lockPool.AcquireLock()
+							_, _, err := lockPool.AcquireLock(ctx)
 							return err
 						}, func(expectedNumberOfInteractions int) {
 							Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -308,7 +320,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the lockname, and a version", func() {
-							lockName, version, err := lockPool.AcquireLock()
+							lockName, version, err := lockPool.AcquireLock(ctx)
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(lockName).Should(Equal("some-lock"))
@@ -322,6 +334,369 @@ var _ = Describe("Lock Pool", func() {
 		})
 	})
 
+	Context("Acquiring several locks at once", func() {
+		BeforeEach(func() {
+			fakeLockHandler.GrabAvailableLockReturns(map[string][]string{"my-pool": {"some-lock", "some-other-lock"}}, "some-ref", nil)
+		})
+
+		It("grabs all of them in a single action", func() {
+			locks, version, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true, Count: 2})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(1))
+			Ω(fakeLockHandler.GrabAvailableLockArgsForCall(0).Count).Should(Equal(2))
+			Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+
+			Ω(locks).Should(Equal(map[string][]string{"my-pool": {"some-lock", "some-other-lock"}}))
+			Ω(version).Should(Equal(out.Version{
+				Ref: "some-ref",
+			}))
+		})
+
+		Context("when there are not enough locks available", func() {
+			BeforeEach(func() {
+				called := false
+
+				fakeLockHandler.GrabAvailableLockStub = func(out.AcquireParams) (map[string][]string, string, error) {
+					if !called {
+						called = true
+						return nil, "", out.ErrNoLocksAvailable
+					}
+
+					return map[string][]string{"my-pool": {"some-lock", "some-other-lock"}}, "some-ref", nil
+				}
+			})
+
+			It("waits for them", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true, Count: 2})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(2))
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+			})
+		})
+	})
+
+	Context("Acquiring locks from several pools at once", func() {
+		BeforeEach(func() {
+			fakeLockHandler.GrabAvailableLockReturns(map[string][]string{
+				"some-pool":       {"some-lock"},
+				"some-other-pool": {"some-other-lock"},
+			}, "some-ref", nil)
+		})
+
+		It("grabs a lock from each pool in a single action", func() {
+			locks, version, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true, Pools: []string{"some-pool", "some-other-pool"}})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(1))
+			Ω(fakeLockHandler.GrabAvailableLockArgsForCall(0).Pools).Should(Equal([]string{"some-pool", "some-other-pool"}))
+			Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+
+			Ω(locks).Should(Equal(map[string][]string{
+				"some-pool":       {"some-lock"},
+				"some-other-pool": {"some-other-lock"},
+			}))
+			Ω(version).Should(Equal(out.Version{
+				Ref: "some-ref",
+			}))
+		})
+
+		Context("when broadcasting conflicts with someone else", func() {
+			BeforeEach(func() {
+				fakeLockHandler.BroadcastLockPoolReturnsOnCall(0, "", out.ErrLockConflict)
+			})
+
+			It("grabs the locks from all of the pools again", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true, Pools: []string{"some-pool", "some-other-pool"}})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(2))
+				Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(2))
+			})
+		})
+	})
+
+	Context("Trying to acquire a lock", func() {
+		Context("when a lock is available", func() {
+			BeforeEach(func() {
+				fakeLockHandler.GrabAvailableLockReturns(map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+			})
+
+			It("acquires it", func() {
+				locks, version, acquired, err := lockPool.TryAcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(acquired).Should(BeTrue())
+				Ω(locks).Should(Equal(map[string][]string{"my-pool": {"some-lock"}}))
+				Ω(version).Should(Equal(out.Version{Ref: "some-ref"}))
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+			})
+
+			Context("when broadcasting conflicts with someone else", func() {
+				BeforeEach(func() {
+					fakeLockHandler.BroadcastLockPoolReturnsOnCall(0, "", out.ErrLockConflict)
+				})
+
+				It("tries again", func() {
+					_, _, acquired, err := lockPool.TryAcquireLocks(ctx, out.AcquireParams{Enabled: true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(acquired).Should(BeTrue())
+					Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(2))
+				})
+			})
+		})
+
+		Context("when no lock is available", func() {
+			BeforeEach(func() {
+				fakeLockHandler.GrabAvailableLockReturns(nil, "", out.ErrNoLocksAvailable)
+				fakeLockHandler.CurrentVersionReturns("head-ref\n", nil)
+			})
+
+			It("does not wait, and returns the current version of the pool", func() {
+				locks, version, acquired, err := lockPool.TryAcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(acquired).Should(BeFalse())
+				Ω(locks).Should(BeNil())
+				Ω(version).Should(Equal(out.Version{Ref: "head-ref"}))
+				Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when others are waiting in a fair queue", func() {
+			BeforeEach(func() {
+				lockPool.Source.FairQueue = true
+				fakeLockHandler.GrabAvailableLockReturns(nil, "", out.NotYourTurnError{Ahead: 1})
+			})
+
+			It("does not join the queue", func() {
+				_, _, acquired, err := lockPool.TryAcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(acquired).Should(BeFalse())
+				Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Context("Acquiring a lock from a pool with a fair queue", func() {
+		BeforeEach(func() {
+			lockPool.Source.FairQueue = true
+			lockPool.Source.FairQueueTimeout = time.Minute
+
+			fakeLockHandler.EnqueueReturns("some-ticket", "some-ref", nil)
+		})
+
+		Context("when a lock is available straight away", func() {
+			BeforeEach(func() {
+				fakeLockHandler.GrabAvailableLockReturns(map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+			})
+
+			It("claims it without joining the queue", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(0))
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when it has to wait", func() {
+			BeforeEach(func() {
+				fakeLockHandler.GrabAvailableLockReturnsOnCall(0, nil, "", out.ErrNotYourTurn)
+				fakeLockHandler.GrabAvailableLockReturnsOnCall(1, nil, "", out.ErrNoLocksAvailable)
+				fakeLockHandler.GrabAvailableLockReturnsOnCall(2, map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+			})
+
+			It("joins the queue, then claims in turn", func() {
+				locks, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(locks).Should(Equal(map[string][]string{"my-pool": {"some-lock"}}))
+
+				Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(1))
+				wants, priority := fakeLockHandler.EnqueueArgsForCall(0)
+				Ω(wants).Should(Equal(""))
+				Ω(priority).Should(Equal(0))
+				Ω(fakeLockHandler.GrabAvailableLockCallCount()).Should(Equal(3))
+
+				// once to join the queue, once to claim
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(2))
+				Ω(output).Should(gbytes.Say("waiting in the queue of pool: my-pool with ticket: some-ticket"))
+			})
+
+			Context("with a priority", func() {
+				It("joins the queue with that priority", func() {
+					_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true, Priority: 10})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeLockHandler.GrabAvailableLockArgsForCall(0).Priority).Should(Equal(10))
+					_, priority := fakeLockHandler.EnqueueArgsForCall(0)
+					Ω(priority).Should(Equal(10))
+				})
+			})
+
+			Context("behind other builds", func() {
+				BeforeEach(func() {
+					fakeLockHandler.GrabAvailableLockReturnsOnCall(1, nil, "", out.NotYourTurnError{Ahead: 2})
+					fakeLockHandler.GrabAvailableLockReturnsOnCall(2, nil, "", out.NotYourTurnError{Ahead: 2})
+					fakeLockHandler.GrabAvailableLockReturnsOnCall(3, nil, "", out.NotYourTurnError{Ahead: 1})
+					fakeLockHandler.GrabAvailableLockReturnsOnCall(4, nil, "", out.ErrNoLocksAvailable)
+					fakeLockHandler.GrabAvailableLockReturnsOnCall(5, map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+				})
+
+				It("shows its place in the queue as it moves up", func() {
+					_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(output).Should(gbytes.Say(`\n2 ahead in the queue\.\.\n1 ahead in the queue\.\nfirst in the queue, waiting for a lock\.\n`))
+				})
+			})
+
+			Context("for longer than half the timeout", func() {
+				BeforeEach(func() {
+					lockPool.Source.FairQueueTimeout = 100 * time.Millisecond
+				})
+
+				It("refreshes its ticket while it waits", func() {
+					_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeLockHandler.RefreshTicketCallCount()).Should(BeNumerically(">", 0))
+				})
+
+				Context("with a backoff that waits longer than that", func() {
+					BeforeEach(func() {
+						lockPool.Source.RetryBackoff.NoLocks = out.Backoff{Initial: time.Hour}
+					})
+
+					It("cuts the wait short to refresh its ticket in time", func() {
+						ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+						defer cancel()
+
+						_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(fakeLockHandler.RefreshTicketCallCount()).Should(Equal(1))
+					})
+				})
+			})
+
+			Context("when its ticket went stale", func() {
+				BeforeEach(func() {
+					fakeLockHandler.GrabAvailableLockReturnsOnCall(1, nil, "", out.ErrTicketLost)
+				})
+
+				It("joins the queue again", func() {
+					_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(2))
+				})
+			})
+		})
+
+		Context("when the pool has no fair queue", func() {
+			BeforeEach(func() {
+				lockPool.Source.FairQueue = false
+
+				fakeLockHandler.GrabAvailableLockReturnsOnCall(0, nil, "", out.ErrNoLocksAvailable)
+				fakeLockHandler.GrabAvailableLockReturnsOnCall(1, map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+			})
+
+			It("never joins it", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Context("Claiming a lock from a pool with a fair queue", func() {
+		BeforeEach(func() {
+			lockPool.Source.FairQueue = true
+			lockPool.Source.FairQueueTimeout = time.Minute
+
+			fakeLockHandler.ClaimLockReturnsOnCall(0, "", out.ErrNoLocksAvailable)
+			fakeLockHandler.ClaimLockReturnsOnCall(1, "some-ref", nil)
+		})
+
+		It("waits in the queue for that lock", func() {
+			version, err := lockPool.ClaimLock(ctx, "some-lock", "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(out.Version{Ref: "some-ref"}))
+
+			Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(1))
+			wants, _ := fakeLockHandler.EnqueueArgsForCall(0)
+			Ω(wants).Should(Equal("some-lock"))
+		})
+	})
+
+	Context("Waiting for a lock with a timeout", func() {
+		BeforeEach(func() {
+			lockPool.Timeout = 250 * time.Millisecond
+
+			fakeLockHandler.GrabAvailableLockReturns(nil, "", out.ErrNoLocksAvailable)
+			fakeLockHandler.ClaimLockReturns("", out.ErrNoLocksAvailable)
+			fakeLockHandler.HoldersStub = func(pool string) ([]out.Holder, error) {
+				return []out.Holder{
+					{Pool: pool, Lock: "some-lock", Owner: out.Owner{BuildID: "42", BuildName: "7", BuildJobName: "some-job", BuildPipelineName: "some-pipeline", BuildTeamName: "some-team"}},
+					{Pool: pool, Lock: "some-other-lock"},
+				}, nil
+			}
+		})
+
+		It("gives up acquiring, listing who holds the locks", func() {
+			_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+			Ω(err).Should(MatchError(out.ErrTimedOut))
+
+			var timeoutErr out.TimeoutError
+			Ω(errors.As(err, &timeoutErr)).Should(BeTrue())
+			Ω(timeoutErr.Holders).Should(HaveLen(2))
+
+			Ω(err.Error()).Should(Equal("timed out after 250ms, locks held by:\n" +
+				"  my-pool/some-lock: some-team/some-pipeline/some-job #7\n" +
+				"  my-pool/some-other-lock: unknown build"))
+		})
+
+		It("gives up claiming, listing who holds that lock", func() {
+			_, err := lockPool.ClaimLock(ctx, "some-other-lock", "")
+			Ω(err).Should(MatchError(out.ErrTimedOut))
+
+			var timeoutErr out.TimeoutError
+			Ω(errors.As(err, &timeoutErr)).Should(BeTrue())
+			Ω(timeoutErr.Holders).Should(Equal([]out.Holder{{Pool: "my-pool", Lock: "some-other-lock"}}))
+		})
+
+		Context("while waiting in a fair queue", func() {
+			BeforeEach(func() {
+				lockPool.Source.FairQueue = true
+				lockPool.Source.FairQueueTimeout = time.Minute
+			})
+
+			It("leaves the queue", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).Should(MatchError(out.ErrTimedOut))
+
+				Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(1))
+				Ω(fakeLockHandler.LeaveQueueCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when the lock becomes available in time", func() {
+			BeforeEach(func() {
+				fakeLockHandler.GrabAvailableLockReturnsOnCall(1, map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+			})
+
+			It("acquires it", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
 	Context("Claiming a lock", func() {
 		Context("when setup fails", func() {
 			BeforeEach(func() {
@@ -329,7 +704,7 @@ var _ = Describe("Lock Pool", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := lockPool.ClaimLock("some-lock")
+				_, err := lockPool.ClaimLock(ctx, "some-lock", "")
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -342,25 +717,36 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, err := lockPool.ClaimLock("some-lock")
+					_, err := lockPool.ClaimLock(ctx, "some-lock", "")
 					Ω(err).Should(HaveOccurred())
 				})
 			})
 
 			Context("when resetting the lock succeeds", func() {
 				It("tries to claim the specific lock", func() {
-					_, err := lockPool.ClaimLock("some-lock")
+					_, err := lockPool.ClaimLock(ctx, "some-lock", "")
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(fakeLockHandler.ClaimLockCallCount()).Should(Equal(1))
-					Ω(fakeLockHandler.ClaimLockArgsForCall(0)).Should(Equal("some-lock"))
+					lock, mode := fakeLockHandler.ClaimLockArgsForCall(0)
+					Ω(lock).Should(Equal("some-lock"))
+					Ω(mode).Should(BeEmpty())
+				})
+
+				It("claims it in shared mode if asked to", func() {
+					_, err := lockPool.ClaimLock(ctx, "some-lock", out.SharedMode)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					_, mode := fakeLockHandler.ClaimLockArgsForCall(0)
+					Ω(mode).Should(Equal(out.SharedMode))
+					Ω(output).Should(gbytes.Say("in shared mode"))
 				})
 
 				Context("when attempting to claim a lock fails", func() {
 					BeforeEach(func() {
 						called := false
 
-						fakeLockHandler.ClaimLockStub = func(lock string) (string, error) {
+						fakeLockHandler.ClaimLockStub = func(lock string, mode out.ClaimMode) (string, error) {
 							// succeed on second call
 							if !called {
 								called = true
@@ -372,7 +758,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("retries", func() {
-						_, err := lockPool.ClaimLock("some-lock")
+						_, err := lockPool.ClaimLock(ctx, "some-lock", "")
 						Ω(err).ShouldNot(HaveOccurred())
 						Ω(fakeLockHandler.ClaimLockCallCount()).Should(Equal(2))
 					})
@@ -384,7 +770,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("tries to broadcast to the lock pool", func() {
-						_, err := lockPool.ClaimLock("some-lock")
+						_, err := lockPool.ClaimLock(ctx, "some-lock", "")
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -392,7 +778,7 @@ var _ = Describe("Lock Pool", func() {
 
 					ValidateSharedBehaviorDuringBroadcastFailures(
 						func() error {
-							_, err := lockPool.ClaimLock("some-lock")
+							_, err := lockPool.ClaimLock(ctx, "some-lock", "")
 							return err
 						}, func(expectedNumberOfInteractions int) {
 							Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -401,7 +787,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the a version", func() {
-							version, err := lockPool.ClaimLock("some-lock")
+							version, err := lockPool.ClaimLock(ctx, "some-lock", "")
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(version).Should(Equal(out.Version{
@@ -431,11 +817,69 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when a name file doesn't exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.ReleaseLock(lockDir)
+				_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
 
+		Context("when the directory holds several locks acquired at once", func() {
+			BeforeEach(func() {
+				for _, lockName := range []string{"some-lock", "some-other-lock"} {
+					err := os.Mkdir(filepath.Join(lockDir, lockName), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(lockDir, lockName, "name"), []byte(lockName+"\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(lockDir, lockName, "ref"), []byte("some-ref\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(lockDir, lockName, "claim"), []byte(lockName+"-claim\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				fakeLockHandler.UnclaimLockReturns("some-new-ref", nil)
+			})
+
+			It("releases all of them in a single push", func() {
+				lockName, version, err := lockPool.ReleaseLock(ctx, lockDir, false)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(2))
+				Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(2))
+				for i, expected := range []string{"some-lock", "some-other-lock"} {
+					lockName, claim := fakeLockHandler.UnclaimLockArgsForCall(i)
+					Ω(lockName).Should(Equal(expected))
+					Ω(claim).Should(Equal(expected + "-claim"))
+
+					_, _, claim = fakeLockHandler.VerifyClaimArgsForCall(i)
+					Ω(claim).Should(Equal(expected + "-claim"))
+				}
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+
+				Ω(lockName).Should(Equal("some-lock,some-other-lock"))
+				Ω(version).Should(Equal(out.Version{Ref: "some-new-ref"}))
+			})
+
+			Context("when one of them has been claimed by someone else", func() {
+				BeforeEach(func() {
+					fakeLockHandler.VerifyClaimStub = func(lock string, ref string, claim string) error {
+						if lock == "some-other-lock" {
+							return out.ErrLockLost
+						}
+						return nil
+					}
+				})
+
+				It("releases none of them", func() {
+					_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
 		Context("when a name file does exist", func() {
 			BeforeEach(func() {
 				err := os.WriteFile(filepath.Join(lockDir, "name"), []byte("some-lock"), 0755)
@@ -448,18 +892,18 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.ReleaseLock(lockDir)
+					_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
 
 			Context("when setup succeeds", func() {
 				It("tries to unclaim the lock it found in the name file", func() {
-					_, _, err := lockPool.ReleaseLock(lockDir)
+					_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(1))
-					lockName := fakeLockHandler.UnclaimLockArgsForCall(0)
+					lockName, _ := fakeLockHandler.UnclaimLockArgsForCall(0)
 					Ω(lockName).Should(Equal("some-lock"))
 				})
 
@@ -469,7 +913,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("returns an error", func() {
-						_, _, err := lockPool.ReleaseLock(lockDir)
+						_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 						Ω(err).Should(HaveOccurred())
 						Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(1))
 					})
@@ -481,7 +925,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("tries to broadcast to the lock pool", func() {
-						_, _, err := lockPool.ReleaseLock(lockDir)
+						_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -489,7 +933,7 @@ var _ = Describe("Lock Pool", func() {
 
 					ValidateSharedBehaviorDuringBroadcastFailures(
 						func() error {
-							_, _, err := lockPool.ReleaseLock(lockDir)
+							_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 							return err
 						}, func(expectedNumberOfInteractions int) {
 							Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -498,7 +942,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the lockname, and a version", func() {
-							lockName, version, err := lockPool.ReleaseLock(lockDir)
+							lockName, version, err := lockPool.ReleaseLock(ctx, lockDir, false)
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(lockName).Should(Equal("some-lock"))
@@ -508,6 +952,297 @@ var _ = Describe("Lock Pool", func() {
 						})
 					})
 				})
+
+				It("releases the lock without verifying who holds it", func() {
+					_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(output).Should(gbytes.Say("no ref file found for lock: some-lock"))
+					Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(0))
+				})
+
+				Context("when a ref file does exist", func() {
+					BeforeEach(func() {
+						err := os.WriteFile(filepath.Join(lockDir, "ref"), []byte("some-claim-ref\n"), 0755)
+						Ω(err).ShouldNot(HaveOccurred())
+					})
+
+					It("verifies the claim on the lock before unclaiming it", func() {
+						_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(1))
+						lockName, ref, _ := fakeLockHandler.VerifyClaimArgsForCall(0)
+						Ω(lockName).Should(Equal("some-lock"))
+						Ω(ref).Should(Equal("some-claim-ref"))
+
+						Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(1))
+					})
+
+					Context("when the claim has been lost", func() {
+						BeforeEach(func() {
+							fakeLockHandler.VerifyClaimReturns(out.ErrLockLost)
+						})
+
+						It("refuses to unclaim the lock", func() {
+							_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
+							Ω(err).Should(MatchError(out.ErrLockLost))
+
+							Ω(output).Should(gbytes.Say("the lock: some-lock has been released or claimed by someone else since some-claim-ref! set force_release to release it anyway"))
+							Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(0))
+							Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(0))
+						})
+
+						Context("when forcing the release", func() {
+							It("unclaims the lock without verifying who holds it", func() {
+								_, _, err := lockPool.ReleaseLock(ctx, lockDir, true)
+								Ω(err).ShouldNot(HaveOccurred())
+
+								Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(0))
+								Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(1))
+							})
+						})
+					})
+
+					Context("when verifying the claim fails", func() {
+						BeforeEach(func() {
+							fakeLockHandler.VerifyClaimReturns(errors.New("disaster"))
+						})
+
+						It("returns an error", func() {
+							_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
+							Ω(err).Should(HaveOccurred())
+							Ω(fakeLockHandler.UnclaimLockCallCount()).Should(Equal(0))
+						})
+					})
+				})
+			})
+		})
+	})
+
+	Context("Renewing a lock", func() {
+		var lockDir string
+
+		BeforeEach(func() {
+			var err error
+			lockDir, err = os.MkdirTemp("", "lock-dir")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(lockDir)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when a name file doesn't exist", func() {
+			It("returns an error", func() {
+				_, _, err := lockPool.RenewLock(ctx, lockDir)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("when the directory holds several locks acquired at once", func() {
+			BeforeEach(func() {
+				for _, lockName := range []string{"some-lock", "some-other-lock"} {
+					err := os.Mkdir(filepath.Join(lockDir, lockName), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(lockDir, lockName, "name"), []byte(lockName+"\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(lockDir, lockName, "ref"), []byte("some-ref\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = os.WriteFile(filepath.Join(lockDir, lockName, "claim"), []byte(lockName+"-claim\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				fakeLockHandler.RenewLockReturns("some-new-ref", nil)
+			})
+
+			It("renews all of them in a single push", func() {
+				lockName, version, err := lockPool.RenewLock(ctx, lockDir)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(2))
+				Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(2))
+				for i, expected := range []string{"some-lock", "some-other-lock"} {
+					lockName, claim := fakeLockHandler.RenewLockArgsForCall(i)
+					Ω(lockName).Should(Equal(expected))
+					Ω(claim).Should(Equal(expected + "-claim"))
+
+					_, ref, claim := fakeLockHandler.VerifyClaimArgsForCall(i)
+					Ω(ref).Should(Equal("some-ref"))
+					Ω(claim).Should(Equal(expected + "-claim"))
+				}
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+
+				Ω(lockName).Should(Equal("some-lock,some-other-lock"))
+				Ω(version).Should(Equal(out.Version{Ref: "some-new-ref"}))
+			})
+
+			Context("when one of them has been claimed by someone else", func() {
+				BeforeEach(func() {
+					fakeLockHandler.VerifyClaimStub = func(lock string, ref string, claim string) error {
+						if lock == "some-other-lock" {
+							return out.ErrLockLost
+						}
+						return nil
+					}
+				})
+
+				It("renews none of them", func() {
+					_, _, err := lockPool.RenewLock(ctx, lockDir)
+					Ω(err).Should(MatchError(out.ErrLockLost))
+
+					Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
+		Context("when a name file does exist", func() {
+			BeforeEach(func() {
+				err := os.WriteFile(filepath.Join(lockDir, "name"), []byte("some-lock"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			Context("when a ref file doesn't exist", func() {
+				It("returns an error", func() {
+					_, _, err := lockPool.RenewLock(ctx, lockDir)
+					Ω(err).Should(HaveOccurred())
+					Ω(fakeLockHandler.SetupCallCount()).Should(Equal(0))
+				})
+			})
+
+			Context("when a ref file does exist", func() {
+				BeforeEach(func() {
+					err := os.WriteFile(filepath.Join(lockDir, "ref"), []byte("some-claim-ref\n"), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				Context("when setup fails", func() {
+					BeforeEach(func() {
+						fakeLockHandler.SetupReturns(errors.New("some-error"))
+					})
+
+					It("returns an error", func() {
+						_, _, err := lockPool.RenewLock(ctx, lockDir)
+						Ω(err).Should(HaveOccurred())
+					})
+				})
+
+				Context("when setup succeeds", func() {
+					It("verifies the claim on the lock since the fetched ref", func() {
+						_, _, err := lockPool.RenewLock(ctx, lockDir)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(1))
+						lockName, ref, _ := fakeLockHandler.VerifyClaimArgsForCall(0)
+						Ω(lockName).Should(Equal("some-lock"))
+						Ω(ref).Should(Equal("some-claim-ref"))
+					})
+
+					Context("when the claim has been lost", func() {
+						BeforeEach(func() {
+							fakeLockHandler.VerifyClaimReturns(out.ErrLockLost)
+						})
+
+						It("fails without renewing or retrying", func() {
+							_, _, err := lockPool.RenewLock(ctx, lockDir)
+							Ω(err).Should(MatchError(out.ErrLockLost))
+
+							Ω(output).Should(gbytes.Say("the lock: some-lock has been released or claimed by someone else since some-claim-ref!"))
+							Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(1))
+							Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(0))
+							Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(0))
+						})
+					})
+
+					Context("when verifying the claim fails", func() {
+						BeforeEach(func() {
+							fakeLockHandler.VerifyClaimReturns(errors.New("disaster"))
+						})
+
+						It("returns an error", func() {
+							_, _, err := lockPool.RenewLock(ctx, lockDir)
+							Ω(err).Should(HaveOccurred())
+							Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(0))
+						})
+					})
+
+					Context("when the claim is still held", func() {
+						It("tries to renew the lock it found in the name file", func() {
+							_, _, err := lockPool.RenewLock(ctx, lockDir)
+							Ω(err).ShouldNot(HaveOccurred())
+
+							Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(1))
+							lockName, _ := fakeLockHandler.RenewLockArgsForCall(0)
+							Ω(lockName).Should(Equal("some-lock"))
+						})
+
+						Context("when the lock was not claimed with a lease", func() {
+							BeforeEach(func() {
+								fakeLockHandler.RenewLockReturns("", out.ErrNoLease)
+							})
+
+							It("fails without retrying", func() {
+								_, _, err := lockPool.RenewLock(ctx, lockDir)
+								Ω(err).Should(MatchError(out.ErrNoLease))
+								Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(1))
+							})
+						})
+
+						Context("when renewing the lock fails", func() {
+							BeforeEach(func() {
+								called := false
+
+								fakeLockHandler.RenewLockStub = func(string, string) (string, error) {
+									// succeed on second call
+									if !called {
+										called = true
+										return "", errors.New("disaster")
+									} else {
+										return "some-ref", nil
+									}
+								}
+							})
+
+							It("retries", func() {
+								_, _, err := lockPool.RenewLock(ctx, lockDir)
+								Ω(err).ShouldNot(HaveOccurred())
+								Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(2))
+							})
+						})
+
+						Context("when renewing the lock succeeds", func() {
+							BeforeEach(func() {
+								fakeLockHandler.RenewLockReturns("some-ref", nil)
+							})
+
+							ValidateSharedBehaviorDuringBroadcastFailures(
+								func() error {
+									_, _, err := lockPool.RenewLock(ctx, lockDir)
+									return err
+								}, func(expectedNumberOfInteractions int) {
+									Ω(fakeLockHandler.ResetLockCallCount()).Should(Equal(expectedNumberOfInteractions))
+									Ω(fakeLockHandler.VerifyClaimCallCount()).Should(Equal(expectedNumberOfInteractions))
+									Ω(fakeLockHandler.RenewLockCallCount()).Should(Equal(expectedNumberOfInteractions))
+								})
+
+							Context("when broadcasting succeeds", func() {
+								It("returns the lockname, and a version", func() {
+									lockName, version, err := lockPool.RenewLock(ctx, lockDir)
+
+									Ω(err).ShouldNot(HaveOccurred())
+									Ω(lockName).Should(Equal("some-lock"))
+									Ω(version).Should(Equal(out.Version{
+										Ref: "some-ref",
+									}))
+								})
+							})
+						})
+					})
+				})
 			})
 		})
 	})
@@ -528,7 +1263,7 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when no files exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.AddUnclaimedLock(lockDir)
+				_, _, err := lockPool.AddUnclaimedLock(ctx, lockDir)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -548,14 +1283,14 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.AddUnclaimedLock(lockDir)
+					_, _, err := lockPool.AddUnclaimedLock(ctx, lockDir)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
 
 			Context("when setup succeeds", func() {
 				It("tries to add the lock it found in the name file", func() {
-					_, _, err := lockPool.AddUnclaimedLock(lockDir)
+					_, _, err := lockPool.AddUnclaimedLock(ctx, lockDir)
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(fakeLockHandler.AddLockCallCount()).Should(Equal(1))
@@ -581,7 +1316,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("does not return an error as it retries", func() {
-						_, _, err := lockPool.AddUnclaimedLock(lockDir)
+						_, _, err := lockPool.AddUnclaimedLock(ctx, lockDir)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.AddLockCallCount()).Should(Equal(2))
@@ -594,7 +1329,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("tries to broadcast to the lock pool", func() {
-						_, _, err := lockPool.ReleaseLock(lockDir)
+						_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -602,7 +1337,7 @@ var _ = Describe("Lock Pool", func() {
 
 					ValidateSharedBehaviorDuringBroadcastFailures(
 						func() error {
-							_, _, err := lockPool.AddUnclaimedLock(lockDir)
+							_, _, err := lockPool.AddUnclaimedLock(ctx, lockDir)
 							return err
 						}, func(expectedNumberOfInteractions int) {
 							Ω(fakeLockHandler.AddLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -610,7 +1345,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the lockname, and a version", func() {
-							lockName, version, err := lockPool.AddUnclaimedLock(lockDir)
+							lockName, version, err := lockPool.AddUnclaimedLock(ctx, lockDir)
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(lockName).Should(Equal("some-lock"))
@@ -640,7 +1375,7 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when no files exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.AddClaimedLock(lockDir)
+				_, _, err := lockPool.AddClaimedLock(ctx, lockDir)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -660,14 +1395,14 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.AddClaimedLock(lockDir)
+					_, _, err := lockPool.AddClaimedLock(ctx, lockDir)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
 
 			Context("when setup succeeds", func() {
 				It("tries to add the lock it found in the name file", func() {
-					_, _, err := lockPool.AddClaimedLock(lockDir)
+					_, _, err := lockPool.AddClaimedLock(ctx, lockDir)
 					Ω(err).ShouldNot(HaveOccurred())
 
 					Ω(fakeLockHandler.AddLockCallCount()).Should(Equal(1))
@@ -693,7 +1428,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("does not return an error as it retries", func() {
-						_, _, err := lockPool.AddClaimedLock(lockDir)
+						_, _, err := lockPool.AddClaimedLock(ctx, lockDir)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.AddLockCallCount()).Should(Equal(2))
@@ -706,7 +1441,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("tries to broadcast to the lock pool", func() {
-						_, _, err := lockPool.ReleaseLock(lockDir)
+						_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -714,7 +1449,7 @@ var _ = Describe("Lock Pool", func() {
 
 					ValidateSharedBehaviorDuringBroadcastFailures(
 						func() error {
-							_, _, err := lockPool.AddClaimedLock(lockDir)
+							_, _, err := lockPool.AddClaimedLock(ctx, lockDir)
 							return err
 						}, func(expectedNumberOfInteractions int) {
 							Ω(fakeLockHandler.AddLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -722,7 +1457,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the lockname, and a version", func() {
-							lockName, version, err := lockPool.AddClaimedLock(lockDir)
+							lockName, version, err := lockPool.AddClaimedLock(ctx, lockDir)
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(lockName).Should(Equal("some-lock"))
@@ -752,7 +1487,7 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when no files exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.UpdateLock(lockDir)
+				_, _, err := lockPool.UpdateLock(ctx, lockDir)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -772,7 +1507,7 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.UpdateLock(lockDir)
+					_, _, err := lockPool.UpdateLock(ctx, lockDir)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
@@ -784,14 +1519,14 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("returns an error", func() {
-						_, _, err := lockPool.UpdateLock("some-lock")
+						_, _, err := lockPool.UpdateLock(ctx, "some-lock")
 						Ω(err).Should(HaveOccurred())
 					})
 				})
 
 				Context("when resetting the lock succeeds", func() {
 					It("tries to update the lock it found in the name file", func() {
-						_, _, err := lockPool.UpdateLock(lockDir)
+						_, _, err := lockPool.UpdateLock(ctx, lockDir)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.UpdateLockCallCount()).Should(Equal(1))
@@ -816,7 +1551,7 @@ var _ = Describe("Lock Pool", func() {
 						})
 
 						It("does not return an error as it retries", func() {
-							_, _, err := lockPool.UpdateLock(lockDir)
+							_, _, err := lockPool.UpdateLock(ctx, lockDir)
 							Ω(err).ShouldNot(HaveOccurred())
 
 							Ω(fakeLockHandler.UpdateLockCallCount()).Should(Equal(2))
@@ -829,7 +1564,7 @@ var _ = Describe("Lock Pool", func() {
 						})
 
 						It("tries to broadcast to the lock pool", func() {
-							_, _, err := lockPool.ReleaseLock(lockDir)
+							_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
 							Ω(err).ShouldNot(HaveOccurred())
 
 							Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -837,7 +1572,7 @@ var _ = Describe("Lock Pool", func() {
 
 						ValidateSharedBehaviorDuringBroadcastFailures(
 							func() error {
-								_, _, err := lockPool.UpdateLock(lockDir)
+								_, _, err := lockPool.UpdateLock(ctx, lockDir)
 								return err
 							}, func(expectedNumberOfInteractions int) {
 								Ω(fakeLockHandler.UpdateLockCallCount()).Should(Equal(expectedNumberOfInteractions))
@@ -845,7 +1580,7 @@ var _ = Describe("Lock Pool", func() {
 
 						Context("when broadcasting succeeds", func() {
 							It("returns the lockname, and a version", func() {
-								lockName, version, err := lockPool.UpdateLock(lockDir)
+								lockName, version, err := lockPool.UpdateLock(ctx, lockDir)
 
 								Ω(err).ShouldNot(HaveOccurred())
 								Ω(lockName).Should(Equal("some-lock"))
@@ -877,7 +1612,7 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when a name file doesn't exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.CheckLock(lockDir)
+				_, _, err := lockPool.CheckLock(ctx, lockDir, "")
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -894,7 +1629,7 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.CheckLock(lockDir)
+					_, _, err := lockPool.CheckLock(ctx, lockDir, "")
 					Ω(err).Should(HaveOccurred())
 				})
 			})
@@ -906,7 +1641,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("bypasses broadcasting to the lock pool", func() {
-						_, _, err := lockPool.CheckLock(lockDir)
+						_, _, err := lockPool.CheckLock(ctx, lockDir, "")
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -914,7 +1649,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the lockname, and a version", func() {
-							lockName, version, err := lockPool.CheckLock(lockDir)
+							lockName, version, err := lockPool.CheckLock(ctx, lockDir, "")
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(lockName).Should(Equal("some-lock"))
@@ -924,6 +1659,24 @@ var _ = Describe("Lock Pool", func() {
 						})
 					})
 				})
+
+				Context("when the lock is claimed exclusively until the next try", func() {
+					BeforeEach(func() {
+						fakeLockHandler.CheckLockReturnsOnCall(0, "", out.ErrLockActive)
+						fakeLockHandler.CheckLockReturnsOnCall(1, "some-ref", nil)
+					})
+
+					It("waits for it to have no exclusive holder in shared mode", func() {
+						_, version, err := lockPool.CheckLock(ctx, lockDir, out.SharedMode)
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(version).Should(Equal(out.Version{Ref: "some-ref"}))
+
+						Ω(output).Should(gbytes.Say("waiting for lock to have no exclusive holder"))
+						Ω(fakeLockHandler.CheckLockCallCount()).Should(Equal(2))
+						_, mode := fakeLockHandler.CheckLockArgsForCall(1)
+						Ω(mode).Should(Equal(out.SharedMode))
+					})
+				})
 			})
 		})
 	})
@@ -945,7 +1698,7 @@ var _ = Describe("Lock Pool", func() {
 
 		Context("when a name file doesn't exist", func() {
 			It("returns an error", func() {
-				_, _, err := lockPool.CheckUnclaimedLock(lockDir)
+				_, _, err := lockPool.CheckUnclaimedLock(ctx, lockDir)
 				Ω(err).Should(HaveOccurred())
 			})
 		})
@@ -962,7 +1715,7 @@ var _ = Describe("Lock Pool", func() {
 				})
 
 				It("returns an error", func() {
-					_, _, err := lockPool.CheckUnclaimedLock(lockDir)
+					_, _, err := lockPool.CheckUnclaimedLock(ctx, lockDir)
 					Ω(err).Should(HaveOccurred())
 				})
 			})
@@ -974,7 +1727,7 @@ var _ = Describe("Lock Pool", func() {
 					})
 
 					It("bypasses broadcasting to the lock pool", func() {
-						_, _, err := lockPool.CheckUnclaimedLock(lockDir)
+						_, _, err := lockPool.CheckUnclaimedLock(ctx, lockDir)
 						Ω(err).ShouldNot(HaveOccurred())
 
 						Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
@@ -982,7 +1735,7 @@ var _ = Describe("Lock Pool", func() {
 
 					Context("when broadcasting succeeds", func() {
 						It("returns the lockname, and a version", func() {
-							lockName, version, err := lockPool.CheckUnclaimedLock(lockDir)
+							lockName, version, err := lockPool.CheckUnclaimedLock(ctx, lockDir)
 
 							Ω(err).ShouldNot(HaveOccurred())
 							Ω(lockName).Should(Equal("some-lock"))
@@ -995,4 +1748,240 @@ var _ = Describe("Lock Pool", func() {
 			})
 		})
 	})
+
+	Context("Retrying with a backoff", func() {
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			// a retry that waits for the retry delay would not finish in time
+			lockPool.Source.RetryDelay = time.Hour
+			ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+
+			lockPool.Source.RetryBackoff = out.RetryBackoff{
+				NoLocks:         out.Backoff{Initial: time.Millisecond, Multiplier: 2, Jitter: 0.5},
+				Conflict:        out.Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond, Multiplier: 2},
+				UnexpectedError: out.Backoff{Initial: time.Millisecond},
+			}
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("waits as long as the backoff for why the attempt did not go through", func() {
+			fakeLockHandler.ClaimLockStub = func(string, out.ClaimMode) (string, error) {
+				if fakeLockHandler.ClaimLockCallCount() <= 3 {
+					return "", out.ErrNoLocksAvailable
+				}
+
+				return "some-ref", nil
+			}
+
+			fakeLockHandler.BroadcastLockPoolStub = func(context.Context) (string, error) {
+				switch fakeLockHandler.BroadcastLockPoolCallCount() {
+				case 1, 2:
+					return "", out.ErrLockConflict
+				case 3:
+					return "", errors.New("disaster")
+				default:
+					return "", nil
+				}
+			}
+
+			version, err := lockPool.ClaimLock(ctx, "some-lock", "")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(out.Version{Ref: "some-ref"}))
+
+			Ω(fakeLockHandler.ClaimLockCallCount()).Should(Equal(7))
+			Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(4))
+		})
+
+		It("gives up after as many unexpected errors as configured", func() {
+			lockPool.Source.RetryBackoff.MaxUnexpectedErrors = 2
+
+			fakeLockHandler.ClaimLockReturns("some-ref", nil)
+			fakeLockHandler.BroadcastLockPoolReturns("some git message", errors.New("disaster"))
+
+			_, err := lockPool.ClaimLock(ctx, "some-lock", "")
+			Ω(err).Should(HaveOccurred())
+			Ω(ctx.Err()).ShouldNot(HaveOccurred())
+
+			Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(2))
+		})
+
+		It("counts an attempt that failed for another reason as an unexpected error", func() {
+			lockPool.Source.RetryBackoff.MaxUnexpectedErrors = 2
+
+			fakeLockHandler.ClaimLockReturns("", errors.New("disaster"))
+
+			_, err := lockPool.ClaimLock(ctx, "some-lock", "")
+			Ω(err).Should(HaveOccurred())
+			Ω(ctx.Err()).ShouldNot(HaveOccurred())
+
+			Ω(fakeLockHandler.ClaimLockCallCount()).Should(Equal(2))
+			Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(BeZero())
+		})
+	})
+
+	Context("Aborting a step", func() {
+		var cancel context.CancelCauseFunc
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancelCause(context.Background())
+		})
+
+		AfterEach(func() {
+			cancel(nil)
+		})
+
+		Context("while waiting for a lock", func() {
+			BeforeEach(func() {
+				fakeLockHandler.ClaimLockStub = func(string, out.ClaimMode) (string, error) {
+					if fakeLockHandler.ClaimLockCallCount() == 2 {
+						cancel(errors.New("aborted by terminated"))
+					}
+
+					return "", out.ErrNoLocksAvailable
+				}
+			})
+
+			It("stops waiting, and returns why", func() {
+				_, err := lockPool.ClaimLock(ctx, "some-lock", "")
+				Ω(err).Should(MatchError("aborted by terminated"))
+
+				Ω(fakeLockHandler.ClaimLockCallCount()).Should(Equal(2))
+			})
+
+			It("rolls back any claim that may have been pushed", func() {
+				_, err := lockPool.ClaimLock(ctx, "some-lock", "")
+				Ω(err).Should(HaveOccurred())
+
+				Ω(output).Should(gbytes.Say(`aborted! \(aborted by terminated\) rolling back`))
+				Ω(fakeLockHandler.RollBackClaimsCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("right as the claim is pushed", func() {
+			var rollBackErr error
+
+			BeforeEach(func() {
+				fakeLockHandler.ClaimLockReturns("some-ref", nil)
+
+				fakeLockHandler.BroadcastLockPoolStub = func(broadcastCtx context.Context) (string, error) {
+					if fakeLockHandler.BroadcastLockPoolCallCount() == 1 {
+						cancel(errors.New("aborted by terminated"))
+					} else {
+						rollBackErr = broadcastCtx.Err()
+					}
+
+					return "", nil
+				}
+			})
+
+			It("rolls back the claim, even though the step was aborted", func() {
+				_, err := lockPool.ClaimLock(ctx, "some-lock", "")
+				Ω(err).Should(MatchError("aborted by terminated"))
+
+				Ω(fakeLockHandler.RollBackClaimsCallCount()).Should(Equal(1))
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(2))
+
+				Ω(rollBackErr).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("right as the locks are acquired", func() {
+			BeforeEach(func() {
+				fakeLockHandler.GrabAvailableLockReturns(map[string][]string{"my-pool": {"some-lock"}}, "some-ref", nil)
+
+				fakeLockHandler.BroadcastLockPoolStub = func(context.Context) (string, error) {
+					if fakeLockHandler.BroadcastLockPoolCallCount() == 1 {
+						cancel(errors.New("aborted by terminated"))
+					}
+
+					return "", nil
+				}
+			})
+
+			It("rolls back the claims", func() {
+				_, _, err := lockPool.AcquireLocks(ctx, out.AcquireParams{Enabled: true})
+				Ω(err).Should(MatchError("aborted by terminated"))
+
+				Ω(fakeLockHandler.RollBackClaimsCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("while waiting in the fair queue", func() {
+			BeforeEach(func() {
+				lockPool.Source.FairQueue = true
+
+				fakeLockHandler.ClaimLockStub = func(string, out.ClaimMode) (string, error) {
+					if fakeLockHandler.ClaimLockCallCount() == 3 {
+						cancel(errors.New("aborted by terminated"))
+					}
+
+					return "", out.ErrNoLocksAvailable
+				}
+			})
+
+			It("leaves the queue", func() {
+				_, err := lockPool.ClaimLock(ctx, "some-lock", "")
+				Ω(err).Should(MatchError("aborted by terminated"))
+
+				Ω(fakeLockHandler.EnqueueCallCount()).Should(Equal(1))
+				Ω(fakeLockHandler.LeaveQueueCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("while releasing a lock", func() {
+			var lockDir string
+
+			BeforeEach(func() {
+				var err error
+
+				lockDir, err = os.MkdirTemp("", "lock-dir")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = os.WriteFile(filepath.Join(lockDir, "name"), []byte("some-lock"), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fakeLockHandler.BroadcastLockPoolStub = func(context.Context) (string, error) {
+					cancel(errors.New("aborted by terminated"))
+					return "", out.ErrLockConflict
+				}
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(lockDir)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("stops without rolling anything back", func() {
+				_, _, err := lockPool.ReleaseLock(ctx, lockDir, false)
+				Ω(err).Should(MatchError("aborted by terminated"))
+
+				Ω(fakeLockHandler.BroadcastLockPoolCallCount()).Should(Equal(1))
+				Ω(fakeLockHandler.RollBackClaimsCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Context("Closing the pool", func() {
+		It("cleans up after the lock handler", func() {
+			err := lockPool.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeLockHandler.CleanupCallCount()).Should(Equal(1))
+		})
+
+		Context("when cleaning up fails", func() {
+			BeforeEach(func() {
+				fakeLockHandler.CleanupReturns(errors.New("some-error"))
+			})
+
+			It("returns an error", func() {
+				err := lockPool.Close()
+				Ω(err).Should(MatchError("some-error"))
+			})
+		})
+	})
 })
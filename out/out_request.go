@@ -3,6 +3,9 @@ package out
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -14,66 +17,180 @@ type OutRequest struct {
 }
 
 type Source struct {
-	URI        string        `json:"uri"`
-	Branch     string        `json:"branch"`
-	PrivateKey string        `json:"private_key" mapstructure:"private_key"`
-	Pool       string        `json:"pool"`
-	RetryDelay time.Duration `json:"retry_delay" mapstructure:"retry_delay"`
+	URI           string        `json:"uri"`
+	Branch        string        `json:"branch"`
+	PrivateKey    string        `json:"private_key" mapstructure:"private_key"`
+	Pool          string        `json:"pool"`
+	RetryDelay    time.Duration `json:"retry_delay" mapstructure:"retry_delay"`
+	LeaseDuration time.Duration `json:"lease_duration" mapstructure:"lease_duration"`
+
+	RetryBackoff RetryBackoff `json:"retry_backoff" mapstructure:"retry_backoff"`
+
+	SelectionStrategy string `json:"selection_strategy,omitempty" mapstructure:"selection_strategy"`
+
+	FairQueue        bool          `json:"fair_queue,omitempty" mapstructure:"fair_queue"`
+	FairQueueTimeout time.Duration `json:"fair_queue_timeout,omitempty" mapstructure:"fair_queue_timeout"`
+
+	// Backend is where the pool is kept, which is a git repository unless
+	// configured otherwise. Path is where the filesystem backend keeps it.
+	Backend    string           `json:"backend,omitempty"`
+	Path       string           `json:"path,omitempty"`
+	S3         S3Source         `json:"s3"`
+	Redis      RedisSource      `json:"redis"`
+	Kubernetes KubernetesSource `json:"kubernetes"`
+
+	GitEngine string `json:"git_engine,omitempty" mapstructure:"git_engine"`
+
+	SparseClone bool `json:"sparse_clone,omitempty" mapstructure:"sparse_clone"`
+
+	// only used by the go-git engine, as the scripts wrapping the resource
+	// configure the git binary with them
+	PrivateKeyUser       string `json:"private_key_user,omitempty" mapstructure:"private_key_user"`
+	PrivateKeyPassphrase string `json:"private_key_passphrase,omitempty" mapstructure:"private_key_passphrase"`
+	Username             string `json:"username,omitempty"`
+	Password             string `json:"password,omitempty"`
+	SkipSSLVerification  bool   `json:"skip_ssl_verification,omitempty" mapstructure:"skip_ssl_verification"`
+}
+
+// UsesGit is true if the pool is kept in a git repository.
+func (source Source) UsesGit() bool {
+	return source.Backend == "" || source.Backend == "git"
 }
 
 func (s *Source) UnmarshalJSON(b []byte) error {
-	var inputData map[string]any
-	err := json.NewDecoder(bytes.NewReader(b)).Decode(&inputData)
-	if err != nil {
-		return err
+	return decodeJSON(b, s)
+}
+
+type OutParams struct {
+	Release        string        `json:"release"`
+	ForceRelease   bool          `json:"force_release" mapstructure:"force_release"`
+	Acquire        AcquireParams `json:"acquire"`
+	TryAcquire     AcquireParams `json:"try_acquire" mapstructure:"try_acquire"`
+	Add            string        `json:"add"`
+	AddClaimed     string        `json:"add_claimed" mapstructure:"add_claimed"`
+	Remove         string        `json:"remove"`
+	Claim          string        `json:"claim"`
+	Mode           ClaimMode     `json:"mode,omitempty"`
+	Update         string        `json:"update"`
+	Check          string        `json:"check"`
+	CheckUnclaimed string        `json:"check_unclaimed" mapstructure:"check_unclaimed"`
+	Renew          string        `json:"renew"`
+	LeaseDuration  time.Duration `json:"lease_duration" mapstructure:"lease_duration"`
+	Timeout        time.Duration `json:"timeout,omitempty"`
+}
+
+func (p *OutParams) UnmarshalJSON(b []byte) error {
+	return decodeJSON(b, p)
+}
+
+// AcquireParams is given either as `acquire: true` or as an object of
+// options such as `acquire: {count: 3}`.
+type AcquireParams struct {
+	Enabled  bool     `json:"-" mapstructure:"-"`
+	Count    int      `json:"count,omitempty"`
+	Pools    []string `json:"pools,omitempty"`
+	Match    Selector `json:"match,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+}
+
+type acquireOptions AcquireParams
+
+func (p AcquireParams) MarshalJSON() ([]byte, error) {
+	if !p.Enabled {
+		return json.Marshal(false)
 	}
 
-	decodeConfig := &mapstructure.DecoderConfig{
-		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
-		Result:     s,
+	if p.Count == 0 && len(p.Pools) == 0 && len(p.Match) == 0 && p.Priority == 0 {
+		return json.Marshal(true)
 	}
 
-	decoder, err := mapstructure.NewDecoder(decodeConfig)
-	if err != nil {
-		return err
+	return json.Marshal(acquireOptions(p))
+}
+
+func (p AcquireParams) validate(param string, source Source) []string {
+	var errorMessages []string
+
+	if p.Count < 0 {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s count must be positive)", param))
 	}
 
-	err = decoder.Decode(inputData)
-	if err != nil {
-		return err
+	if slices.Contains(p.Pools, "") {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s pools must not be empty)", param))
 	}
 
-	return nil
-}
+	// the implicit get reads the locks from the commit that changed the pool
+	// of the source, so it has to be one of them
+	if len(p.Pools) > 0 && !slices.Contains(p.Pools, source.Pool) {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s pools must include the pool of the source: %s)", param, source.Pool))
+	}
 
-type OutParams struct {
-	Release        string `json:"release"`
-	Acquire        bool   `json:"acquire"`
-	Add            string `json:"add"`
-	AddClaimed     string `json:"add_claimed"`
-	Remove         string `json:"remove"`
-	Claim          string `json:"claim"`
-	Update         string `json:"update"`
-	Check          string `json:"check"`
-	CheckUnclaimed string `json:"check_unclaimed"`
+	errorMessages = append(errorMessages, p.Match.Validate()...)
+
+	if p.Priority != 0 && !source.FairQueue {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (%s priority requires a fair_queue)", param))
+	}
+
+	return errorMessages
 }
 
-func (request OutRequest) Validate() []string {
+func (source Source) Validate() []string {
 	var errorMessages []string
 
-	if request.Source.URI == "" {
-		errorMessages = append(errorMessages, "invalid payload (missing uri)")
+	if !ValidBackend(source.Backend) {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (unknown backend: %s)", source.Backend))
 	}
 
-	if request.Source.Pool == "" {
+	if source.UsesGit() {
+		if source.URI == "" {
+			errorMessages = append(errorMessages, "invalid payload (missing uri)")
+		}
+
+		if source.Branch == "" {
+			errorMessages = append(errorMessages, "invalid payload (missing branch)")
+		}
+	} else if source.GitEngine != "" || source.SparseClone {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (git_engine and sparse_clone do not apply to the %s backend)", source.Backend))
+	}
+
+	switch source.Backend {
+	case "filesystem":
+		if source.Path == "" {
+			errorMessages = append(errorMessages, "invalid payload (missing path)")
+		}
+	case "s3":
+		errorMessages = append(errorMessages, source.S3.validate()...)
+	case "redis":
+		errorMessages = append(errorMessages, source.Redis.validate()...)
+	case "kubernetes":
+		errorMessages = append(errorMessages, source.Kubernetes.validate()...)
+	}
+
+	if source.Pool == "" {
 		errorMessages = append(errorMessages, "invalid payload (missing pool)")
 	}
 
-	if request.Source.Branch == "" {
-		errorMessages = append(errorMessages, "invalid payload (missing branch)")
+	if _, found := SelectionStrategyNamed(source.SelectionStrategy); !found {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (unknown selection_strategy: %s)", source.SelectionStrategy))
+	}
+
+	if !ValidGitEngine(source.GitEngine) {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (unknown git_engine: %s)", source.GitEngine))
+	}
+
+	if source.SparseClone && source.GitEngine == "go-git" {
+		errorMessages = append(errorMessages, "invalid payload (sparse_clone is not supported by the go-git engine)")
 	}
 
-	if request.Params.Acquire == false &&
+	errorMessages = append(errorMessages, source.RetryBackoff.validate()...)
+
+	return errorMessages
+}
+
+func (request OutRequest) Validate() []string {
+	errorMessages := request.Source.Validate()
+
+	if !request.Params.Acquire.Enabled &&
+		!request.Params.TryAcquire.Enabled &&
 		request.Params.Release == "" &&
 		request.Params.Add == "" &&
 		request.Params.AddClaimed == "" &&
@@ -81,9 +198,88 @@ func (request OutRequest) Validate() []string {
 		request.Params.Claim == "" &&
 		request.Params.Update == "" &&
 		request.Params.Check == "" &&
+		request.Params.CheckUnclaimed == "" &&
+		request.Params.Renew == "" {
+		errorMessages = append(errorMessages, "invalid payload (missing acquire, try_acquire, release, remove, claim, add, add_claimed, update, check, check_unclaimed, or renew)")
+	}
+
+	errorMessages = append(errorMessages, request.Params.Acquire.validate("acquire", request.Source)...)
+	errorMessages = append(errorMessages, request.Params.TryAcquire.validate("try_acquire", request.Source)...)
+
+	if request.Params.Timeout != 0 &&
+		!request.Params.Acquire.Enabled &&
+		request.Params.Claim == "" &&
+		request.Params.Update == "" &&
+		request.Params.Check == "" &&
 		request.Params.CheckUnclaimed == "" {
-		errorMessages = append(errorMessages, "invalid payload (missing acquire, release, remove, claim, add, add_claimed, update, check, or check_unclaimed)")
+		errorMessages = append(errorMessages, "invalid payload (timeout only applies to acquire, claim, update, check, or check_unclaimed)")
+	}
+
+	if !request.Params.Mode.Valid() {
+		errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (unknown mode: %s)", request.Params.Mode))
+	}
+
+	if request.Params.Mode != "" &&
+		request.Params.Claim == "" &&
+		request.Params.Check == "" {
+		errorMessages = append(errorMessages, "invalid payload (mode only applies to claim or check)")
+	}
+
+	if request.Params.Renew != "" &&
+		request.Source.LeaseDuration == 0 &&
+		request.Params.LeaseDuration == 0 {
+		errorMessages = append(errorMessages, "invalid payload (renew requires a lease_duration)")
 	}
 
 	return errorMessages
 }
+
+func decodeJSON(b []byte, result any) error {
+	var inputData map[string]any
+	err := json.NewDecoder(bytes.NewReader(b)).Decode(&inputData)
+	if err != nil {
+		return err
+	}
+
+	return decode(inputData, result)
+}
+
+func decode(inputData any, result any) error {
+	decodeConfig := &mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			acquireParamsHookFunc,
+		),
+		Result: result,
+	}
+
+	decoder, err := mapstructure.NewDecoder(decodeConfig)
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(inputData)
+}
+
+func acquireParamsHookFunc(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeOf(AcquireParams{}) {
+		return data, nil
+	}
+
+	switch value := data.(type) {
+	case bool:
+		return AcquireParams{Enabled: value}, nil
+	case map[string]any:
+		var options acquireOptions
+		err := decode(value, &options)
+		if err != nil {
+			return nil, err
+		}
+
+		params := AcquireParams(options)
+		params.Enabled = true
+		return params, nil
+	}
+
+	return data, nil
+}
@@ -2,6 +2,7 @@ package out_test
 
 import (
 	"encoding/json"
+	"time"
 
 	. "github.com/concourse/pool-resource/out"
 
@@ -22,7 +23,50 @@ var _ = Describe("OutRequest", func() {
 					"branch": "develop",
 					"private_key": "fake-private-key",
 					"pool": "fake-pool",
-					"retry_delay": "1h5m10s"
+					"retry_delay": "1h5m10s",
+					"lease_duration": "2h",
+					"fair_queue": true,
+					"fair_queue_timeout": "10m",
+					"git_engine": "go-git",
+					"sparse_clone": true,
+					"backend": "filesystem",
+					"path": "/some/path",
+					"s3": {
+						"bucket": "some-bucket",
+						"key": "some/pools.json",
+						"region_name": "eu-west-1",
+						"endpoint": "http://minio:9000",
+						"use_path_style": true,
+						"access_key_id": "some-access-key-id",
+						"secret_access_key": "some-secret-access-key",
+						"session_token": "some-session-token"
+					},
+					"redis": {
+						"address": "redis:6379",
+						"username": "some-username",
+						"password": "some-password",
+						"db": 2,
+						"tls": true,
+						"key": "some-pools"
+					},
+					"kubernetes": {
+						"namespace": "some-namespace",
+						"config_map": "some-pools",
+						"kubeconfig": "some-kubeconfig",
+						"context": "some-context"
+					},
+					"retry_backoff": {
+						"no_locks": {"initial": "5s", "max": "2m", "multiplier": 2, "jitter": 0.5},
+						"conflict": {"initial": "1s"},
+						"max_unexpected_errors": 10
+					}
+				},
+				"params": {
+					"acquire": true,
+					"add_claimed": "some-lock-dir",
+					"mode": "shared",
+					"lease_duration": "30m",
+					"timeout": "90s"
 				}
 			}`)
 		})
@@ -36,6 +80,294 @@ var _ = Describe("OutRequest", func() {
 			Expect(request.Source.PrivateKey).To(Equal("fake-private-key"))
 			Expect(request.Source.Pool).To(Equal("fake-pool"))
 			Expect(request.Source.RetryDelay.String()).To(Equal("1h5m10s"))
+			Expect(request.Source.LeaseDuration).To(Equal(2 * time.Hour))
+			Expect(request.Source.FairQueue).To(BeTrue())
+			Expect(request.Source.FairQueueTimeout).To(Equal(10 * time.Minute))
+			Expect(request.Source.GitEngine).To(Equal("go-git"))
+			Expect(request.Source.SparseClone).To(BeTrue())
+			Expect(request.Source.Backend).To(Equal("filesystem"))
+			Expect(request.Source.Path).To(Equal("/some/path"))
+			Expect(request.Source.S3).To(Equal(S3Source{
+				Bucket:          "some-bucket",
+				Key:             "some/pools.json",
+				RegionName:      "eu-west-1",
+				Endpoint:        "http://minio:9000",
+				UsePathStyle:    true,
+				AccessKeyID:     "some-access-key-id",
+				SecretAccessKey: "some-secret-access-key",
+				SessionToken:    "some-session-token",
+			}))
+			Expect(request.Source.Redis).To(Equal(RedisSource{
+				Address:  "redis:6379",
+				Username: "some-username",
+				Password: "some-password",
+				DB:       2,
+				TLS:      true,
+				Key:      "some-pools",
+			}))
+			Expect(request.Source.Kubernetes).To(Equal(KubernetesSource{
+				Namespace:  "some-namespace",
+				ConfigMap:  "some-pools",
+				Kubeconfig: "some-kubeconfig",
+				Context:    "some-context",
+			}))
+			Expect(request.Source.RetryBackoff).To(Equal(RetryBackoff{
+				NoLocks:             Backoff{Initial: 5 * time.Second, Max: 2 * time.Minute, Multiplier: 2, Jitter: 0.5},
+				Conflict:            Backoff{Initial: time.Second},
+				MaxUnexpectedErrors: 10,
+			}))
+			Expect(request.Params.Acquire).To(Equal(AcquireParams{Enabled: true}))
+			Expect(request.Params.AddClaimed).To(Equal("some-lock-dir"))
+			Expect(request.Params.Mode).To(Equal(SharedMode))
+			Expect(request.Params.LeaseDuration).To(Equal(30 * time.Minute))
+			Expect(request.Params.Timeout).To(Equal(90 * time.Second))
+		})
+
+		Context("when acquire is given options", func() {
+			It("parses them and enables acquire", func() {
+				var params OutParams
+				err := json.Unmarshal([]byte(`{"acquire": {"count": 3}}`), &params)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(params.Acquire).To(Equal(AcquireParams{Enabled: true, Count: 3}))
+			})
+
+			It("parses them for try_acquire too", func() {
+				var params OutParams
+				err := json.Unmarshal([]byte(`{"try_acquire": {"count": 2}}`), &params)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(params.TryAcquire).To(Equal(AcquireParams{Enabled: true, Count: 2}))
+				Expect(params.Acquire.Enabled).To(BeFalse())
+			})
+
+			It("parses a priority", func() {
+				var params OutParams
+				err := json.Unmarshal([]byte(`{"acquire": {"priority": -5}}`), &params)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(params.Acquire).To(Equal(AcquireParams{Enabled: true, Priority: -5}))
+			})
+
+			It("parses a selector to match", func() {
+				var params OutParams
+				err := json.Unmarshal([]byte(`{"acquire": {"match": {"region": "us-east-1", "size": ["small", "medium"]}}}`), &params)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(params.Acquire.Enabled).To(BeTrue())
+				Expect(params.Acquire.Match).To(Equal(Selector{
+					"region": "us-east-1",
+					"size":   []any{"small", "medium"},
+				}))
+			})
+		})
+	})
+
+	Describe("marshalling", func() {
+		It("round trips acquire", func() {
+			for _, acquire := range []AcquireParams{{}, {Enabled: true}, {Enabled: true, Count: 3}, {Enabled: true, Pools: []string{"some-pool"}}} {
+				payload, err := json.Marshal(OutParams{Acquire: acquire})
+				Expect(err).NotTo(HaveOccurred())
+
+				var params OutParams
+				err = json.Unmarshal(payload, &params)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(params.Acquire).To(Equal(acquire))
+			}
+		})
+	})
+
+	Describe("validating", func() {
+		It("rejects a negative acquire count", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool"},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true, Count: -1}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (acquire count must be positive)"))
+		})
+
+		It("rejects an empty pool to acquire from", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool"},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true, Pools: []string{"some-pool", ""}}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (acquire pools must not be empty)"))
+		})
+
+		It("rejects pools to acquire from that leave out the pool of the source", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool"},
+				Params: OutParams{TryAcquire: AcquireParams{Enabled: true, Pools: []string{"some-other-pool", "another-pool"}}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (try_acquire pools must include the pool of the source: some-pool)"))
+		})
+
+		It("rejects a timeout for steps that do not wait", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool"},
+				Params: OutParams{Release: "some-lock", Timeout: time.Minute},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (timeout only applies to acquire, claim, update, check, or check_unclaimed)"))
+
+			request.Params = OutParams{Claim: "some-lock", Timeout: time.Minute}
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects a priority without a fair queue", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool"},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true, Priority: 1}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (acquire priority requires a fair_queue)"))
+
+			request.Source.FairQueue = true
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects an unknown git engine", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool", GitEngine: "libgit2"},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (unknown git_engine: libgit2)"))
+
+			request.Source.GitEngine = "git"
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects a sparse clone with the go-git engine", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool", GitEngine: "go-git", SparseClone: true},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (sparse_clone is not supported by the go-git engine)"))
+
+			request.Source.GitEngine = "git"
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects an unknown backend", func() {
+			request := OutRequest{
+				Source: Source{Backend: "floppy", Path: "/some/path", Pool: "some-pool"},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (unknown backend: floppy)"))
+
+			request.Source.Backend = "filesystem"
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("requires a path, but no uri or branch, for the filesystem backend", func() {
+			request := OutRequest{
+				Source: Source{Backend: "filesystem", Pool: "some-pool"},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (missing path)"))
+
+			request.Source.Path = "/some/path"
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("requires a bucket, and complete credentials if any, for the s3 backend", func() {
+			request := OutRequest{
+				Source: Source{Backend: "s3", Pool: "some-pool", S3: S3Source{AccessKeyID: "some-access-key-id"}},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf(
+				"invalid payload (missing s3.bucket)",
+				"invalid payload (s3.access_key_id and s3.secret_access_key must be given together)",
+			))
+
+			request.Source.S3 = S3Source{Bucket: "some-bucket"}
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("requires an address for the redis backend", func() {
+			request := OutRequest{
+				Source: Source{Backend: "redis", Pool: "some-pool", Redis: RedisSource{DB: -1}},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf(
+				"invalid payload (missing redis.address)",
+				"invalid payload (redis.db must be positive)",
+			))
+
+			request.Source.Redis = RedisSource{Address: "localhost:6379"}
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("requires a namespace for the kubernetes backend", func() {
+			request := OutRequest{
+				Source: Source{Backend: "kubernetes", Pool: "some-pool", Kubernetes: KubernetesSource{Context: "some-context"}},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf(
+				"invalid payload (missing kubernetes.namespace)",
+				"invalid payload (kubernetes.context requires a kubernetes.kubeconfig)",
+			))
+
+			request.Source.Kubernetes = KubernetesSource{Namespace: "some-namespace"}
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects git options for backends other than git", func() {
+			request := OutRequest{
+				Source: Source{Backend: "filesystem", Path: "/some/path", Pool: "some-pool", SparseClone: true},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (git_engine and sparse_clone do not apply to the filesystem backend)"))
+
+			request.Source = Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool", Backend: "git", SparseClone: true}
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects a retry backoff that does not make sense", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool", RetryBackoff: RetryBackoff{
+					NoLocks:             Backoff{Initial: time.Minute, Max: time.Second},
+					Conflict:            Backoff{Multiplier: 0.5, Jitter: 2},
+					UnexpectedError:     Backoff{Initial: -time.Second},
+					MaxUnexpectedErrors: -1,
+				}},
+				Params: OutParams{Acquire: AcquireParams{Enabled: true}},
+			}
+
+			Expect(request.Validate()).To(ConsistOf(
+				"invalid payload (retry_backoff.no_locks max must not be less than initial)",
+				"invalid payload (retry_backoff.conflict multiplier must be at least 1)",
+				"invalid payload (retry_backoff.conflict jitter must be between 0 and 1)",
+				"invalid payload (retry_backoff.unexpected_error durations must be positive)",
+				"invalid payload (retry_backoff.max_unexpected_errors must be positive)",
+			))
+
+			request.Source.RetryBackoff = RetryBackoff{
+				NoLocks: Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 1},
+			}
+			Expect(request.Validate()).To(BeEmpty())
+		})
+
+		It("rejects unknown modes, and modes for steps that do not claim or check a lock", func() {
+			request := OutRequest{
+				Source: Source{URI: "some-uri", Branch: "some-branch", Pool: "some-pool"},
+				Params: OutParams{Claim: "some-lock", Mode: "read-only"},
+			}
+
+			Expect(request.Validate()).To(ConsistOf("invalid payload (unknown mode: read-only)"))
+
+			request.Params = OutParams{Acquire: AcquireParams{Enabled: true}, Mode: SharedMode}
+			Expect(request.Validate()).To(ConsistOf("invalid payload (mode only applies to claim or check)"))
+
+			request.Params = OutParams{Check: "some-lock", Mode: SharedMode}
+			Expect(request.Validate()).To(BeEmpty())
 		})
 	})
 })
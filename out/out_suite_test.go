@@ -1,6 +1,9 @@
 package out_test
 
 import (
+	"os"
+	"os/exec"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +14,39 @@ func TestOut(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Out Suite")
 }
+
+// createBareGitRepo creates a bare repository with a pool named lock-pool,
+// holding a single unclaimed lock named some-lock.
+func createBareGitRepo() string {
+	bareGitRepo, err := os.MkdirTemp("", "bare-git-repo")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	setup := exec.Command("bash", "-e", "-c", `
+		git init -q --bare --initial-branch=master .
+
+		clone=$(mktemp -d)
+		git clone -q "$PWD" "$clone"
+		cd "$clone"
+
+		git config user.email "ginkgo@localhost"
+		git config user.name "Ginkgo Local"
+
+		mkdir -p lock-pool/unclaimed lock-pool/claimed
+		touch lock-pool/unclaimed/.gitkeep lock-pool/claimed/.gitkeep
+		echo '{}' > lock-pool/unclaimed/some-lock
+
+		git add .
+		git commit -q -m "adding some-lock"
+		git push -q origin HEAD:master
+
+		rm -rf "$clone"
+	`)
+	setup.Dir = bareGitRepo
+	setup.Stdout = GinkgoWriter
+	setup.Stderr = GinkgoWriter
+
+	err = setup.Run()
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return bareGitRepo
+}
@@ -0,0 +1,274 @@
+package out
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// historyLimit is how many changes a PoolState keeps in its log, and how many
+// removed files it remembers.
+const historyLimit = 1000
+
+// PoolState is a pool kept outside of git. It has the files of the pool as
+// they are, along with enough of their history for everything the resource
+// asks of the history of a repository. Every change to it is a revision,
+// which stands in for the ref of a commit.
+type PoolState struct {
+	Revision int64 `json:"revision"`
+
+	Files map[string]StoredFile `json:"files"`
+
+	// the files that were removed, with their last contents
+	Removed map[string]StoredFile `json:"removed,omitempty"`
+
+	// the most recent changes, most recent last
+	Log []Change `json:"log,omitempty"`
+}
+
+// StoredFile is a file of a pool, and the revisions that added it, last
+// changed it, and removed it.
+type StoredFile struct {
+	Contents string `json:"contents,omitempty"`
+	Added    int64  `json:"added"`
+	Changed  int64  `json:"changed"`
+	Removed  int64  `json:"removed,omitempty"`
+}
+
+// Change lists the files changed by a revision.
+type Change struct {
+	Revision int64    `json:"revision"`
+	Message  string   `json:"message"`
+	Paths    []string `json:"paths"`
+}
+
+// ParseRevision parses a version of a pool kept outside of git.
+func ParseRevision(ref string) (int64, error) {
+	revision, err := strconv.ParseInt(strings.TrimSpace(ref), 10, 64)
+	if err != nil || revision < 0 {
+		return 0, fmt.Errorf("invalid revision: %q", ref)
+	}
+
+	return revision, nil
+}
+
+// Commit makes a revision out of the differences between the files of the
+// state and the given files, and returns false if there are none.
+func (state *PoolState) Commit(files map[string]string, message string) bool {
+	revision := state.Revision + 1
+
+	if state.Files == nil {
+		state.Files = map[string]StoredFile{}
+	}
+
+	if state.Removed == nil {
+		state.Removed = map[string]StoredFile{}
+	}
+
+	var paths []string
+
+	for path, contents := range files {
+		file, found := state.Files[path]
+		if found && file.Contents == contents {
+			continue
+		}
+
+		if !found {
+			file = StoredFile{Added: revision}
+			delete(state.Removed, path)
+		}
+
+		file.Contents = contents
+		file.Changed = revision
+		state.Files[path] = file
+
+		paths = append(paths, path)
+	}
+
+	for path, file := range state.Files {
+		if _, found := files[path]; found {
+			continue
+		}
+
+		delete(state.Files, path)
+
+		file.Removed = revision
+		state.Removed[path] = file
+
+		paths = append(paths, path)
+	}
+
+	if len(paths) == 0 {
+		return false
+	}
+
+	slices.Sort(paths)
+
+	state.Revision = revision
+	state.Log = append(state.Log, Change{Revision: revision, Message: message, Paths: paths})
+	state.forget()
+
+	return true
+}
+
+// forget drops the oldest changes and removed files beyond the historyLimit.
+func (state *PoolState) forget() {
+	if len(state.Log) > historyLimit {
+		state.Log = slices.Clone(state.Log[len(state.Log)-historyLimit:])
+	}
+
+	if len(state.Removed) > historyLimit {
+		paths := slices.SortedFunc(maps.Keys(state.Removed), func(a, b string) int {
+			return cmp.Compare(state.Removed[a].Removed, state.Removed[b].Removed)
+		})
+
+		for _, path := range paths[:len(paths)-historyLimit] {
+			delete(state.Removed, path)
+		}
+	}
+}
+
+// Clone returns a copy of the state that can be changed on its own.
+func (state PoolState) Clone() PoolState {
+	state.Files = maps.Clone(state.Files)
+	state.Removed = maps.Clone(state.Removed)
+	state.Log = slices.Clone(state.Log)
+	return state
+}
+
+// Contents returns the contents of each of the files of the pool.
+func (state PoolState) Contents() map[string]string {
+	contents := map[string]string{}
+	for path, file := range state.Files {
+		contents[path] = file.Contents
+	}
+
+	return contents
+}
+
+// FirstRevision is the oldest revision the log goes back to.
+func (state PoolState) FirstRevision() int64 {
+	return state.Revision - int64(len(state.Log))
+}
+
+// ChangedSince is true if a revision after the given one changed the file
+// at path, or any file within it.
+func (state PoolState) ChangedSince(revision int64, path string) bool {
+	for filePath, file := range state.Files {
+		if within(filePath, path) && file.Changed > revision {
+			return true
+		}
+	}
+
+	for filePath, file := range state.Removed {
+		if within(filePath, path) && file.Removed > revision {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilesAt lists the paths of the files directly within dir at the given
+// revision.
+func (state PoolState) FilesAt(revision int64, dir string) []string {
+	var paths []string
+	for path := range state.At(revision) {
+		if within(path, dir) && !strings.Contains(strings.TrimPrefix(path, dir+"/"), "/") {
+			paths = append(paths, path)
+		}
+	}
+
+	slices.Sort(paths)
+	return paths
+}
+
+// At returns the files there were at the given revision. As only the latest
+// contents of a file are kept, files changed since have their latest
+// contents.
+func (state PoolState) At(revision int64) map[string]string {
+	files := map[string]string{}
+
+	for path, file := range state.Files {
+		if file.Added <= revision {
+			files[path] = file.Contents
+		}
+	}
+
+	for path, file := range state.Removed {
+		if file.Added <= revision && revision < file.Removed {
+			files[path] = file.Contents
+		}
+	}
+
+	return files
+}
+
+// AddedFiles lists the files within any of the dirs by the revision that
+// last added them, most recent first.
+func (state PoolState) AddedFiles(dirs ...string) []string {
+	added := map[string]int64{}
+
+	for _, files := range []map[string]StoredFile{state.Files, state.Removed} {
+		for path, file := range files {
+			if slices.ContainsFunc(dirs, func(dir string) bool { return within(path, dir) }) {
+				added[path] = file.Added
+			}
+		}
+	}
+
+	return slices.SortedFunc(maps.Keys(added), func(a, b string) int {
+		return cmp.Or(cmp.Compare(added[b], added[a]), strings.Compare(a, b))
+	})
+}
+
+// ChangeAt returns the change the given revision made, as long as the log
+// goes back to it.
+func (state PoolState) ChangeAt(revision int64) (Change, bool) {
+	index := revision - state.FirstRevision() - 1
+	if index < 0 || index >= int64(len(state.Log)) {
+		return Change{}, false
+	}
+
+	return state.Log[index], true
+}
+
+// LastChange returns the most recent change up to the given revision to any
+// file within path, other than within exclude.
+func (state PoolState) LastChange(revision int64, path string, exclude string) (Change, bool) {
+	for i := len(state.Log) - 1; i >= 0; i-- {
+		change := state.Log[i]
+		if change.Revision <= revision && change.touches(path, exclude) {
+			return change, true
+		}
+	}
+
+	return Change{}, false
+}
+
+// ChangesSince lists the changes from the given revision on to any file
+// within path, other than within exclude, oldest first.
+func (state PoolState) ChangesSince(revision int64, path string, exclude string) []Change {
+	var changes []Change
+	for _, change := range state.Log {
+		if change.Revision >= revision && change.touches(path, exclude) {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+func (change Change) touches(path string, exclude string) bool {
+	return slices.ContainsFunc(change.Paths, func(changed string) bool {
+		return within(changed, path) && !within(changed, exclude)
+	})
+}
+
+// within is true if path is dir, or a path within it.
+func within(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,148 @@
+package out_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("PoolState", func() {
+	var state out.PoolState
+
+	BeforeEach(func() {
+		state = out.PoolState{}
+
+		// revision 1
+		state.Commit(map[string]string{
+			"lock-pool/unclaimed/some-lock":       "{}",
+			"lock-pool/unclaimed/some-other-lock": "{}",
+		}, "adding locks")
+
+		// revision 2
+		state.Commit(map[string]string{
+			"lock-pool/claimed/some-lock":         "{}",
+			"lock-pool/claims/some-lock/claim-a":  `{"owner":"a"}`,
+			"lock-pool/unclaimed/some-other-lock": "{}",
+		}, "claiming: some-lock")
+
+		// revision 3
+		state.Commit(map[string]string{
+			"lock-pool/claimed/some-lock":         "{}",
+			"lock-pool/claims/some-lock/claim-a":  `{"owner":"a","expires_at":"later"}`,
+			"lock-pool/unclaimed/some-other-lock": "{}",
+		}, "renewing: some-lock")
+	})
+
+	It("makes a revision of each change", func() {
+		Ω(state.Revision).Should(Equal(int64(3)))
+		Ω(state.Log).Should(HaveLen(3))
+
+		Ω(state.Log[1]).Should(Equal(out.Change{
+			Revision: 2,
+			Message:  "claiming: some-lock",
+			Paths: []string{
+				"lock-pool/claimed/some-lock",
+				"lock-pool/claims/some-lock/claim-a",
+				"lock-pool/unclaimed/some-lock",
+			},
+		}))
+	})
+
+	It("makes no revision if nothing changed", func() {
+		Ω(state.Commit(state.Contents(), "nothing")).Should(BeFalse())
+		Ω(state.Revision).Should(Equal(int64(3)))
+	})
+
+	It("tells whether a file was changed since a revision", func() {
+		Ω(state.ChangedSince(2, "lock-pool/claimed/some-lock")).Should(BeFalse())
+		Ω(state.ChangedSince(1, "lock-pool/claimed/some-lock")).Should(BeTrue())
+		Ω(state.ChangedSince(2, "lock-pool/claims/some-lock")).Should(BeTrue())
+		Ω(state.ChangedSince(1, "lock-pool/unclaimed/some-lock")).Should(BeTrue())
+		Ω(state.ChangedSince(2, "lock-pool/unclaimed")).Should(BeFalse())
+	})
+
+	It("lists the files there were at a revision", func() {
+		Ω(state.FilesAt(1, "lock-pool/unclaimed")).Should(Equal([]string{
+			"lock-pool/unclaimed/some-lock",
+			"lock-pool/unclaimed/some-other-lock",
+		}))
+
+		Ω(state.FilesAt(3, "lock-pool/unclaimed")).Should(Equal([]string{
+			"lock-pool/unclaimed/some-other-lock",
+		}))
+
+		Ω(state.FilesAt(1, "lock-pool/claims/some-lock")).Should(BeEmpty())
+		Ω(state.FilesAt(2, "lock-pool/claims/some-lock")).Should(Equal([]string{
+			"lock-pool/claims/some-lock/claim-a",
+		}))
+	})
+
+	It("lists the files that were added, most recently added first", func() {
+		state.Commit(map[string]string{
+			"lock-pool/unclaimed/some-lock":     "{}",
+			"lock-pool/claimed/some-other-lock": "{}",
+		}, "releasing: some-lock, claiming: some-other-lock")
+
+		Ω(state.AddedFiles("lock-pool/claimed", "lock-pool/claims")).Should(Equal([]string{
+			"lock-pool/claimed/some-other-lock",
+			"lock-pool/claimed/some-lock",
+			"lock-pool/claims/some-lock/claim-a",
+		}))
+	})
+
+	It("finds the changes to a path, leaving out those to what is excluded", func() {
+		state.Commit(map[string]string{
+			"lock-pool/claimed/some-lock":         "{}",
+			"lock-pool/claims/some-lock/claim-a":  `{"owner":"a","expires_at":"later"}`,
+			"lock-pool/unclaimed/some-other-lock": "{}",
+			"lock-pool/waiting/ticket":            "{}",
+		}, "joining the queue")
+
+		change, found := state.LastChange(state.Revision, "lock-pool", "lock-pool/waiting")
+		Ω(found).Should(BeTrue())
+		Ω(change.Revision).Should(Equal(int64(3)))
+
+		change, found = state.LastChange(1, "lock-pool", "lock-pool/waiting")
+		Ω(found).Should(BeTrue())
+		Ω(change.Revision).Should(Equal(int64(1)))
+
+		var revisions []int64
+		for _, change := range state.ChangesSince(2, "lock-pool", "lock-pool/waiting") {
+			revisions = append(revisions, change.Revision)
+		}
+		Ω(revisions).Should(Equal([]int64{2, 3}))
+
+		change, found = state.ChangeAt(4)
+		Ω(found).Should(BeTrue())
+		Ω(change.Message).Should(Equal("joining the queue"))
+	})
+
+	It("forgets the oldest changes and removed files", func() {
+		for i := range 1100 {
+			files := state.Contents()
+			files[fmt.Sprintf("lock-pool/waiting/ticket-%d", i)] = "{}"
+			delete(files, fmt.Sprintf("lock-pool/waiting/ticket-%d", i-1))
+
+			state.Commit(files, "refreshing the ticket")
+		}
+
+		Ω(state.Revision).Should(Equal(int64(1103)))
+		Ω(state.Log).Should(HaveLen(1000))
+		Ω(state.FirstRevision()).Should(Equal(int64(103)))
+		Ω(state.Removed).Should(HaveLen(1000))
+
+		_, found := state.ChangeAt(103)
+		Ω(found).Should(BeFalse())
+
+		change, found := state.ChangeAt(104)
+		Ω(found).Should(BeTrue())
+		Ω(change.Revision).Should(Equal(int64(104)))
+
+		// the lock claimed before is still known to have been claimed
+		Ω(state.ChangedSince(2, "lock-pool/claimed/some-lock")).Should(BeFalse())
+		Ω(state.AddedFiles("lock-pool/claimed")).Should(Equal([]string{"lock-pool/claimed/some-lock"}))
+	})
+})
@@ -0,0 +1,41 @@
+package out
+
+import "context"
+
+// PoolStore keeps a pool somewhere other than in a git repository, as a
+// PoolState.
+type PoolStore interface {
+	// Load returns the latest state of the pool.
+	Load(ctx context.Context) (PoolState, error)
+
+	// Save saves the changes made to the state that was last loaded, and
+	// returns the revision the last of them was saved as. It returns
+	// ErrLockConflict if someone else saved changes in the meantime that
+	// these cannot be saved on top of.
+	Save(ctx context.Context, state PoolState) (revision int64, err error)
+}
+
+var poolStores = map[string]func(Source) PoolStore{
+	"filesystem": newFilesystemStore,
+	"s3":         newS3Store,
+	"redis":      newRedisStore,
+	"kubernetes": newKubernetesStore,
+}
+
+// ValidBackend is true for the backends a source can be configured with,
+// where the pool is kept in git if none is configured.
+func ValidBackend(name string) bool {
+	_, found := poolStores[name]
+	return name == "" || name == "git" || found
+}
+
+// NewPoolStore returns the store of the backend of the source, or nil if the
+// pool is kept in git.
+func NewPoolStore(source Source) PoolStore {
+	newStore, found := poolStores[source.Backend]
+	if !found {
+		return nil
+	}
+
+	return newStore(source)
+}
@@ -0,0 +1,148 @@
+package out_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+// itIsAPoolStore describes what every backend's PoolStore does, given a pool
+// with some-lock unclaimed in its lock-pool.
+func itIsAPoolStore(newStore func() out.PoolStore, source func() out.Source) {
+	Describe("as a pool store", func() {
+		var loaded int64
+
+		claimSomeLock := func(state *out.PoolState) {
+			files := state.Contents()
+			files["lock-pool/claimed/some-lock"] = files["lock-pool/unclaimed/some-lock"]
+			delete(files, "lock-pool/unclaimed/some-lock")
+			state.Commit(files, "claiming: some-lock")
+		}
+
+		BeforeEach(func() {
+			state, err := newStore().Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.Contents()).Should(HaveKey("lock-pool/unclaimed/some-lock"))
+
+			loaded = state.Revision
+		})
+
+		It("saves changes for whoever loads the pool next", func() {
+			store := newStore()
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			claimSomeLock(&state)
+
+			revision, err := store.Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(revision).Should(Equal(loaded + 1))
+
+			reloaded, err := newStore().Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reloaded.Revision).Should(Equal(loaded + 1))
+			Ω(reloaded.Contents()).Should(Equal(state.Contents()))
+			Ω(reloaded.Log).Should(Equal(state.Log))
+		})
+
+		It("goes by what it saved last when saving again", func() {
+			store := newStore()
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			claimSomeLock(&state)
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			files := state.Contents()
+			files["lock-pool/claimed/some-lock"] = `{"renewed":true}`
+			state.Commit(files, "renewing: some-lock")
+
+			revision, err := store.Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(revision).Should(Equal(loaded + 2))
+
+			reloaded, err := newStore().Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reloaded.Contents()).Should(Equal(state.Contents()))
+		})
+
+		It("reports a conflict when someone else changed the same lock in the meantime", func() {
+			stores := []out.PoolStore{newStore(), newStore()}
+
+			var states []out.PoolState
+			for _, store := range stores {
+				state, err := store.Load(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				claimSomeLock(&state)
+				states = append(states, state)
+			}
+
+			_, err := stores[0].Save(context.Background(), states[0])
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = stores[1].Save(context.Background(), states[1])
+			Ω(err).Should(Equal(out.ErrLockConflict))
+
+			reloaded, err := newStore().Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reloaded.Revision).Should(Equal(loaded + 1))
+		})
+
+		It("backs a lock pool that hands out a lock once, and releases it again", func() {
+			newLockPool := func(output *gbytes.Buffer) out.LockPool {
+				return out.LockPool{
+					Source:      source(),
+					Output:      output,
+					LockHandler: out.NewStoreLockHandler(source(), newStore()),
+				}
+			}
+
+			output := gbytes.NewBuffer()
+			lockPool := newLockPool(output)
+			defer lockPool.Close()
+
+			lock, version, err := lockPool.AcquireLock(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(lock).Should(Equal("some-lock"))
+			Ω(version).Should(Equal(out.Version{Ref: strconv.FormatInt(loaded+1, 10)}))
+
+			other := newLockPool(output)
+			defer other.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, _, err = other.AcquireLock(ctx)
+			Ω(err).Should(MatchError(context.DeadlineExceeded))
+
+			lockDir, err := os.MkdirTemp("", "lock-dir")
+			Ω(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(lockDir)
+
+			err = os.WriteFile(filepath.Join(lockDir, "name"), []byte(lock), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, version, err = lockPool.ReleaseLock(context.Background(), lockDir, false)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(version).Should(Equal(out.Version{Ref: strconv.FormatInt(loaded+2, 10)}))
+
+			reloaded, err := newStore().Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(reloaded.Contents()).Should(HaveKey("lock-pool/unclaimed/some-lock"))
+			Ω(reloaded.Contents()).ShouldNot(HaveKey("lock-pool/claimed/some-lock"))
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package out
+
+import (
+	"sort"
+	"time"
+)
+
+// QueueTicket is stored under <pool>/waiting/<id> while a build waits for a
+// lock in a pool with a fair queue. Tickets are served by priority, and in
+// the order they were enqueued within the same priority.
+type QueueTicket struct {
+	ID         string    `json:"-"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Lock       string    `json:"lock,omitempty"`
+	Priority   int       `json:"priority,omitempty"`
+
+	Owner
+}
+
+// NewQueueTicket creates a ticket for a build waiting for the given lock, or
+// for any lock if it is empty. Unless it is refreshed, the ticket goes stale
+// once the timeout has passed.
+func NewQueueTicket(now time.Time, timeout time.Duration, lock string, priority int, owner Owner) QueueTicket {
+	return QueueTicket{
+		ID:         now.UTC().Format("20060102T150405.000000000Z") + "-" + newClaimID(),
+		EnqueuedAt: now.UTC(),
+		ExpiresAt:  now.Add(timeout).UTC(),
+		Lock:       lock,
+		Priority:   priority,
+		Owner:      owner,
+	}
+}
+
+// Stale is true once the build holding the ticket has stopped refreshing it,
+// e.g. because it was aborted.
+func (ticket QueueTicket) Stale(now time.Time) bool {
+	return now.After(ticket.ExpiresAt)
+}
+
+// SortQueue orders tickets by their priority, highest first, and then by
+// when they were enqueued.
+func SortQueue(tickets []QueueTicket) {
+	sort.SliceStable(tickets, func(i, j int) bool {
+		if tickets[i].Priority != tickets[j].Priority {
+			return tickets[i].Priority > tickets[j].Priority
+		}
+
+		if !tickets[i].EnqueuedAt.Equal(tickets[j].EnqueuedAt) {
+			return tickets[i].EnqueuedAt.Before(tickets[j].EnqueuedAt)
+		}
+
+		return tickets[i].ID < tickets[j].ID
+	})
+}
@@ -0,0 +1,65 @@
+package out_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("QueueTicket", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	It("goes stale once its timeout has passed", func() {
+		ticket := out.NewQueueTicket(now, time.Minute, "some-lock", 0, out.Owner{})
+
+		Ω(ticket.Lock).Should(Equal("some-lock"))
+		Ω(ticket.Stale(now.Add(time.Minute))).Should(BeFalse())
+		Ω(ticket.Stale(now.Add(time.Minute + time.Second))).Should(BeTrue())
+	})
+
+	It("has an id that sorts by when it was enqueued", func() {
+		first := out.NewQueueTicket(now, time.Minute, "", 0, out.Owner{})
+		second := out.NewQueueTicket(now.Add(time.Second), time.Minute, "", 0, out.Owner{})
+
+		Ω(first.ID < second.ID).Should(BeTrue())
+	})
+
+	Describe("SortQueue", func() {
+		It("orders tickets by when they were enqueued, then by id", func() {
+			tickets := []out.QueueTicket{
+				{ID: "c", EnqueuedAt: now.Add(time.Second)},
+				{ID: "b", EnqueuedAt: now},
+				{ID: "a", EnqueuedAt: now},
+			}
+
+			out.SortQueue(tickets)
+
+			Ω(tickets[0].ID).Should(Equal("a"))
+			Ω(tickets[1].ID).Should(Equal("b"))
+			Ω(tickets[2].ID).Should(Equal("c"))
+		})
+
+		It("orders tickets with a higher priority first", func() {
+			tickets := []out.QueueTicket{
+				{ID: "a", EnqueuedAt: now},
+				{ID: "b", EnqueuedAt: now.Add(time.Second), Priority: 10},
+				{ID: "c", EnqueuedAt: now.Add(2 * time.Second), Priority: -1},
+				{ID: "d", EnqueuedAt: now.Add(3 * time.Second), Priority: 10},
+			}
+
+			out.SortQueue(tickets)
+
+			Ω(tickets[0].ID).Should(Equal("b"))
+			Ω(tickets[1].ID).Should(Equal("d"))
+			Ω(tickets[2].ID).Should(Equal("a"))
+			Ω(tickets[3].ID).Should(Equal("c"))
+		})
+	})
+})
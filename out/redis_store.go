@@ -0,0 +1,304 @@
+package out
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultRedisKey = "pool-resource"
+
+// RedisSource configures where the redis backend keeps the pool.
+type RedisSource struct {
+	Address  string `json:"address,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	DB       int    `json:"db,omitempty"`
+	TLS      bool   `json:"tls,omitempty"`
+	Key      string `json:"key,omitempty"`
+}
+
+func (r RedisSource) validate() []string {
+	var errorMessages []string
+
+	if r.Address == "" {
+		errorMessages = append(errorMessages, "invalid payload (missing redis.address)")
+	}
+
+	if r.DB < 0 {
+		errorMessages = append(errorMessages, "invalid payload (redis.db must be positive)")
+	}
+
+	return errorMessages
+}
+
+// saveRedisChanges saves changes to a pool, kept in a hash, on top of
+// whatever others saved since it was loaded, as long as none of them changed
+// any of the locks, or the queues, the changes are about. Each change gets
+// the next revision, and stands in the log until historyLimit changes later,
+// when it is forgotten along with the files it removed. Running as a script,
+// redis makes all of it a single step.
+var saveRedisChanges = redis.NewScript(`
+local save = cjson.decode(ARGV[1])
+
+for _, lock in ipairs(save.locks) do
+	local changed = tonumber(redis.call("HGET", KEYS[1], "changed:" .. lock) or "0")
+	if changed > save.loaded then
+		return 0
+	end
+end
+
+local revision = tonumber(redis.call("HGET", KEYS[1], "revision") or "0")
+
+for _, change in ipairs(save.changes) do
+	revision = revision + 1
+
+	local paths = {}
+	for _, file in ipairs(change.files) do
+		local current = redis.call("HGET", KEYS[1], "file:" .. file.path)
+
+		if file.removed then
+			if current then
+				local stored = cjson.decode(current)
+				stored.removed = revision
+				redis.call("HSET", KEYS[1], "removed:" .. file.path, cjson.encode(stored))
+				redis.call("HDEL", KEYS[1], "file:" .. file.path)
+			end
+		else
+			local stored = {added = revision}
+			if current then
+				stored = cjson.decode(current)
+			end
+			stored.contents = file.contents
+			stored.changed = revision
+			redis.call("HSET", KEYS[1], "file:" .. file.path, cjson.encode(stored))
+			redis.call("HDEL", KEYS[1], "removed:" .. file.path)
+		end
+
+		redis.call("HSET", KEYS[1], "changed:" .. file.lock, revision)
+		table.insert(paths, file.path)
+	end
+
+	redis.call("HSET", KEYS[1], "change:" .. revision, cjson.encode({revision = revision, message = change.message, paths = paths}))
+
+	local forgotten = redis.call("HGET", KEYS[1], "change:" .. (revision - save.limit))
+	if forgotten then
+		for _, path in ipairs(cjson.decode(forgotten).paths) do
+			local removed = redis.call("HGET", KEYS[1], "removed:" .. path)
+			if removed and cjson.decode(removed).removed <= revision - save.limit then
+				redis.call("HDEL", KEYS[1], "removed:" .. path)
+			end
+		end
+
+		redis.call("HDEL", KEYS[1], "change:" .. (revision - save.limit))
+	end
+end
+
+redis.call("HSET", KEYS[1], "revision", revision)
+return revision
+`)
+
+// redisChanges are the changes saveRedisChanges saves.
+type redisChanges struct {
+	Loaded  int64         `json:"loaded"`
+	Limit   int           `json:"limit"`
+	Locks   []string      `json:"locks"`
+	Changes []redisChange `json:"changes"`
+}
+
+type redisChange struct {
+	Message string      `json:"message"`
+	Files   []redisFile `json:"files"`
+}
+
+type redisFile struct {
+	Path     string `json:"path"`
+	Lock     string `json:"lock"`
+	Contents string `json:"contents"`
+	Removed  bool   `json:"removed"`
+}
+
+// redisStore keeps the files of the pool, the log of its changes, and its
+// revision in a hash, each in fields of their own. Rather than saving the
+// state as a whole, it saves each change to it, so that claiming, releasing,
+// adding or removing a lock only ever conflicts with changes to that very
+// lock. The revision only ever goes up, so that it doubles as the version of
+// the pool.
+type redisStore struct {
+	client *redis.Client
+	key    string
+
+	// the revision of the pool the state was last in step with
+	revision int64
+
+	// the revision of the last change of the state that was saved
+	saved int64
+}
+
+func newRedisStore(source Source) PoolStore {
+	options := &redis.Options{
+		Addr:     source.Redis.Address,
+		Username: source.Redis.Username,
+		Password: source.Redis.Password,
+		DB:       source.Redis.DB,
+	}
+
+	if source.Redis.TLS {
+		options.TLSConfig = &tls.Config{InsecureSkipVerify: source.SkipSSLVerification}
+	}
+
+	key := source.Redis.Key
+	if key == "" {
+		key = defaultRedisKey
+	}
+
+	return &redisStore{
+		client: redis.NewClient(options),
+		key:    key,
+	}
+}
+
+func (store *redisStore) Load(ctx context.Context) (PoolState, error) {
+	state := PoolState{
+		Files:   map[string]StoredFile{},
+		Removed: map[string]StoredFile{},
+	}
+
+	fields, err := store.client.HGetAll(ctx, store.key).Result()
+	if err != nil {
+		return state, fmt.Errorf("loading %s from redis: %w", store.key, err)
+	}
+
+	for field, value := range fields {
+		kind, name, _ := strings.Cut(field, ":")
+
+		switch kind {
+		case "revision":
+			state.Revision, err = strconv.ParseInt(value, 10, 64)
+		case "file", "removed":
+			var file StoredFile
+			err = json.Unmarshal([]byte(value), &file)
+
+			if kind == "file" {
+				state.Files[name] = file
+			} else {
+				state.Removed[name] = file
+			}
+		case "change":
+			var change Change
+			err = json.Unmarshal([]byte(value), &change)
+			state.Log = append(state.Log, change)
+		}
+
+		if err != nil {
+			return state, fmt.Errorf("reading %s of %s from redis: %w", field, store.key, err)
+		}
+	}
+
+	slices.SortFunc(state.Log, func(a, b Change) int {
+		return cmp.Compare(a.Revision, b.Revision)
+	})
+
+	store.revision = state.Revision
+	store.saved = state.Revision
+
+	return state, nil
+}
+
+func (store *redisStore) Save(ctx context.Context, state PoolState) (int64, error) {
+	// changes the log has forgotten can no longer be saved one by one
+	if state.FirstRevision() > store.saved {
+		return 0, fmt.Errorf("saving %s to redis: more than %d changes to save at once", store.key, historyLimit)
+	}
+
+	changes := redisChanges{Loaded: store.revision, Limit: historyLimit}
+
+	locks := map[string]bool{}
+	for _, change := range state.Log {
+		if change.Revision <= store.saved {
+			continue
+		}
+
+		files := state.At(change.Revision)
+
+		redisChange := redisChange{Message: change.Message}
+		for _, path := range change.Paths {
+			contents, found := files[path]
+
+			redisChange.Files = append(redisChange.Files, redisFile{
+				Path:     path,
+				Lock:     lockOf(path),
+				Contents: contents,
+				Removed:  !found,
+			})
+
+			locks[lockOf(path)] = true
+		}
+
+		changes.Changes = append(changes.Changes, redisChange)
+	}
+
+	if len(changes.Changes) == 0 {
+		return state.Revision, nil
+	}
+
+	changes.Locks = slices.Sorted(maps.Keys(locks))
+
+	contents, err := json.Marshal(changes)
+	if err != nil {
+		return 0, err
+	}
+
+	revision, err := saveRedisChanges.Run(ctx, store.client, []string{store.key}, contents).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("saving %s to redis: %w", store.key, err)
+	}
+
+	if revision == 0 {
+		return 0, ErrLockConflict
+	}
+
+	// the state is only in step with the pool if nobody else saved changes
+	// in between, otherwise the locks it changed are taken to have changed
+	// since, until it is loaded again
+	if revision == state.Revision {
+		store.revision = revision
+	}
+
+	store.saved = state.Revision
+
+	return revision, nil
+}
+
+// lockOf returns what a path of a pool is about, as far as conflicts go:
+// one of its locks, with its claims and the like, or its queue. Pools may
+// be nested, e.g. envs/aws, so the path is read from its end: either
+// <pool>/claims/<lock>/<claim>, or <pool>/<dir>/<lock>.
+func lockOf(path string) string {
+	parts := strings.Split(path, "/")
+
+	if len(parts) >= 4 && parts[len(parts)-3] == "claims" {
+		return "lock:" + strings.Join(parts[:len(parts)-3], "/") + "/" + parts[len(parts)-2]
+	}
+
+	if len(parts) >= 3 {
+		pool := strings.Join(parts[:len(parts)-2], "/")
+
+		switch parts[len(parts)-2] {
+		case "waiting":
+			return "queue:" + pool
+		case "claimed", "unclaimed", "shared", "capacity":
+			return "lock:" + pool + "/" + parts[len(parts)-1]
+		}
+	}
+
+	return "file:" + path
+}
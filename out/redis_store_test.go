@@ -0,0 +1,288 @@
+package out_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Redis store", func() {
+	var (
+		fakeRedis *miniredis.Miniredis
+		source    out.Source
+	)
+
+	BeforeEach(func() {
+		var err error
+		fakeRedis, err = miniredis.Run()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		source = out.Source{
+			Backend: "redis",
+			Redis: out.RedisSource{
+				Address: fakeRedis.Addr(),
+				Key:     "some-pools",
+			},
+			Pool:       "lock-pool",
+			RetryDelay: 10 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		fakeRedis.Close()
+	})
+
+	claimSomeLock := func(state *out.PoolState) {
+		files := state.Contents()
+		files["lock-pool/claimed/some-lock"] = "{}\n"
+		delete(files, "lock-pool/unclaimed/some-lock")
+		state.Commit(files, "claiming: some-lock")
+	}
+
+	savedState := func() out.PoolState {
+		state, err := out.NewPoolStore(source).Load(context.Background())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return state
+	}
+
+	Context("when there is no pool yet", func() {
+		It("loads an empty pool, and creates it on saving", func() {
+			store := out.NewPoolStore(source)
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.Revision).Should(BeZero())
+			Ω(state.Files).Should(BeEmpty())
+
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			revision, err := store.Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(revision).Should(Equal(int64(1)))
+
+			Ω(fakeRedis.HGet("some-pools", "revision")).Should(Equal("1"))
+			Ω(savedState().Contents()).Should(Equal(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}))
+		})
+	})
+
+	Context("when the pool is in redis", func() {
+		BeforeEach(func() {
+			var state out.PoolState
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			_, err := out.NewPoolStore(source).Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("reports a conflict when the lock changed after the revision that was loaded", func() {
+			store := out.NewPoolStore(source)
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			claimSomeLock(&state)
+
+			fakeRedis.HSet("some-pools", "changed:lock:lock-pool/some-lock", "2")
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).Should(Equal(out.ErrLockConflict))
+
+			Ω(fakeRedis.HGet("some-pools", "revision")).Should(Equal("1"))
+		})
+
+		It("saves the changes on top of changes to other locks in the meantime", func() {
+			stores := []out.PoolStore{out.NewPoolStore(source), out.NewPoolStore(source)}
+
+			var states []out.PoolState
+			for _, store := range stores {
+				state, err := store.Load(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				states = append(states, state)
+			}
+
+			claimSomeLock(&states[0])
+
+			files := states[1].Contents()
+			files["lock-pool/unclaimed/some-other-lock"] = "{}\n"
+			states[1].Commit(files, "adding some-other-lock")
+
+			_, err := stores[0].Save(context.Background(), states[0])
+			Ω(err).ShouldNot(HaveOccurred())
+
+			revision, err := stores[1].Save(context.Background(), states[1])
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(revision).Should(Equal(int64(3)))
+
+			saved := savedState()
+			Ω(saved.Contents()).Should(Equal(map[string]string{
+				"lock-pool/claimed/some-lock":         "{}\n",
+				"lock-pool/unclaimed/some-other-lock": "{}\n",
+			}))
+			Ω(saved.Log).Should(HaveLen(3))
+			Ω(saved.Log[2]).Should(Equal(out.Change{
+				Revision: 3,
+				Message:  "adding some-other-lock",
+				Paths:    []string{"lock-pool/unclaimed/some-other-lock"},
+			}))
+
+			// until it is loaded again, the state is behind on what it saved
+			files = states[1].Contents()
+			files["lock-pool/unclaimed/some-other-lock"] = `{"updated":true}`
+			states[1].Commit(files, "updating some-other-lock")
+
+			_, err = stores[1].Save(context.Background(), states[1])
+			Ω(err).Should(Equal(out.ErrLockConflict))
+		})
+
+		Context("when the pool is nested in another directory", func() {
+			BeforeEach(func() {
+				store := out.NewPoolStore(source)
+
+				state, err := store.Load(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				files := state.Contents()
+				files["envs/aws/claimed/some-lock"] = "{}\n"
+				files["envs/aws/capacity/some-lock"] = "1\n"
+				state.Commit(files, "adding some-lock to envs/aws")
+
+				_, err = store.Save(context.Background(), state)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports a conflict when two builds take the last slot of the same lock at once", func() {
+				stores := []out.PoolStore{out.NewPoolStore(source), out.NewPoolStore(source)}
+
+				var states []out.PoolState
+				for i, store := range stores {
+					state, err := store.Load(context.Background())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					files := state.Contents()
+					files[fmt.Sprintf("envs/aws/claims/some-lock/claim-%d", i)] = "{}\n"
+					state.Commit(files, "claiming: some-lock")
+
+					states = append(states, state)
+				}
+
+				_, err := stores[0].Save(context.Background(), states[0])
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = stores[1].Save(context.Background(), states[1])
+				Ω(err).Should(Equal(out.ErrLockConflict))
+
+				Ω(savedState().Contents()).ShouldNot(HaveKey("envs/aws/claims/some-lock/claim-1"))
+			})
+
+			It("reports a conflict between a shared claim and an exclusive one on the same lock", func() {
+				stores := []out.PoolStore{out.NewPoolStore(source), out.NewPoolStore(source)}
+
+				var states []out.PoolState
+				for _, store := range stores {
+					state, err := store.Load(context.Background())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					states = append(states, state)
+				}
+
+				files := states[0].Contents()
+				files["envs/aws/shared/some-lock"] = ""
+				states[0].Commit(files, "claiming: some-lock (shared)")
+
+				files = states[1].Contents()
+				files["envs/aws/claims/some-lock/some-claim"] = `{"exclusive":true}`
+				states[1].Commit(files, "claiming: some-lock (exclusive)")
+
+				_, err := stores[0].Save(context.Background(), states[0])
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = stores[1].Save(context.Background(), states[1])
+				Ω(err).Should(Equal(out.ErrLockConflict))
+			})
+		})
+
+		It("forgets the oldest changes, and the files they removed", func() {
+			store := out.NewPoolStore(source)
+
+			for i := range 1010 {
+				state, err := store.Load(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				files := state.Contents()
+				files[fmt.Sprintf("lock-pool/waiting/ticket-%d", i)] = "{}\n"
+				delete(files, fmt.Sprintf("lock-pool/waiting/ticket-%d", i-1))
+				state.Commit(files, "queueing")
+
+				_, err = store.Save(context.Background(), state)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			saved := savedState()
+			Ω(saved.Revision).Should(Equal(int64(1011)))
+			Ω(saved.Log).Should(HaveLen(1000))
+			Ω(saved.FirstRevision()).Should(Equal(int64(11)))
+			Ω(saved.Removed).Should(HaveLen(1000))
+			Ω(saved.Removed).ShouldNot(HaveKey("lock-pool/waiting/ticket-8"))
+			Ω(saved.Removed).Should(HaveKey("lock-pool/waiting/ticket-9"))
+		})
+
+		It("fails when redis cannot be reached", func() {
+			fakeRedis.Close()
+
+			_, err := out.NewPoolStore(source).Load(context.Background())
+			Ω(err).Should(MatchError(ContainSubstring("loading some-pools from redis")))
+		})
+
+		itIsAPoolStore(
+			func() out.PoolStore { return out.NewPoolStore(source) },
+			func() out.Source { return source },
+		)
+
+		Describe("backing a lock pool", func() {
+			It("returns the revision a claim was saved as on top of changes to other locks", func() {
+				handler := out.NewStoreLockHandler(source, out.NewPoolStore(source))
+				defer handler.Cleanup()
+
+				err := handler.Setup(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = handler.ResetLock(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ref, err := handler.ClaimLock("some-lock", "")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ref).Should(Equal("2"))
+
+				adder := out.NewPoolStore(source)
+				state, err := adder.Load(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				files := state.Contents()
+				files["lock-pool/unclaimed/some-other-lock"] = "{}\n"
+				state.Commit(files, "adding some-other-lock")
+
+				_, err = adder.Save(context.Background(), state)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = handler.BroadcastLockPool(context.Background())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				version, err := handler.PushedVersion(ref)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(version).Should(Equal("3"))
+
+				claimed, found := savedState().ChangeAt(3)
+				Ω(found).Should(BeTrue())
+				Ω(claimed.Paths).Should(ContainElement("lock-pool/claimed/some-lock"))
+			})
+		})
+	})
+})
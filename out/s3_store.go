@@ -0,0 +1,213 @@
+package out
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	defaultS3Key    = "pool-resource.json"
+	defaultS3Region = "us-east-1"
+)
+
+// S3Source configures where the s3 backend keeps the pool.
+type S3Source struct {
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+
+	RegionName   string `json:"region_name,omitempty" mapstructure:"region_name"`
+	Endpoint     string `json:"endpoint,omitempty"`
+	UsePathStyle bool   `json:"use_path_style,omitempty" mapstructure:"use_path_style"`
+
+	// the credentials of the worker are used if none are given
+	AccessKeyID     string `json:"access_key_id,omitempty" mapstructure:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key,omitempty" mapstructure:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty" mapstructure:"session_token"`
+}
+
+func (s S3Source) validate() []string {
+	var errorMessages []string
+
+	if s.Bucket == "" {
+		errorMessages = append(errorMessages, "invalid payload (missing s3.bucket)")
+	}
+
+	if (s.AccessKeyID == "") != (s.SecretAccessKey == "") {
+		errorMessages = append(errorMessages, "invalid payload (s3.access_key_id and s3.secret_access_key must be given together)")
+	}
+
+	return errorMessages
+}
+
+// s3Store keeps the whole state of the pool in a single object, so that
+// claiming locks from several pools at once is a single write. Saving only
+// replaces the object if its ETag is still the one that was loaded, which
+// stands in for a push being rejected.
+//
+// Like the pools of a repository, every pool kept under the same key shares
+// that object, and so competes for its ETag with the others even when
+// changing only its own locks. An object per pool would take away the
+// conflicts, but not the atomic claims across pools, as S3 has no writes
+// conditional on several objects. Pools that are never acquired together can
+// be given keys of their own instead.
+type s3Store struct {
+	source Source
+	client *s3.Client
+
+	// the ETag of the object last loaded or saved, or nil if there was none
+	etag *string
+}
+
+func newS3Store(source Source) PoolStore {
+	return &s3Store{source: source}
+}
+
+func (store *s3Store) Load(ctx context.Context) (PoolState, error) {
+	var state PoolState
+
+	client, err := store.connect(ctx)
+	if err != nil {
+		return state, err
+	}
+
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.source.S3.Bucket),
+		Key:    aws.String(store.key()),
+	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		// the pool is empty until it is first changed
+		store.etag = nil
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("loading s3://%s/%s: %w", store.source.S3.Bucket, store.key(), err)
+	}
+	defer object.Body.Close()
+
+	err = json.NewDecoder(object.Body).Decode(&state)
+	if err != nil {
+		return state, fmt.Errorf("reading s3://%s/%s: %w", store.source.S3.Bucket, store.key(), err)
+	}
+
+	store.etag = object.ETag
+
+	return state, nil
+}
+
+func (store *s3Store) Save(ctx context.Context, state PoolState) (int64, error) {
+	client, err := store.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(store.source.S3.Bucket),
+		Key:         aws.String(store.key()),
+		Body:        bytes.NewReader(contents),
+		ContentType: aws.String("application/json"),
+	}
+
+	if store.etag != nil {
+		input.IfMatch = store.etag
+	} else {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	output, err := client.PutObject(ctx, input)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.ErrorCode() {
+			case "PreconditionFailed", "ConditionalRequestConflict":
+				return 0, ErrLockConflict
+			}
+		}
+
+		return 0, fmt.Errorf("saving s3://%s/%s: %w", store.source.S3.Bucket, store.key(), err)
+	}
+
+	store.etag = output.ETag
+
+	return state.Revision, nil
+}
+
+func (store *s3Store) key() string {
+	if store.source.S3.Key == "" {
+		return defaultS3Key
+	}
+
+	return store.source.S3.Key
+}
+
+// connect creates the client the first time it is needed, as loading the
+// configuration of the worker, e.g. its credentials, may fail.
+func (store *s3Store) connect(ctx context.Context) (*s3.Client, error) {
+	if store.client != nil {
+		return store.client, nil
+	}
+
+	s3Source := store.source.S3
+
+	region := s3Source.RegionName
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+	}
+
+	if s3Source.AccessKeyID != "" {
+		options = append(options, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			s3Source.AccessKeyID,
+			s3Source.SecretAccessKey,
+			s3Source.SessionToken,
+		)))
+	}
+
+	if store.source.SkipSSLVerification {
+		options = append(options, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(transport *http.Transport) {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		})))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	store.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if s3Source.Endpoint != "" {
+			o.BaseEndpoint = aws.String(s3Source.Endpoint)
+		}
+
+		o.UsePathStyle = s3Source.UsePathStyle
+
+		// S3-compatible stores do not all support the checksums the SDK
+		// sends by default
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	})
+
+	return store.client, nil
+}
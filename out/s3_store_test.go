@@ -0,0 +1,130 @@
+package out_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+	"github.com/concourse/pool-resource/out/fakes3"
+)
+
+var _ = Describe("S3 store", func() {
+	var (
+		fakeS3 *fakes3.Server
+		source out.Source
+	)
+
+	BeforeEach(func() {
+		fakeS3 = fakes3.New()
+
+		source = out.Source{
+			Backend: "s3",
+			S3: out.S3Source{
+				Bucket:          "some-bucket",
+				Key:             "some/pools.json",
+				Endpoint:        fakeS3.URL,
+				UsePathStyle:    true,
+				AccessKeyID:     "some-access-key-id",
+				SecretAccessKey: "some-secret-access-key",
+			},
+			Pool:       "lock-pool",
+			RetryDelay: 10 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		fakeS3.Close()
+	})
+
+	claimSomeLock := func(state *out.PoolState) {
+		files := state.Contents()
+		files["lock-pool/claimed/some-lock"] = "{}\n"
+		delete(files, "lock-pool/unclaimed/some-lock")
+		state.Commit(files, "claiming: some-lock")
+	}
+
+	Context("when there is no object yet", func() {
+		It("loads an empty pool, and creates the object on saving", func() {
+			store := out.NewPoolStore(source)
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(state.Revision).Should(BeZero())
+			Ω(state.Files).Should(BeEmpty())
+
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			contents, found := fakeS3.Object("some-bucket", "some/pools.json")
+			Ω(found).Should(BeTrue())
+
+			var saved out.PoolState
+			err = json.Unmarshal(contents, &saved)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(saved.Revision).Should(Equal(int64(1)))
+			Ω(saved.Contents()).Should(Equal(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}))
+		})
+
+		It("reports a conflict if someone else created it in the meantime", func() {
+			store := out.NewPoolStore(source)
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeS3.PutObject("some-bucket", "some/pools.json", []byte(`{"Revision": 1}`))
+
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).Should(Equal(out.ErrLockConflict))
+		})
+	})
+
+	Context("when the pool is in the bucket", func() {
+		BeforeEach(func() {
+			var state out.PoolState
+			state.Commit(map[string]string{"lock-pool/unclaimed/some-lock": "{}\n"}, "adding some-lock")
+
+			contents, err := json.Marshal(state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeS3.PutObject("some-bucket", "some/pools.json", contents)
+		})
+
+		It("reports a conflict when the object changed since it was loaded, as its ETag no longer matches", func() {
+			store := out.NewPoolStore(source)
+
+			state, err := store.Load(context.Background())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			claimSomeLock(&state)
+
+			// someone else made the very same change
+			contents, err := json.Marshal(state)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeS3.PutObject("some-bucket", "some/pools.json", contents)
+
+			_, err = store.Save(context.Background(), state)
+			Ω(err).Should(Equal(out.ErrLockConflict))
+		})
+
+		It("fails when the object is not a pool", func() {
+			fakeS3.PutObject("some-bucket", "some/pools.json", []byte("bogus"))
+
+			_, err := out.NewPoolStore(source).Load(context.Background())
+			Ω(err).Should(MatchError(ContainSubstring("reading s3://some-bucket/some/pools.json")))
+		})
+
+		itIsAPoolStore(
+			func() out.PoolStore { return out.NewPoolStore(source) },
+			func() out.Source { return source },
+		)
+	})
+})
@@ -0,0 +1,98 @@
+package out
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// ClaimHistory returns the names of the locks in a pool that have been
+// claimed before, most recently claimed first.
+type ClaimHistory func() ([]string, error)
+
+// SelectionStrategy decides which of the available locks are claimed first.
+type SelectionStrategy interface {
+	Order(candidates []string, history ClaimHistory) ([]string, error)
+}
+
+var selectionStrategies = map[string]SelectionStrategy{
+	"random":              RandomSelection{},
+	"alphabetical":        AlphabeticalSelection{},
+	"least_recently_used": LeastRecentlyUsedSelection{},
+	"round_robin":         RoundRobinSelection{},
+}
+
+// SelectionStrategyNamed returns the strategy configured as the
+// selection_strategy of a source, which is random if none is configured.
+func SelectionStrategyNamed(name string) (SelectionStrategy, bool) {
+	if name == "" {
+		return RandomSelection{}, true
+	}
+
+	strategy, found := selectionStrategies[name]
+	return strategy, found
+}
+
+// RandomSelection picks any of the available locks.
+type RandomSelection struct{}
+
+func (RandomSelection) Order(candidates []string, history ClaimHistory) ([]string, error) {
+	ordered := slices.Clone(candidates)
+	rand.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	return ordered, nil
+}
+
+// AlphabeticalSelection picks the available lock whose name sorts first.
+type AlphabeticalSelection struct{}
+
+func (AlphabeticalSelection) Order(candidates []string, history ClaimHistory) ([]string, error) {
+	ordered := slices.Clone(candidates)
+	sort.Strings(ordered)
+	return ordered, nil
+}
+
+// LeastRecentlyUsedSelection picks the available lock that was claimed the
+// longest ago, or one that was never claimed at all.
+type LeastRecentlyUsedSelection struct{}
+
+func (LeastRecentlyUsedSelection) Order(candidates []string, history ClaimHistory) ([]string, error) {
+	claimed, err := history()
+	if err != nil {
+		return nil, err
+	}
+
+	recency := map[string]int{}
+	for i, name := range claimed {
+		recency[name] = len(claimed) - i
+	}
+
+	ordered := slices.Clone(candidates)
+	sort.Strings(ordered)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return recency[ordered[i]] < recency[ordered[j]]
+	})
+
+	return ordered, nil
+}
+
+// RoundRobinSelection picks the available lock whose name sorts right after
+// the lock that was claimed last, going back to the start once it reaches
+// the end.
+type RoundRobinSelection struct{}
+
+func (RoundRobinSelection) Order(candidates []string, history ClaimHistory) ([]string, error) {
+	claimed, err := history()
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := slices.Clone(candidates)
+	sort.Strings(ordered)
+
+	if len(claimed) == 0 {
+		return ordered, nil
+	}
+
+	next, _ := slices.BinarySearch(ordered, claimed[0]+"\x00")
+	return slices.Concat(ordered[next:], ordered[:next]), nil
+}
@@ -0,0 +1,136 @@
+package out_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("SelectionStrategy", func() {
+	var candidates []string
+	var claimed []string
+	var historyErr error
+	var historyCalls int
+
+	history := func() ([]string, error) {
+		historyCalls++
+		return claimed, historyErr
+	}
+
+	BeforeEach(func() {
+		candidates = []string{"env-c", "env-a", "env-d", "env-b"}
+		claimed = nil
+		historyErr = nil
+		historyCalls = 0
+	})
+
+	Describe("SelectionStrategyNamed", func() {
+		It("is random by default", func() {
+			strategy, found := out.SelectionStrategyNamed("")
+			Ω(found).Should(BeTrue())
+			Ω(strategy).Should(Equal(out.RandomSelection{}))
+		})
+
+		It("finds every strategy by name", func() {
+			for name, expected := range map[string]out.SelectionStrategy{
+				"random":              out.RandomSelection{},
+				"alphabetical":        out.AlphabeticalSelection{},
+				"least_recently_used": out.LeastRecentlyUsedSelection{},
+				"round_robin":         out.RoundRobinSelection{},
+			} {
+				strategy, found := out.SelectionStrategyNamed(name)
+				Ω(found).Should(BeTrue())
+				Ω(strategy).Should(Equal(expected))
+			}
+		})
+
+		It("does not find unknown strategies", func() {
+			_, found := out.SelectionStrategyNamed("best_fit")
+			Ω(found).Should(BeFalse())
+		})
+	})
+
+	Describe("RandomSelection", func() {
+		It("orders all of the candidates without looking at the history", func() {
+			ordered, err := out.RandomSelection{}.Order(candidates, history)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(ordered).Should(ConsistOf("env-a", "env-b", "env-c", "env-d"))
+			Ω(historyCalls).Should(Equal(0))
+		})
+	})
+
+	Describe("AlphabeticalSelection", func() {
+		It("orders the candidates by name", func() {
+			ordered, err := out.AlphabeticalSelection{}.Order(candidates, history)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(ordered).Should(Equal([]string{"env-a", "env-b", "env-c", "env-d"}))
+			Ω(candidates).Should(Equal([]string{"env-c", "env-a", "env-d", "env-b"}))
+		})
+	})
+
+	Describe("LeastRecentlyUsedSelection", func() {
+		BeforeEach(func() {
+			claimed = []string{"env-a", "env-x", "env-c", "env-b"}
+		})
+
+		It("orders never claimed candidates first, then the ones claimed longest ago", func() {
+			ordered, err := out.LeastRecentlyUsedSelection{}.Order(candidates, history)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(ordered).Should(Equal([]string{"env-d", "env-b", "env-c", "env-a"}))
+		})
+
+		Context("when the history cannot be read", func() {
+			BeforeEach(func() {
+				historyErr = errors.New("disaster")
+			})
+
+			It("returns an error", func() {
+				_, err := out.LeastRecentlyUsedSelection{}.Order(candidates, history)
+				Ω(err).Should(MatchError("disaster"))
+			})
+		})
+	})
+
+	Describe("RoundRobinSelection", func() {
+		Context("when no lock has been claimed yet", func() {
+			It("starts from the first lock by name", func() {
+				ordered, err := out.RoundRobinSelection{}.Order(candidates, history)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(ordered).Should(Equal([]string{"env-a", "env-b", "env-c", "env-d"}))
+			})
+		})
+
+		Context("when a lock has been claimed last", func() {
+			BeforeEach(func() {
+				claimed = []string{"env-b", "env-a"}
+			})
+
+			It("continues from the lock after it, wrapping around", func() {
+				ordered, err := out.RoundRobinSelection{}.Order(candidates, history)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(ordered).Should(Equal([]string{"env-c", "env-d", "env-a", "env-b"}))
+			})
+		})
+
+		Context("when the lock claimed last is no longer a candidate", func() {
+			BeforeEach(func() {
+				claimed = []string{"env-bb"}
+			})
+
+			It("continues from the lock that sorts after it", func() {
+				ordered, err := out.RoundRobinSelection{}.Order(candidates, history)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(ordered).Should(Equal([]string{"env-c", "env-d", "env-a", "env-b"}))
+			})
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package out
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Selector picks locks by the JSON or YAML metadata in their lock file. Each
+// key must be satisfied by the metadata:
+//
+//	region: us-east-1         # equal to the value
+//	size: [small, medium]     # equal to one of the values
+//	gpu: {exists: true}       # present (or absent, with false)
+type Selector map[string]any
+
+func (selector Selector) Validate() []string {
+	var errorMessages []string
+
+	keys := make([]string, 0, len(selector))
+	for key := range selector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		requirement, isMap := selector[key].(map[string]any)
+		if !isMap {
+			continue
+		}
+
+		_, isBool := requirement["exists"].(bool)
+		if len(requirement) != 1 || !isBool {
+			errorMessages = append(errorMessages, fmt.Sprintf("invalid payload (match on %s must be a value, a list of values, or {exists: true|false})", key))
+		}
+	}
+
+	return errorMessages
+}
+
+func (selector Selector) String() string {
+	payload, err := json.Marshal(map[string]any(selector))
+	if err != nil {
+		return fmt.Sprint(map[string]any(selector))
+	}
+
+	return string(payload)
+}
+
+// Matches is true if the metadata of a lock satisfies every key of the
+// selector. Metadata that is not a JSON or YAML object matches only an empty
+// selector.
+func (selector Selector) Matches(metadata []byte) bool {
+	if len(selector) == 0 {
+		return true
+	}
+
+	var fields map[string]any
+	err := yaml.Unmarshal(metadata, &fields)
+	if err != nil {
+		return false
+	}
+
+	for key, requirement := range selector {
+		value, present := fields[key]
+
+		switch requirement := requirement.(type) {
+		case map[string]any:
+			if present != requirement["exists"] {
+				return false
+			}
+		case []any:
+			if !present || !slices.ContainsFunc(requirement, func(candidate any) bool {
+				return sameValue(candidate, value)
+			}) {
+				return false
+			}
+		default:
+			if !present || !sameValue(requirement, value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sameValue compares the values of the selector, which come from JSON, with
+// those of the metadata, which may have been parsed as YAML, by how they are
+// written rather than by their type.
+func sameValue(a any, b any) bool {
+	return written(a) == written(b)
+}
+
+func written(value any) string {
+	// JSON numbers are all floats, whereas YAML keeps whole numbers as ints
+	number, isFloat := value.(float64)
+	if isFloat && number == math.Trunc(number) && math.Abs(number) < 1e15 {
+		return strconv.FormatInt(int64(number), 10)
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,104 @@
+package out_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/pool-resource/out"
+)
+
+var _ = Describe("Selector", func() {
+	var selector out.Selector
+
+	parse := func(payload string) out.Selector {
+		var parsed out.Selector
+		err := json.Unmarshal([]byte(payload), &parsed)
+		Ω(err).ShouldNot(HaveOccurred())
+		return parsed
+	}
+
+	Describe("Matches", func() {
+		Context("when the selector is empty", func() {
+			It("matches any lock", func() {
+				Ω(selector.Matches([]byte("not metadata at all"))).Should(BeTrue())
+			})
+		})
+
+		Context("when a key must equal a value", func() {
+			BeforeEach(func() {
+				selector = parse(`{"region": "us-east-1", "nodes": 3}`)
+			})
+
+			It("matches JSON metadata with that value", func() {
+				Ω(selector.Matches([]byte(`{"region": "us-east-1", "nodes": 3, "size": "large"}`))).Should(BeTrue())
+			})
+
+			It("matches YAML metadata with that value", func() {
+				Ω(selector.Matches([]byte("region: us-east-1\nnodes: 3\n"))).Should(BeTrue())
+			})
+
+			It("does not match metadata with another value", func() {
+				Ω(selector.Matches([]byte(`{"region": "eu-west-1", "nodes": 3}`))).Should(BeFalse())
+			})
+
+			It("does not match metadata without the key", func() {
+				Ω(selector.Matches([]byte(`{"nodes": 3}`))).Should(BeFalse())
+			})
+
+			It("does not match metadata that is not an object", func() {
+				Ω(selector.Matches([]byte("just some text"))).Should(BeFalse())
+			})
+		})
+
+		Context("when a key must be one of several values", func() {
+			BeforeEach(func() {
+				selector = parse(`{"k8s_version": ["1.29", "1.30"]}`)
+			})
+
+			It("matches metadata with any of them", func() {
+				Ω(selector.Matches([]byte(`{"k8s_version": "1.30"}`))).Should(BeTrue())
+				Ω(selector.Matches([]byte("k8s_version: 1.29"))).Should(BeTrue())
+			})
+
+			It("does not match metadata with none of them", func() {
+				Ω(selector.Matches([]byte(`{"k8s_version": "1.28"}`))).Should(BeFalse())
+			})
+		})
+
+		Context("when a key must exist", func() {
+			BeforeEach(func() {
+				selector = parse(`{"gpu": {"exists": true}}`)
+			})
+
+			It("matches metadata with the key, whatever its value", func() {
+				Ω(selector.Matches([]byte(`{"gpu": false}`))).Should(BeTrue())
+				Ω(selector.Matches([]byte(`{"region": "us-east-1"}`))).Should(BeFalse())
+			})
+		})
+
+		Context("when a key must not exist", func() {
+			BeforeEach(func() {
+				selector = parse(`{"gpu": {"exists": false}}`)
+			})
+
+			It("only matches metadata without the key", func() {
+				Ω(selector.Matches([]byte(`{"region": "us-east-1"}`))).Should(BeTrue())
+				Ω(selector.Matches([]byte(`{"gpu": "a100"}`))).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("Validate", func() {
+		It("accepts values, lists of values and exists", func() {
+			selector = parse(`{"region": "us-east-1", "size": ["small", "medium"], "gpu": {"exists": true}}`)
+			Ω(selector.Validate()).Should(BeEmpty())
+		})
+
+		It("rejects any other object", func() {
+			selector = parse(`{"region": {"equals": "us-east-1"}}`)
+			Ω(selector.Validate()).Should(ConsistOf("invalid payload (match on region must be a value, a list of values, or {exists: true|false})"))
+		})
+	})
+})
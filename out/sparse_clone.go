@@ -0,0 +1,14 @@
+package out
+
+// SparseCloneArgs are the arguments git clone is given for a source with
+// sparse_clone set: a partial clone, which only fetches the contents of files
+// once they are checked out, with a sparse checkout of the files at the root
+// of the repository. Pools are then added to the sparse checkout as they are
+// needed.
+func SparseCloneArgs(source Source) []string {
+	if !source.SparseClone {
+		return nil
+	}
+
+	return []string{"--filter=blob:none", "--sparse"}
+}
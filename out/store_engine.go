@@ -0,0 +1,256 @@
+package out
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// storeEngine works with a pool kept in a PoolStore as if it were a clone of
+// a repository. The files of the pool are written to a directory for the
+// GitLockHandler to change, committing compares the directory with the state
+// of the pool, and pushing saves the state.
+type storeEngine struct {
+	store PoolStore
+	dir   string
+	pools []string
+
+	state   PoolState
+	unsaved bool
+
+	// the revision the state was loaded at, and how much later than they
+	// were made the changes made since were saved, as some stores save them
+	// on top of those others saved in the meantime
+	loaded  int64
+	rebased int64
+}
+
+func newStoreEngine(store PoolStore, pool string) gitEngine {
+	return &storeEngine{store: store, pools: []string{pool}}
+}
+
+func (engine *storeEngine) Clone(ctx context.Context, dir string) error {
+	engine.dir = dir
+
+	return engine.Reset(ctx)
+}
+
+// Open fails, as there is no clone of a pool kept outside of git to reuse.
+func (engine *storeEngine) Open(dir string) error {
+	return errors.New("pools kept outside of git are not cached")
+}
+
+// Include makes sure the pools have the directories locks are moved between,
+// as a store has no empty directories to keep, like git, but no .gitkeep
+// files to keep them with either.
+func (engine *storeEngine) Include(dirs ...string) error {
+	for _, dir := range dirs {
+		if !slices.Contains(engine.pools, dir) {
+			engine.pools = append(engine.pools, dir)
+		}
+	}
+
+	return engine.makePoolDirs()
+}
+
+// Reset loads the latest state of the pool, and writes its files to the
+// directory in place of whatever was there.
+func (engine *storeEngine) Reset(ctx context.Context) error {
+	state, err := engine.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(engine.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := os.RemoveAll(filepath.Join(engine.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	for path, file := range state.Files {
+		fullPath := filepath.Join(engine.dir, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(fullPath, []byte(file.Contents), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	engine.state = state
+	engine.unsaved = false
+	engine.loaded = state.Revision
+	engine.rebased = 0
+
+	return engine.makePoolDirs()
+}
+
+func (engine *storeEngine) makePoolDirs() error {
+	for _, pool := range engine.pools {
+		for _, dir := range []string{"claimed", "unclaimed"} {
+			err := os.MkdirAll(filepath.Join(engine.dir, pool, dir), 0755)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Pull catches up with the pool. Nothing is ever committed without saving
+// it in between, so there is nothing to merge.
+func (engine *storeEngine) Pull() error {
+	return engine.Reset(context.Background())
+}
+
+// Add does nothing, as committing picks up every file in the directory.
+func (engine *storeEngine) Add(path string) error {
+	return nil
+}
+
+func (engine *storeEngine) Move(from string, to string) error {
+	to = engine.path(to)
+
+	err := os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(engine.path(from), to)
+}
+
+func (engine *storeEngine) Remove(path string) error {
+	return os.Remove(engine.path(path))
+}
+
+func (engine *storeEngine) RemoveIfPresent(path string) error {
+	return os.RemoveAll(engine.path(path))
+}
+
+func (engine *storeEngine) Commit(message string) (string, error) {
+	files, err := readFiles(engine.dir, "")
+	if err != nil {
+		return "", err
+	}
+
+	if !engine.state.Commit(files, message) {
+		return "", errors.New("nothing to commit")
+	}
+
+	engine.unsaved = true
+
+	return engine.Head()
+}
+
+func (engine *storeEngine) Head() (string, error) {
+	return strconv.FormatInt(engine.state.Revision, 10), nil
+}
+
+func (engine *storeEngine) ChangedSince(ref string, path string) (bool, error) {
+	revision, err := ParseRevision(ref)
+	if err != nil {
+		return false, err
+	}
+
+	relativePath, err := engine.relative(path)
+	if err != nil {
+		return false, err
+	}
+
+	return engine.state.ChangedSince(revision, relativePath), nil
+}
+
+func (engine *storeEngine) FilesAt(ref string, dir string) ([]string, error) {
+	revision, err := ParseRevision(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	relativeDir, err := engine.relative(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.state.FilesAt(revision, relativeDir), nil
+}
+
+func (engine *storeEngine) AddedFiles(dirs ...string) ([]string, error) {
+	var relativeDirs []string
+	for _, dir := range dirs {
+		relativeDir, err := engine.relative(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		relativeDirs = append(relativeDirs, relativeDir)
+	}
+
+	return engine.state.AddedFiles(relativeDirs...), nil
+}
+
+// Push saves the state of the pool. Like pushing to git, saving nothing is
+// taken for someone else having made the very same change first.
+func (engine *storeEngine) Push(ctx context.Context) (string, error) {
+	if !engine.unsaved {
+		return "nothing to save", ErrLockConflict
+	}
+
+	revision, err := engine.store.Save(ctx, engine.state)
+	if err != nil {
+		return "", err
+	}
+
+	engine.unsaved = false
+	engine.rebased = revision - engine.state.Revision
+
+	return fmt.Sprintf("saved revision %d", revision), nil
+}
+
+// Pushed returns the revision a change made since the state was loaded was
+// saved as.
+func (engine *storeEngine) Pushed(ref string) (string, error) {
+	revision, err := ParseRevision(ref)
+	if err != nil {
+		return "", err
+	}
+
+	if revision <= engine.loaded {
+		return ref, nil
+	}
+
+	return strconv.FormatInt(revision+engine.rebased, 10), nil
+}
+
+// path returns the path of a file within the directory, given either
+// relative to it, or as an absolute path within it.
+func (engine *storeEngine) path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(engine.dir, path)
+}
+
+func (engine *storeEngine) relative(path string) (string, error) {
+	relativePath, err := filepath.Rel(engine.dir, engine.path(path))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(relativePath), nil
+}
@@ -0,0 +1,46 @@
+package out
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrTimedOut = errors.New("timed out")
+
+// Holder is a build holding a claimed lock, as far as its claim records tell.
+// Locks claimed without a claim record have a holder with an empty Owner.
+type Holder struct {
+	Pool string
+	Lock string
+
+	Owner
+}
+
+// TimeoutError is returned when a step gave up waiting for a lock after its
+// timeout, and describes who was holding the locks it waited for.
+type TimeoutError struct {
+	Timeout time.Duration
+	Holders []Holder
+}
+
+func (err TimeoutError) Error() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "%s after %s", ErrTimedOut, err.Timeout)
+
+	if len(err.Holders) == 0 {
+		return message.String()
+	}
+
+	message.WriteString(", locks held by:")
+	for _, holder := range err.Holders {
+		fmt.Fprintf(&message, "\n  %s/%s: %s", holder.Pool, holder.Lock, holder.Owner)
+	}
+
+	return message.String()
+}
+
+func (err TimeoutError) Is(target error) bool {
+	return target == ErrTimedOut
+}